@@ -0,0 +1,108 @@
+package cacheUtil
+
+import (
+	"sync/atomic"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
+)
+
+// CacheStats is a snapshot of the counters of a cache
+type CacheStats struct {
+	// Hits is the number of reads that found a value
+	Hits int64
+
+	// Misses is the number of reads that found nothing
+	Misses int64
+
+	// Loads is the number of values loaded on a miss
+	Loads int64
+
+	// LoadFailures is the number of loads that returned an error
+	LoadFailures int64
+
+	// Evictions is the number of entries evicted to make room for others
+	Evictions int64
+
+	// Expirations is the number of entries removed because they expired
+	Expirations int64
+}
+
+// HitRate returns Hits / (Hits + Misses), or 0 if nothing was read
+func (s *CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+// add adds the counters of other to s
+func (s *CacheStats) add(other *CacheStats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Loads += other.Loads
+	s.LoadFailures += other.LoadFailures
+	s.Evictions += other.Evictions
+	s.Expirations += other.Expirations
+}
+
+// cacheStats holds the live counters, updated with atomic operations
+type cacheStats struct {
+	hits         int64
+	misses       int64
+	loads        int64
+	loadFailures int64
+	evictions    int64
+	expirations  int64
+}
+
+// recordGet counts a read
+func (s *cacheStats) recordGet(ok bool) {
+	if ok {
+		atomic.AddInt64(&s.hits, 1)
+	} else {
+		atomic.AddInt64(&s.misses, 1)
+	}
+}
+
+// recordLoad counts a load and whether it failed
+func (s *cacheStats) recordLoad(err error) {
+	atomic.AddInt64(&s.loads, 1)
+	if err != nil {
+		atomic.AddInt64(&s.loadFailures, 1)
+	}
+}
+
+// recordEvict counts an entry leaving the cache; explicit removes and purges
+// are not counted
+func (s *cacheStats) recordEvict(reason simplelru.EvictReason) {
+	switch reason {
+	case simplelru.Evict_Capacity:
+		atomic.AddInt64(&s.evictions, 1)
+	case simplelru.Evict_Expired:
+		atomic.AddInt64(&s.expirations, 1)
+	}
+}
+
+// snapshot returns a copy of the counters
+func (s *cacheStats) snapshot() *CacheStats {
+	return &CacheStats{
+		Hits:         atomic.LoadInt64(&s.hits),
+		Misses:       atomic.LoadInt64(&s.misses),
+		Loads:        atomic.LoadInt64(&s.loads),
+		LoadFailures: atomic.LoadInt64(&s.loadFailures),
+		Evictions:    atomic.LoadInt64(&s.evictions),
+		Expirations:  atomic.LoadInt64(&s.expirations),
+	}
+}
+
+// reset sets every counter to 0
+func (s *cacheStats) reset() {
+	atomic.StoreInt64(&s.hits, 0)
+	atomic.StoreInt64(&s.misses, 0)
+	atomic.StoreInt64(&s.loads, 0)
+	atomic.StoreInt64(&s.loadFailures, 0)
+	atomic.StoreInt64(&s.evictions, 0)
+	atomic.StoreInt64(&s.expirations, 0)
+}
@@ -0,0 +1,170 @@
+package cacheUtil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/polariseye/goutil/zlibUtil"
+	"github.com/vmihailenco/msgpack"
+)
+
+// flag set in the header byte when the data is compressed
+const con_COMPRESSED_FLAG byte = 0x80
+
+// Codec is a Marshaler and Unmarshaler pair, it can be passed to
+// NewRedisCache as both marshalObj and unmarshalObj
+type Codec interface {
+	Marshaler
+	Unmarshaler
+}
+
+// JsonCodec marshals values with encoding/json
+type JsonCodec struct{}
+
+func (JsonCodec) Marshal(val interface{}) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JsonCodec) Unmarshal(bytesData []byte, val interface{}) error {
+	return json.Unmarshal(bytesData, val)
+}
+
+// MsgpackCodec marshals values with msgpack
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(val interface{}) ([]byte, error) {
+	return msgpack.Marshal(val)
+}
+
+func (MsgpackCodec) Unmarshal(bytesData []byte, val interface{}) error {
+	return msgpack.Unmarshal(bytesData, val)
+}
+
+// GobCodec marshals values with encoding/gob
+type GobCodec struct{}
+
+func (GobCodec) Marshal(val interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(val); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(bytesData []byte, val interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(bytesData)).Decode(val)
+}
+
+// ProtobufCodec marshals protobuf messages, values must implement proto.Message
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Marshal(val interface{}) ([]byte, error) {
+	message, ok := val.(proto.Message)
+	if ok == false {
+		return nil, fmt.Errorf("%T is not a proto.Message", val)
+	}
+
+	return proto.Marshal(message)
+}
+
+func (ProtobufCodec) Unmarshal(bytesData []byte, val interface{}) error {
+	message, ok := val.(proto.Message)
+	if ok == false {
+		return fmt.Errorf("%T is not a proto.Message", val)
+	}
+
+	return proto.Unmarshal(bytesData, message)
+}
+
+// VersionedCodec writes a header byte before the data. The low 7 bits hold
+// the version of the format and the high bit tells whether the data is
+// compressed with zlibUtil. Data written by older versions stays readable as
+// long as their codecs are registered with AddVersion.
+type VersionedCodec struct {
+	version  byte
+	codecMap map[byte]Codec
+
+	// compressThreshold is the minimum size of data to compress, <= 0 means never
+	compressThreshold int
+	compressLevel     int
+}
+
+// NewVersionedCodec constructs a VersionedCodec that writes with codec and
+// the given version (0~127)
+func NewVersionedCodec(version byte, codec Codec) (*VersionedCodec, error) {
+	if version&con_COMPRESSED_FLAG != 0 {
+		return nil, fmt.Errorf("version must be in [0, 127], but now is %d", version)
+	}
+
+	return &VersionedCodec{
+		version:       version,
+		codecMap:      map[byte]Codec{version: codec},
+		compressLevel: zlib.DefaultCompression,
+	}, nil
+}
+
+// AddVersion registers the codec used to read data of an older version
+func (c *VersionedCodec) AddVersion(version byte, codec Codec) error {
+	if version&con_COMPRESSED_FLAG != 0 {
+		return fmt.Errorf("version must be in [0, 127], but now is %d", version)
+	}
+
+	c.codecMap[version] = codec
+	return nil
+}
+
+// SetCompress compresses data of at least threshold bytes with the given
+// zlib level; threshold <= 0 turns compression off
+func (c *VersionedCodec) SetCompress(threshold int, level int) {
+	c.compressThreshold = threshold
+	c.compressLevel = level
+}
+
+func (c *VersionedCodec) Marshal(val interface{}) (bytesData []byte, err error) {
+	bytesData, err = c.codecMap[c.version].Marshal(val)
+	if err != nil {
+		return
+	}
+
+	header := c.version
+	if c.compressThreshold > 0 && len(bytesData) >= c.compressThreshold {
+		var compressed []byte
+		if compressed, err = zlibUtil.Compress(bytesData, c.compressLevel); err != nil {
+			return nil, err
+		}
+
+		// keep the original data if compression does not help
+		if len(compressed) < len(bytesData) {
+			header |= con_COMPRESSED_FLAG
+			bytesData = compressed
+		}
+	}
+
+	return append([]byte{header}, bytesData...), nil
+}
+
+func (c *VersionedCodec) Unmarshal(bytesData []byte, val interface{}) (err error) {
+	if len(bytesData) == 0 {
+		return fmt.Errorf("missing version header")
+	}
+
+	header := bytesData[0]
+	codec, exists := c.codecMap[header&^con_COMPRESSED_FLAG]
+	if exists == false {
+		return fmt.Errorf("unknown version %d", header&^con_COMPRESSED_FLAG)
+	}
+
+	bytesData = bytesData[1:]
+	if header&con_COMPRESSED_FLAG != 0 {
+		if bytesData, err = zlibUtil.Decompress(bytesData); err != nil {
+			return
+		}
+	}
+
+	return codec.Unmarshal(bytesData, val)
+}
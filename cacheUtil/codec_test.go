@@ -0,0 +1,95 @@
+package cacheUtil
+
+import (
+	"strings"
+	"testing"
+)
+
+type codecVal struct {
+	Name  string
+	Count int
+}
+
+func TestCodec(t *testing.T) {
+	for _, codec := range []Codec{JsonCodec{}, MsgpackCodec{}, GobCodec{}} {
+		data, err := codec.Marshal(&codecVal{Name: "a", Count: 1})
+		if err != nil {
+			t.Fatalf("%T err: %v", codec, err)
+		}
+
+		val := &codecVal{}
+		if err = codec.Unmarshal(data, val); err != nil || val.Name != "a" || val.Count != 1 {
+			t.Fatalf("%T bad value: %v %v", codec, val, err)
+		}
+	}
+
+	if _, err := (ProtobufCodec{}).Marshal(&codecVal{}); err == nil {
+		t.Fatalf("non proto.Message should fail")
+	}
+}
+
+func TestVersionedCodec(t *testing.T) {
+	oldCodec, _ := NewVersionedCodec(1, JsonCodec{})
+	newCodec, _ := NewVersionedCodec(2, GobCodec{})
+	newCodec.AddVersion(1, JsonCodec{})
+	newCodec.SetCompress(64, 9)
+
+	oldData, _ := oldCodec.Marshal(&codecVal{Name: "old"})
+	val := &codecVal{}
+	if err := newCodec.Unmarshal(oldData, val); err != nil || val.Name != "old" {
+		t.Fatalf("old version should be readable: %v %v", val, err)
+	}
+
+	longVal := &codecVal{Name: strings.Repeat("a", 1024)}
+	data, _ := newCodec.Marshal(longVal)
+	if data[0] != 2|con_COMPRESSED_FLAG || len(data) > 512 {
+		t.Fatalf("data should be compressed: %v %v", data[0], len(data))
+	}
+	val = &codecVal{}
+	if err := newCodec.Unmarshal(data, val); err != nil || val.Name != longVal.Name {
+		t.Fatalf("bad value: %v", err)
+	}
+
+	if err := oldCodec.Unmarshal(data, val); err == nil {
+		t.Fatalf("unknown version should fail")
+	}
+	if _, err := NewVersionedCodec(128, JsonCodec{}); err == nil {
+		t.Fatalf("version 128 should fail")
+	}
+}
+
+func TestMarshalBase(t *testing.T) {
+	marshalObj := NewMarshal(JsonCodec{})
+	unmarshalObj := NewUnmarhsal(JsonCodec{})
+
+	data, err := marshalObj.Marshal(12)
+	if err != nil || string(data) != "12" {
+		t.Fatalf("bad int data: %s %v", data, err)
+	}
+	intVal := 0
+	if err = unmarshalObj.Unmarshal(data, &intVal); err != nil || intVal != 12 {
+		t.Fatalf("bad int value: %v %v", intVal, err)
+	}
+
+	// pointers to basic types are written as the value, not the address
+	ptrVal := 5
+	data, err = marshalObj.Marshal(&ptrVal)
+	if err != nil || string(data) != "5" {
+		t.Fatalf("bad *int data: %s %v", data, err)
+	}
+
+	data, err = marshalObj.Marshal("hello")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("bad string data: %s %v", data, err)
+	}
+	strVal := ""
+	if err = unmarshalObj.Unmarshal(data, &strVal); err != nil || strVal != "hello" {
+		t.Fatalf("bad string value: %v %v", strVal, err)
+	}
+
+	data, _ = marshalObj.Marshal(&codecVal{Name: "a"})
+	val := &codecVal{}
+	if err = unmarshalObj.Unmarshal(data, val); err != nil || val.Name != "a" {
+		t.Fatalf("bad struct value: %v %v", val, err)
+	}
+}
@@ -0,0 +1,397 @@
+package cacheUtil
+
+import (
+	"strings"
+	"time"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
+	"github.com/polariseye/goutil/redisUtil"
+)
+
+// number of keys deleted from redis by one DEL
+const con_DEL_BATCH_SIZE = 100
+
+// RangeSub calls fn for every live sub-key of mainKey, without updating the
+// recent-ness, until fn returns false. fn is called after the shard lock is
+// released, so it may use the cache.
+func (c *MemoryCache) RangeSub(mainKey string, fn func(subKey string, value interface{}) bool) {
+	var subKeyList []string
+	var valueList []interface{}
+
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	shard.lru.RangeSub(mainKey, func(subKey string, value interface{}) bool {
+		subKeyList = append(subKeyList, subKey)
+		valueList = append(valueList, value)
+		return true
+	})
+	shard.unlock()
+
+	for index, subKey := range subKeyList {
+		if !fn(subKey, valueList[index]) {
+			return
+		}
+	}
+}
+
+// SubKeys returns the live sub-keys of mainKey.
+func (c *MemoryCache) SubKeys(mainKey string) (subKeyList []string) {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	shard.lru.RangeSub(mainKey, func(subKey string, value interface{}) bool {
+		subKeyList = append(subKeyList, subKey)
+		return true
+	})
+
+	return
+}
+
+// CountSub returns the number of live sub-keys of mainKey.
+func (c *MemoryCache) CountSub(mainKey string) int {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.CountSub(mainKey)
+}
+
+// ExpireSub makes every live sub-key of mainKey expire after ttl (ttl <= 0
+// means never), returns the number of sub-keys changed.
+func (c *MemoryCache) ExpireSub(mainKey string, ttl time.Duration) int {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.ExpireSub(mainKey, ttl)
+}
+
+// RemovePrefix removes every entry whose mainKey starts with prefix, returns
+// the number of entries removed.
+func (c *MemoryCache) RemovePrefix(prefix string) (count int) {
+	c.lockAll()
+	defer c.unlockAll()
+
+	for _, shard := range c._shardList {
+		count += shard.lru.RemovePrefix(prefix)
+	}
+
+	return
+}
+
+// GetMulti looks up many keys, locking each shard once. Keys not in the cache
+// are missing from the result.
+func (c *MemoryCache) GetMulti(keyList []*simplelru.Key) (result map[simplelru.Key]interface{}) {
+	result = make(map[simplelru.Key]interface{}, len(keyList))
+	for shard, shardKeyList := range c.groupKeys(keyList) {
+		shard.lock.Lock()
+		for _, key := range shardKeyList {
+			value, ok := shard.lru.GetSub(key.MainKey, key.SubKey)
+			shard.stats.recordGet(ok)
+			if ok {
+				result[*key] = value
+			}
+		}
+		shard.unlock()
+	}
+
+	return
+}
+
+// SetMulti adds many values, locking each shard once. Returns true if an
+// eviction occurred.
+func (c *MemoryCache) SetMulti(items map[simplelru.Key]interface{}) (evicted bool) {
+	keyList := make([]*simplelru.Key, 0, len(items))
+	for key := range items {
+		keyList = append(keyList, &simplelru.Key{MainKey: key.MainKey, SubKey: key.SubKey})
+	}
+
+	for shard, shardKeyList := range c.groupKeys(keyList) {
+		shard.lock.Lock()
+		for _, key := range shardKeyList {
+			if shard.set(key.MainKey, key.SubKey, items[*key], 0, false, -1) {
+				evicted = true
+			}
+		}
+		shard.unlock()
+	}
+
+	return
+}
+
+// groupKeys groups keys by the shard that owns them
+func (c *MemoryCache) groupKeys(keyList []*simplelru.Key) map[*memoryShard][]*simplelru.Key {
+	result := make(map[*memoryShard][]*simplelru.Key)
+	for _, key := range keyList {
+		shard := c.getShard(key.MainKey)
+		result[shard] = append(result[shard], key)
+	}
+
+	return result
+}
+
+// GetMulti looks up many keys, first in memory and then the missing ones in
+// redis with one pipeline (one request per key in cluster mode). Values read
+// from redis are saved to memory. In read-through mode (see SetLoader) keys
+// missing in memory are read with Get one by one. Keys that do not exist are
+// missing from the result.
+func (r *RedisCache) GetMulti(keyList []*simplelru.Key, newValueFunc func(mainKey, subKey string) interface{}) (result map[simplelru.Key]interface{}, err error) {
+	result = make(map[simplelru.Key]interface{}, len(keyList))
+
+	// in read-through mode misses are counted by getOrLoad
+	loader, option := r.getLoader()
+
+	memoryResult := r.memoryCache.GetMulti(keyList)
+	var missList []*simplelru.Key
+	for _, key := range keyList {
+		memoryValue, exists := memoryResult[*key]
+		if exists || loader == nil {
+			r.stats.recordGet(exists)
+		}
+		if exists == false {
+			missList = append(missList, key)
+			continue
+		}
+
+		if value, ok := unwrapMemoryValue(memoryValue); ok {
+			result[*key] = value
+		}
+	}
+	if len(missList) == 0 {
+		return
+	}
+
+	if loader != nil {
+		for _, key := range missList {
+			value, ok, loadErr := r.getOrLoad(key.MainKey, key.SubKey, func() interface{} {
+				return newValueFunc(key.MainKey, key.SubKey)
+			}, loader, option)
+			if loadErr != nil {
+				return result, loadErr
+			}
+			if ok {
+				result[*key] = value
+			}
+		}
+
+		return
+	}
+
+	bytesList, existsList, err := r.getBytesMulti(missList)
+	if err != nil {
+		return
+	}
+
+	loadedItems := make(map[simplelru.Key]interface{}, len(missList))
+	for index, key := range missList {
+		if existsList[index] == false {
+			// add nil to cache to avoid too many when get
+			r.stats.recordLoad(nil)
+			loadedItems[*key] = nil
+			continue
+		}
+
+		value := newValueFunc(key.MainKey, key.SubKey)
+		unmarshalErr := r.unmarshalObj.Unmarshal(bytesList[index], value)
+		r.stats.recordLoad(unmarshalErr)
+		if unmarshalErr != nil {
+			err = unmarshalErr
+			continue
+		}
+
+		result[*key] = value
+		loadedItems[*key] = value
+	}
+	r.memoryCache.SetMulti(loadedItems)
+
+	return
+}
+
+// SetMulti adds many values to redis with one pipeline (one request per key
+// in cluster mode) and the default expire, and then to memory.
+func (r *RedisCache) SetMulti(items map[simplelru.Key]interface{}) (err error) {
+	var pipeline *redisUtil.Pipeline
+	if r.isCluster() == false {
+		pipeline = r.redisPool.NewPipeline()
+	}
+
+	replyList := make([]*redisUtil.Reply, 0, len(items))
+	for key, value := range items {
+		var bytesData []byte
+		if bytesData, err = r.marshalObj.Marshal(value); err != nil {
+			return
+		}
+
+		redisKey := r.ConvertToRedisKey(key.MainKey, key.SubKey)
+		if pipeline == nil {
+			if r.defaultRedisExpireSeconds > 0 {
+				err = r.redisPool.Set2(redisKey, bytesData, redisUtil.Expire_Seond, r.defaultRedisExpireSeconds)
+			} else {
+				err = r.redisPool.Set(redisKey, bytesData)
+			}
+			if err != nil {
+				return
+			}
+		} else if r.defaultRedisExpireSeconds > 0 {
+			replyList = append(replyList, pipeline.Set2(redisKey, bytesData, redisUtil.Expire_Seond, r.defaultRedisExpireSeconds))
+		} else {
+			replyList = append(replyList, pipeline.Set(redisKey, bytesData))
+		}
+	}
+
+	if pipeline != nil {
+		if err = pipeline.Exec(); err != nil {
+			return
+		}
+		for _, reply := range replyList {
+			if err = reply.Err(); err != nil {
+				return
+			}
+		}
+	}
+
+	r.memoryCache.SetMulti(items)
+	for key := range items {
+		r.publishInvalidation(key.MainKey, key.SubKey)
+	}
+
+	return
+}
+
+// SubKeys returns the sub-keys of mainKey in redis, found with SCAN
+func (r *RedisCache) SubKeys(mainKey string) (subKeyList []string, err error) {
+	iterator := r.redisPool.Scan(&redisUtil.ScanOption{
+		Match: escapeMatchPattern(r.ConvertToRedisKey(mainKey, "")) + "*",
+	})
+	for iterator.Next() {
+		itemMainKey, subKey, convertErr := r.ConvertFromRedisKey(iterator.Item())
+		if convertErr == nil && itemMainKey == mainKey {
+			subKeyList = append(subKeyList, subKey)
+		}
+	}
+
+	err = iterator.Err()
+	return
+}
+
+// ExpireSub makes every sub-key of mainKey expire after expireSeconds, in
+// redis and in memory. Peers drop their in-memory copies of mainKey.
+// Returns the number of sub-keys changed in redis.
+func (r *RedisCache) ExpireSub(mainKey string, expireSeconds int) (count int, err error) {
+	subKeyList, err := r.SubKeys(mainKey)
+	if err != nil {
+		return
+	}
+
+	for _, subKey := range subKeyList {
+		var success bool
+		if success, err = r.redisPool.Expire(r.ConvertToRedisKey(mainKey, subKey), expireSeconds); err != nil {
+			return
+		}
+		if success {
+			count++
+		}
+	}
+
+	r.memoryCache.ExpireSub(mainKey, time.Duration(expireSeconds)*time.Second)
+	r.publishScopedInvalidation(invalidation_Main, mainKey, "")
+	return
+}
+
+// RemovePrefix removes every key whose mainKey starts with prefix from redis
+// and memory, and tells peers to do the same in memory. Returns the number of
+// keys removed from redis.
+func (r *RedisCache) RemovePrefix(prefix string) (count int, err error) {
+	var keyList []string
+	iterator := r.redisPool.Scan(&redisUtil.ScanOption{
+		Match: escapeMatchPattern(prefix) + "*",
+	})
+	for iterator.Next() {
+		mainKey, _, convertErr := r.ConvertFromRedisKey(iterator.Item())
+		if convertErr == nil && strings.HasPrefix(mainKey, prefix) {
+			keyList = append(keyList, iterator.Item())
+		}
+	}
+	if err = iterator.Err(); err != nil {
+		return
+	}
+
+	// keys of one DEL must be in the same slot in cluster mode
+	batchSize := con_DEL_BATCH_SIZE
+	if r.isCluster() {
+		batchSize = 1
+	}
+	for len(keyList) > 0 {
+		batch := keyList
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		keyList = keyList[len(batch):]
+
+		var delCount int
+		if delCount, err = r.redisPool.Del(batch...); err != nil {
+			return
+		}
+		count += delCount
+	}
+
+	r.memoryCache.RemovePrefix(prefix)
+	r.publishScopedInvalidation(invalidation_Prefix, prefix, "")
+	return
+}
+
+// getBytesMulti reads many keys from redis
+func (r *RedisCache) getBytesMulti(keyList []*simplelru.Key) (bytesList [][]byte, existsList []bool, err error) {
+	bytesList = make([][]byte, len(keyList))
+	existsList = make([]bool, len(keyList))
+	if r.isCluster() {
+		for index, key := range keyList {
+			bytesList[index], existsList[index], err = r.redisPool.GetBytes(r.ConvertToRedisKey(key.MainKey, key.SubKey))
+			if err != nil {
+				r.stats.recordLoad(err)
+				return
+			}
+		}
+
+		return
+	}
+
+	pipeline := r.redisPool.NewPipeline()
+	replyList := make([]*redisUtil.Reply, len(keyList))
+	for index, key := range keyList {
+		replyList[index] = pipeline.Get(r.ConvertToRedisKey(key.MainKey, key.SubKey))
+	}
+	if err = pipeline.Exec(); err != nil {
+		r.stats.recordLoad(err)
+		return
+	}
+
+	for index, reply := range replyList {
+		if bytesList[index], existsList[index], err = reply.Bytes(); err != nil {
+			r.stats.recordLoad(err)
+			return
+		}
+	}
+
+	return
+}
+
+// isCluster returns true if the redis pool is in cluster mode, where keys of
+// one request must be in the same slot
+func (r *RedisCache) isCluster() bool {
+	return r.redisPool.GetMode() == redisUtil.Mode_Cluster
+}
+
+// escapeMatchPattern escapes the special characters of a SCAN MATCH pattern
+func escapeMatchPattern(pattern string) string {
+	var builder strings.Builder
+	for _, char := range pattern {
+		if strings.ContainsRune(`*?[]\`, char) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,138 @@
+package cacheUtil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/polariseye/goutil/logUtil"
+	"github.com/polariseye/goutil/redisUtil"
+	"github.com/polariseye/goutil/stringUtil"
+)
+
+// scopes of an invalidationMessage
+const (
+	// drop MainKey/SubKey
+	invalidation_Sub = iota
+
+	// drop every sub-key of MainKey
+	invalidation_Main
+
+	// drop every mainKey starting with MainKey
+	invalidation_Prefix
+)
+
+// invalidationMessage is published to peers after a key was changed in redis
+type invalidationMessage struct {
+	// Source is the id of the publishing RedisCache, used to skip own messages
+	Source string `json:"s"`
+
+	Scope   int    `json:"t,omitempty"`
+	MainKey string `json:"m"`
+	SubKey  string `json:"k"`
+}
+
+// invalidationBus publishes local changes and drops the memory entries
+// changed by peers. It uses its own subscriber connection from the RedisPool.
+type invalidationBus struct {
+	channel    string
+	sourceId   string
+	subscriber *redisUtil.Subscriber
+}
+
+// EnableInvalidation makes this cache tell every peer subscribed to channel
+// to drop its in-memory copy after Set/Remove, and drop its own copies when
+// a peer changes a key. After the subscriber reconnects the whole memory cache
+// is purged, because messages sent while disconnected are lost.
+func (r *RedisCache) EnableInvalidation(channel string) error {
+	r.invalidationLock.Lock()
+	defer r.invalidationLock.Unlock()
+
+	if r.invalidationBus != nil {
+		if r.invalidationBus.channel == channel {
+			return nil
+		}
+
+		return fmt.Errorf("invalidation is already enabled on channel %s", r.invalidationBus.channel)
+	}
+
+	bus := &invalidationBus{
+		channel:  channel,
+		sourceId: stringUtil.GetNewGUID(),
+	}
+	bus.subscriber = r.redisPool.NewSubscriber(func(message *redisUtil.SubscribeMessage) {
+		r.onInvalidation(bus, message)
+	})
+	bus.subscriber.SetReconnectHandler(r.memoryCache.Purge)
+	if err := bus.subscriber.Subscribe(channel); err != nil {
+		bus.subscriber.Close()
+		return err
+	}
+
+	r.invalidationBus = bus
+	return nil
+}
+
+// DisableInvalidation stops publishing and receiving invalidation messages
+func (r *RedisCache) DisableInvalidation() {
+	r.invalidationLock.Lock()
+	bus := r.invalidationBus
+	r.invalidationBus = nil
+	r.invalidationLock.Unlock()
+
+	if bus != nil {
+		bus.subscriber.Close()
+	}
+}
+
+// publishInvalidation tells peers that mainKey/subKey was changed
+func (r *RedisCache) publishInvalidation(mainKey, subKey string) {
+	r.publishScopedInvalidation(invalidation_Sub, mainKey, subKey)
+}
+
+// publishScopedInvalidation tells peers that the keys of scope were changed.
+// A failure is only logged since the change itself has already been written
+// to redis.
+func (r *RedisCache) publishScopedInvalidation(scope int, mainKey, subKey string) {
+	r.invalidationLock.RLock()
+	bus := r.invalidationBus
+	r.invalidationLock.RUnlock()
+	if bus == nil {
+		return
+	}
+
+	data, err := json.Marshal(&invalidationMessage{
+		Source:  bus.sourceId,
+		Scope:   scope,
+		MainKey: mainKey,
+		SubKey:  subKey,
+	})
+	if err != nil {
+		logUtil.NormalLog(fmt.Sprintf("cacheUtil: marshal invalidation of %s failed:%s", r.ConvertToRedisKey(mainKey, subKey), err), logUtil.Error)
+		return
+	}
+
+	if _, err = r.redisPool.Publish(bus.channel, data); err != nil {
+		logUtil.NormalLog(fmt.Sprintf("cacheUtil: publish invalidation of %s failed:%s", r.ConvertToRedisKey(mainKey, subKey), err), logUtil.Error)
+	}
+}
+
+// onInvalidation handles a message received from the invalidation channel
+func (r *RedisCache) onInvalidation(bus *invalidationBus, message *redisUtil.SubscribeMessage) {
+	msg := &invalidationMessage{}
+	if err := json.Unmarshal(message.Data, msg); err != nil {
+		logUtil.NormalLog(fmt.Sprintf("cacheUtil: invalid invalidation message %s:%s", string(message.Data), err), logUtil.Warn)
+		return
+	}
+	if msg.Source == bus.sourceId {
+		return
+	}
+
+	switch msg.Scope {
+	case invalidation_Main:
+		r.RemoveFromMemory(msg.MainKey)
+	case invalidation_Prefix:
+		r.memoryCache.RemovePrefix(msg.MainKey)
+	default:
+		r.RemoveSubFromMemory(msg.MainKey, msg.SubKey)
+	}
+}
@@ -0,0 +1,244 @@
+package cacheUtil
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/polariseye/goutil/logUtil"
+)
+
+// Loader loads a value from the source of truth (e.g. a MySQL query).
+// exists is false if there is no value for the key.
+type Loader func(mainKey, subKey string) (value interface{}, exists bool, err error)
+
+// LoaderOption controls how RedisCache uses its Loader
+type LoaderOption struct {
+	// RefreshAfter is the age after which a loaded value is stale. A stale
+	// value is still returned while one background load refreshes it.
+	// 0 means values are never refreshed.
+	RefreshAfter time.Duration
+
+	// NegativeTTL is how long a "not exists" result is kept in memory.
+	// 0 means it is not kept.
+	NegativeTTL time.Duration
+
+	// FailureTTL is how long a failed load is kept in memory, during which
+	// Get returns the same error without calling the loader again. A failed
+	// background refresh is retried after FailureTTL as well.
+	// 0 means it is not kept.
+	FailureTTL time.Duration
+}
+
+// loadedValue is kept in the memory cache for keys read in read-through mode
+type loadedValue struct {
+	value  interface{}
+	exists bool
+	err    error
+
+	// nextRefreshTime is the unix nano time after which the value is stale
+	nextRefreshTime int64
+	isRefreshing    int32
+}
+
+// SetLoader turns on read-through mode: on a miss in memory and in redis,
+// Get calls loader, writes the value to redis and memory, and returns it.
+// Loads of the same key run once at a time, in the same singleflight group
+// used for redis reads. option may be nil.
+func (r *RedisCache) SetLoader(loader Loader, option *LoaderOption) {
+	if option == nil {
+		option = &LoaderOption{}
+	}
+
+	r.loaderLock.Lock()
+	defer r.loaderLock.Unlock()
+
+	r.loader = loader
+	r.loaderOption = option
+}
+
+// getLoader returns the loader and its option, loader is nil if not set
+func (r *RedisCache) getLoader() (Loader, *LoaderOption) {
+	r.loaderLock.RLock()
+	defer r.loaderLock.RUnlock()
+
+	return r.loader, r.loaderOption
+}
+
+// getOrLoad is Get in read-through mode
+func (r *RedisCache) getOrLoad(mainKey string, subKey string, newValueFunc func() interface{}, loader Loader, option *LoaderOption) (actualValue interface{}, ok bool, err error) {
+	if memoryValue, exists := r.memoryCache.GetSub(mainKey, subKey); exists {
+		item, isLoaded := memoryValue.(*loadedValue)
+		if isLoaded == false {
+			// a nil placeholder stored for a missing key falls through to the loader
+			if value, ok := unwrapMemoryValue(memoryValue); ok {
+				r.stats.recordGet(true)
+				return value, true, nil
+			}
+
+			return r.loadMissing(mainKey, subKey, newValueFunc, loader, option)
+		}
+
+		r.stats.recordGet(true)
+		if item.exists && option.RefreshAfter > 0 && atomic.LoadInt64(&item.nextRefreshTime) <= time.Now().UnixNano() {
+			r.refresh(mainKey, subKey, item, loader, option)
+		}
+
+		return item.value, item.exists, item.err
+	}
+
+	return r.loadMissing(mainKey, subKey, newValueFunc, loader, option)
+}
+
+// loadMissing loads a value that is not in memory, once at a time per key
+func (r *RedisCache) loadMissing(mainKey string, subKey string, newValueFunc func() interface{}, loader Loader, option *LoaderOption) (actualValue interface{}, ok bool, err error) {
+	r.stats.recordGet(false)
+
+	doValue, _ := r.doGroup.Do(r.getLoadKey(mainKey, subKey), func() (interface{}, error) {
+		return r.load(mainKey, subKey, newValueFunc, loader, option), nil
+	})
+
+	item := doValue.(*loadedValue)
+	return item.value, item.exists, item.err
+}
+
+// load reads the value from redis, or from the loader if it is not in redis,
+// and saves the result in memory
+func (r *RedisCache) load(mainKey string, subKey string, newValueFunc func() interface{}, loader Loader, option *LoaderOption) *loadedValue {
+	key := r.ConvertToRedisKey(mainKey, subKey)
+	bytesData, exists, err := r.redisPool.GetBytes(key)
+	if err == nil && exists {
+		value := newValueFunc()
+		if err = r.unmarshalObj.Unmarshal(bytesData, value); err == nil {
+			r.stats.recordLoad(nil)
+
+			item := newLoadedValue(value, true, nil, option)
+			r.memoryCache.Set(mainKey, subKey, item)
+			return item
+		}
+	}
+	if err != nil {
+		// the loader is the source of truth, so a broken redis only costs a load
+		r.stats.recordLoad(err)
+		logUtil.NormalLog(fmt.Sprintf("cacheUtil: get %s from redis failed, use loader instead:%s", key, err), logUtil.Warn)
+	}
+
+	return r.loadFromLoader(mainKey, subKey, loader, option)
+}
+
+// loadFromLoader calls the loader and saves the result in redis and memory
+func (r *RedisCache) loadFromLoader(mainKey string, subKey string, loader Loader, option *LoaderOption) (item *loadedValue) {
+	value, exists, err := r.callLoader(mainKey, subKey, loader)
+	r.stats.recordLoad(err)
+
+	item = newLoadedValue(value, exists, err, option)
+	switch {
+	case err != nil:
+		if option.FailureTTL > 0 {
+			r.memoryCache.SetWithTTL(mainKey, subKey, item, option.FailureTTL)
+		}
+	case exists == false:
+		if option.NegativeTTL > 0 {
+			r.memoryCache.SetWithTTL(mainKey, subKey, item, option.NegativeTTL)
+		} else {
+			r.memoryCache.RemoveSub(mainKey, subKey)
+		}
+	default:
+		if setErr := r.setToRedis(mainKey, subKey, value, r.defaultRedisExpireSeconds); setErr != nil {
+			logUtil.NormalLog(fmt.Sprintf("cacheUtil: set %s to redis failed:%s", r.ConvertToRedisKey(mainKey, subKey), setErr), logUtil.Error)
+		}
+		r.memoryCache.Set(mainKey, subKey, item)
+		r.publishInvalidation(mainKey, subKey)
+	}
+
+	return
+}
+
+// callLoader calls the loader and turns a panic into an error
+func (r *RedisCache) callLoader(mainKey string, subKey string, loader Loader) (value interface{}, exists bool, err error) {
+	defer func() {
+		if recoverErr := recover(); recoverErr != nil {
+			logUtil.LogUnknownError(recoverErr)
+			value, exists, err = nil, false, fmt.Errorf("load %s panic:%v", r.ConvertToRedisKey(mainKey, subKey), recoverErr)
+		}
+	}()
+
+	return loader(mainKey, subKey)
+}
+
+// refresh reloads a stale value in the background, while the stale value
+// keeps being served. If the reload fails the stale value is kept and the
+// reload is retried after FailureTTL (or RefreshAfter if it is 0).
+func (r *RedisCache) refresh(mainKey string, subKey string, item *loadedValue, loader Loader, option *LoaderOption) {
+	if atomic.CompareAndSwapInt32(&item.isRefreshing, 0, 1) == false {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&item.isRefreshing, 0)
+
+		r.doGroup.Do(r.getLoadKey(mainKey, subKey), func() (interface{}, error) {
+			value, exists, err := r.callLoader(mainKey, subKey, loader)
+			r.stats.recordLoad(err)
+			if err != nil {
+				retryAfter := option.FailureTTL
+				if retryAfter <= 0 {
+					retryAfter = option.RefreshAfter
+				}
+				atomic.StoreInt64(&item.nextRefreshTime, time.Now().Add(retryAfter).UnixNano())
+				logUtil.NormalLog(fmt.Sprintf("cacheUtil: refresh %s failed, keep the stale value:%s", r.ConvertToRedisKey(mainKey, subKey), err), logUtil.Warn)
+				return item, nil
+			}
+
+			newItem := newLoadedValue(value, exists, nil, option)
+			if exists {
+				if setErr := r.setToRedis(mainKey, subKey, value, r.defaultRedisExpireSeconds); setErr != nil {
+					logUtil.NormalLog(fmt.Sprintf("cacheUtil: set %s to redis failed:%s", r.ConvertToRedisKey(mainKey, subKey), setErr), logUtil.Error)
+				}
+				r.memoryCache.Set(mainKey, subKey, newItem)
+			} else {
+				if _, setErr := r.redisPool.Del(r.ConvertToRedisKey(mainKey, subKey)); setErr != nil {
+					logUtil.NormalLog(fmt.Sprintf("cacheUtil: del %s from redis failed:%s", r.ConvertToRedisKey(mainKey, subKey), setErr), logUtil.Error)
+				}
+				if option.NegativeTTL > 0 {
+					r.memoryCache.SetWithTTL(mainKey, subKey, newItem, option.NegativeTTL)
+				} else {
+					r.memoryCache.RemoveSub(mainKey, subKey)
+				}
+			}
+			r.publishInvalidation(mainKey, subKey)
+
+			return newItem, nil
+		})
+	}()
+}
+
+// getLoadKey returns the singleflight key of loads, which differs from the
+// key of plain redis reads since their results have different types
+func (r *RedisCache) getLoadKey(mainKey string, subKey string) string {
+	return "load:" + r.ConvertToRedisKey(mainKey, subKey)
+}
+
+// newLoadedValue creates the memory entry of a load result
+func newLoadedValue(value interface{}, exists bool, err error, option *LoaderOption) *loadedValue {
+	item := &loadedValue{
+		value:  value,
+		exists: exists,
+		err:    err,
+	}
+	if option.RefreshAfter > 0 {
+		item.nextRefreshTime = time.Now().Add(option.RefreshAfter).UnixNano()
+	}
+
+	return item
+}
+
+// unwrapMemoryValue returns the value kept in memory, and false if it is
+// a nil placeholder or a negative result
+func unwrapMemoryValue(memoryValue interface{}) (value interface{}, ok bool) {
+	if item, isLoaded := memoryValue.(*loadedValue); isLoaded {
+		return item.value, item.exists && item.err == nil
+	}
+
+	return memoryValue, memoryValue != nil
+}
@@ -16,18 +16,25 @@ type marshalBase struct {
 
 func (m *marshalBase) Marshal(val interface{}) (bytesData []byte, err error) {
 	valTp := reflect.ValueOf(val)
-	for valTp.Kind() != reflect.Ptr {
+	for valTp.Kind() == reflect.Ptr {
 		valTp = valTp.Elem()
 	}
 
 	switch valTp.Kind() {
-	case reflect.Array, reflect.Map, reflect.Struct:
-		return m.Marshal(val)
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct:
+		if m.actualMarshaler == nil {
+			err = fmt.Errorf("not supported type:%v", valTp.Kind().String())
+			return
+		}
+		return m.actualMarshaler.Marshal(val)
 	case reflect.Int, reflect.Bool, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
 		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
-		resultStr := fmt.Sprintf("%v", val)
+		resultStr := fmt.Sprintf("%v", valTp.Interface())
 		bytesData = []byte(resultStr)
 		return
+	case reflect.String:
+		bytesData = []byte(valTp.String())
+		return
 	default:
 		err = fmt.Errorf("not supported type:%v", valTp.Kind().String())
 		return
@@ -44,16 +51,24 @@ type unmarshalBase struct {
 
 func (u *unmarshalBase) Unmarshal(bytesData []byte, val interface{}) error {
 	valTp := reflect.ValueOf(val)
-	for valTp.Kind() != reflect.Ptr {
+	for valTp.Kind() == reflect.Ptr {
 		if valTp.IsNil() {
-			valTp.Set(reflect.New(valTp.Type()))
+			if valTp.CanSet() == false {
+				return fmt.Errorf("can not unmarshal to nil pointer")
+			}
+			valTp.Set(reflect.New(valTp.Type().Elem()))
 		}
 		valTp = valTp.Elem()
 	}
 
 	switch valTp.Kind() {
-	case reflect.Array, reflect.Map, reflect.Struct:
-		return u.Unmarshal(bytesData, val)
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct:
+		if u.actualunmarshaler == nil {
+			return fmt.Errorf("not supported type:%v", valTp.Kind().String())
+		}
+		return u.actualunmarshaler.Unmarshal(bytesData, val)
+	case reflect.String:
+		valTp.SetString(string(bytesData))
 	case reflect.Bool:
 		{
 			tmpResult, err := strconv.ParseBool(string(bytesData))
@@ -110,6 +125,14 @@ func (u *unmarshalBase) Unmarshal(bytesData []byte, val interface{}) error {
 			}
 			valTp.Set(reflect.ValueOf(uint(tmpResult)))
 		}
+	case reflect.Uint8:
+		{
+			tmpResult, err := strconv.ParseUint(string(bytesData), 10, 8)
+			if err != nil {
+				return err
+			}
+			valTp.Set(reflect.ValueOf(uint8(tmpResult)))
+		}
 	case reflect.Uint16:
 		{
 			tmpResult, err := strconv.ParseUint(string(bytesData), 10, 16)
@@ -144,7 +167,7 @@ func (u *unmarshalBase) Unmarshal(bytesData []byte, val interface{}) error {
 		}
 	case reflect.Float64:
 		{
-			tmpResult, err := strconv.ParseFloat(string(bytesData), 32)
+			tmpResult, err := strconv.ParseFloat(string(bytesData), 64)
 			if err != nil {
 				return err
 			}
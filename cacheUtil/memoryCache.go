@@ -1,15 +1,18 @@
 package cacheUtil
 
 import (
-	"github.com/polariseye/goutil/cacheUtil/simplelru"
-	"sync"
+	"errors"
 	"time"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
 )
 
-// MemoryCache is a thread-safe fixed size LRU cache.
+// MemoryCache is a thread-safe fixed size cache, LRU unless another policy is
+// chosen with NewMemoryCache2. Entries are spread over a number of shards by
+// mainKey, and each shard is guarded by its own lock.
 type MemoryCache struct {
-	_lruPool       *simplelru.LruPool
-	_lock          sync.RWMutex
+	_shardList     []*memoryShard
+	_onEvicted     func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason)
 	_expireSeconds int
 }
 
@@ -19,17 +22,88 @@ func NewMemoryCache(lruCapacity, size int, expireSeconds int) (*MemoryCache, err
 }
 
 // NewMemoryCacheWithEvict constructs a fixed size cache with the given eviction
-// callback.
+// callback. lruCapacity is the number of shards and size is the size of each
+// shard. The callback is invoked after the shard lock has been released.
 func NewMemoryCacheWithEvict(lruCapacity, size int, _expireSeconds int, onEvicted func(mainKey, subKey string, value interface{})) (*MemoryCache, error) {
-	lruPool, err := simplelru.NewLruPool(lruCapacity, size, simplelru.EvictCallback(onEvicted))
-	if err != nil {
-		return nil, err
+	var callback func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason)
+	if onEvicted != nil {
+		callback = func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason) {
+			onEvicted(mainKey, subKey, value)
+		}
 	}
+
+	return NewMemoryCacheWithEvictReason(lruCapacity, size, _expireSeconds, callback)
+}
+
+// NewMemoryCacheWithEvictReason constructs a fixed size cache whose eviction
+// callback is also told why the entry left the cache (capacity, expiry,
+// explicit remove or purge).
+func NewMemoryCacheWithEvictReason(lruCapacity, size int, _expireSeconds int, onEvicted func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason)) (*MemoryCache, error) {
+	return NewMemoryCache2(&MemoryCacheOption{
+		ShardCount:    lruCapacity,
+		ShardSize:     size,
+		ExpireSeconds: _expireSeconds,
+		OnEvicted:     onEvicted,
+	})
+}
+
+// MemoryCacheOption configures a MemoryCache
+type MemoryCacheOption struct {
+	// Policy is the eviction algorithm of every shard, LRU by default
+	Policy simplelru.Policy
+
+	// ShardCount is the number of shards
+	ShardCount int
+
+	// ShardSize is the number of entries each shard holds
+	ShardSize int
+
+	// ExpireSeconds removes entries not read for this long, 0 means never
+	ExpireSeconds int
+
+	// OnEvicted is called, after the shard lock is released, when an entry
+	// leaves the cache
+	OnEvicted func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason)
+
+	// MaxCost is the budget of the total cost (e.g. bytes), split evenly over
+	// the shards; 0 means only ShardSize limits the cache
+	MaxCost int64
+
+	// Sizer computes the cost of a value set without an explicit cost;
+	// without it such values cost 0
+	Sizer func(mainKey, subKey string, value interface{}) int64
+}
+
+// NewMemoryCache2 constructs a cache from option, which also chooses the
+// eviction policy.
+func NewMemoryCache2(option *MemoryCacheOption) (*MemoryCache, error) {
+	if option.ShardCount <= 0 {
+		return nil, errors.New("Must provide a positive size")
+	}
+
+	maxShardCost := int64(0)
+	if option.MaxCost > 0 {
+		maxShardCost = option.MaxCost / int64(option.ShardCount)
+		if maxShardCost <= 0 {
+			maxShardCost = 1
+		}
+	}
+
+	shardList := make([]*memoryShard, option.ShardCount)
+	for i := 0; i < option.ShardCount; i++ {
+		shard, err := newMemoryShard(option, maxShardCost)
+		if err != nil {
+			return nil, err
+		}
+		shardList[i] = shard
+	}
+
 	c := &MemoryCache{
-		_lruPool:       lruPool,
-		_expireSeconds: _expireSeconds,
+		_shardList:     shardList,
+		_onEvicted:     option.OnEvicted,
+		_expireSeconds: option.ExpireSeconds,
 	}
-	if _expireSeconds > 0 {
+	if c._expireSeconds > 0 {
 		go c.removeExpired()
 	}
 
@@ -38,128 +112,322 @@ func NewMemoryCacheWithEvict(lruCapacity, size int, _expireSeconds int, onEvicte
 
 // Purge is used to completely clear the cache.
 func (c *MemoryCache) Purge() {
-	c._lruPool.Purge()
+	c.lockAll()
+	defer c.unlockAll()
+
+	for _, shard := range c._shardList {
+		shard.lru.Purge()
+	}
 }
 
 // Add adds a value to the cache.  Returns true if an eviction occurred.
 func (c *MemoryCache) Set(mainKey, subKey string, value interface{}) (evicted bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	evicted = lru.Set(mainKey, subKey, value)
-	return evicted
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.set(mainKey, subKey, value, 0, false, -1)
+}
+
+// SetWithCost adds a value with the given cost instead of the one computed by
+// the Sizer. Entries are evicted until the total cost is within MaxCost.
+// Returns true if an eviction occurred.
+func (c *MemoryCache) SetWithCost(mainKey, subKey string, value interface{}, cost int64) (evicted bool) {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.set(mainKey, subKey, value, 0, false, cost)
+}
+
+// SetWithTTL adds a value that expires ttl after it is set, regardless of
+// reads (ttl <= 0 means it never expires on its own). Expired entries are
+// removed when they are next read or by the periodic sweep. Returns true if
+// an eviction occurred.
+func (c *MemoryCache) SetWithTTL(mainKey, subKey string, value interface{}, ttl time.Duration) (evicted bool) {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.set(mainKey, subKey, value, ttl, false, -1)
+}
+
+// SetWithSlidingTTL adds a value that expires once it has not been read for
+// ttl; every GetSub/Get pushes the expire time back. Returns true if an
+// eviction occurred.
+func (c *MemoryCache) SetWithSlidingTTL(mainKey, subKey string, value interface{}, ttl time.Duration) (evicted bool) {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.set(mainKey, subKey, value, ttl, true, -1)
 }
 
 // Get looks up a key's value from the cache.
 func (c *MemoryCache) Get(mainKey string) (value map[string]interface{}, ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	value, ok = lru.Get(mainKey)
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	value, ok = shard.lru.Get(mainKey)
+	shard.stats.recordGet(ok)
 	return value, ok
 }
 
 // GetSub looks up a key's value from the cache.
 func (c *MemoryCache) GetSub(mainKey string, subKey string) (value interface{}, ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	value, ok = lru.GetSub(mainKey, subKey)
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	value, ok = shard.lru.GetSub(mainKey, subKey)
+	shard.stats.recordGet(ok)
 	return value, ok
 }
 
-// GetSubOrSet looks up a key's value from the cache.will add it if no exist
+// GetSubOrSet looks up a key's value from the cache.will add it if no exist.
+// newValFunc is called without holding the shard lock; if another goroutine
+// added the key in the meantime, its value is kept and returned.
 func (c *MemoryCache) GetSubOrSet(mainKey string, subKey string, newValFunc func() interface{}) (value interface{}) {
+	shard := c.getShard(mainKey)
+
 	ok := false
-	lru := c._lruPool.GetLruModel(mainKey)
-	value, ok = lru.GetSub(mainKey, subKey)
-	if ok == false {
-		value = newValFunc()
-		lru.Set(mainKey, subKey, value)
+	shard.lock.Lock()
+	value, ok = shard.lru.GetSub(mainKey, subKey)
+	shard.unlock()
+	shard.stats.recordGet(ok)
+	if ok {
+		return value
+	}
+
+	newValue := newValFunc()
+	shard.stats.recordLoad(nil)
+
+	shard.lock.Lock()
+	defer shard.unlock()
+	if value, ok = shard.lru.Peek(mainKey, subKey); ok {
+		return value
 	}
+	shard.set(mainKey, subKey, newValue, 0, false, -1)
 
-	return value
+	return newValue
 }
 
 // Contains checks if a key is in the cache, without updating the
 // recent-ness or deleting it for being stale.
 func (c *MemoryCache) Contains(mainKey string) (ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	containKey := lru.Contains(mainKey)
-	return containKey
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.Contains(mainKey)
 }
 
 // Contains checks if a key is in the cache, without updating the
 // recent-ness or deleting it for being stale.
 func (c *MemoryCache) ContainsSub(mainKey, subKey string) (ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	containKey := lru.Contains(mainKey)
-	return containKey
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.ContainsSub(mainKey, subKey)
 }
 
 // Peek returns the key value (or undefined if not found) without updating
 // the "recently used"-ness of the key.
 func (c *MemoryCache) Peek(mainKey, subKey string) (value interface{}, ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	value, ok = lru.Peek(mainKey, subKey)
-	return value, ok
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.Peek(mainKey, subKey)
 }
 
 // ContainsOrAdd checks if a key is in the cache  without updating the
 // recent-ness or deleting it for being stale,  and if not, adds the value.
 // Returns whether found and whether an eviction occurred.
 func (c *MemoryCache) ContainsOrAdd(mainKey string, subKey string, value interface{}) (ok, evicted bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	if lru.ContainsSub(mainKey, subKey) {
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	if shard.lru.ContainsSub(mainKey, subKey) {
 		return true, false
 	}
 
-	evicted = lru.Set(mainKey, subKey, value)
+	evicted = shard.set(mainKey, subKey, value, 0, false, -1)
 	return false, evicted
 }
 
 // Remove removes the provided key from the cache.
 func (c *MemoryCache) Remove(mainKey string) (present bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	present = lru.Remove(mainKey)
-	return
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.Remove(mainKey)
 }
 
 // Remove removes the provided key from the cache.
 func (c *MemoryCache) RemoveSub(mainKey, subKey string) (present bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	present = lru.RemoveSub(mainKey, subKey)
-	return
+	shard := c.getShard(mainKey)
+	shard.lock.Lock()
+	defer shard.unlock()
+
+	return shard.lru.RemoveSub(mainKey, subKey)
 }
 
-// Resize changes the cache size.
+// Resize changes the size of every shard.
 func (c *MemoryCache) Resize(size int) {
-	c._lruPool.Resize(size)
+	c.lockAll()
+	defer c.unlockAll()
+
+	for _, shard := range c._shardList {
+		shard.lru.Resize(size)
+	}
 }
 
-// RemoveOldest removes the oldest item from the cache.
+// RemoveOldest removes the oldest item of the first non-empty shard.
 func (c *MemoryCache) RemoveOldest() (mainKey string, subKey string, value interface{}, ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	mainKey, subKey, value, ok = lru.RemoveOldest()
+	for _, shard := range c._shardList {
+		shard.lock.Lock()
+		mainKey, subKey, value, ok = shard.lru.RemoveOldest()
+		shard.unlock()
+		if ok {
+			return
+		}
+	}
+
 	return
 }
 
-// GetOldest returns the oldest entry
+// GetOldest returns the oldest entry of the first non-empty shard.
 func (c *MemoryCache) GetOldest() (mainKey string, subKey string, value interface{}, ok bool) {
-	lru := c._lruPool.GetLruModel(mainKey)
-	mainKey, subKey, value, ok = lru.GetOldest()
+	for _, shard := range c._shardList {
+		shard.lock.Lock()
+		mainKey, subKey, value, ok = shard.lru.GetOldest()
+		shard.unlock()
+		if ok {
+			return
+		}
+	}
+
 	return
 }
 
-// Keys returns a slice of the keys in the cache, from oldest to newest.
+// Keys returns a slice of the keys in the cache, from oldest to newest within
+// each shard. All shards are locked so the result is a consistent snapshot.
 func (c *MemoryCache) Keys() []*simplelru.Key {
-	keys := c._lruPool.Keys()
+	c.lockAll()
+	defer c.unlockAll()
+
+	var keys []*simplelru.Key
+	for _, shard := range c._shardList {
+		keys = append(keys, shard.lru.Keys()...)
+	}
+
 	return keys
 }
 
 // Len returns the number of items in the cache.
 func (c *MemoryCache) Len() int {
-	length := c._lruPool.Len()
+	c.lockAll()
+	defer c.unlockAll()
+
+	length := 0
+	for _, shard := range c._shardList {
+		length += shard.lru.Len()
+	}
+
 	return length
 }
 
+// GetStats returns the counters of the whole cache
+func (c *MemoryCache) GetStats() *CacheStats {
+	result := &CacheStats{}
+	for _, shard := range c._shardList {
+		result.add(shard.stats.snapshot())
+	}
+
+	return result
+}
+
+// GetShardStats returns the counters of every shard, which shows whether the
+// keys are spread evenly
+func (c *MemoryCache) GetShardStats() []*CacheStats {
+	result := make([]*CacheStats, 0, len(c._shardList))
+	for _, shard := range c._shardList {
+		result = append(result, shard.stats.snapshot())
+	}
+
+	return result
+}
+
+// ResetStats sets every counter to 0
+func (c *MemoryCache) ResetStats() {
+	for _, shard := range c._shardList {
+		shard.stats.reset()
+	}
+}
+
+// Cost returns the total cost of the items in the cache, 0 unless the cache
+// has a MaxCost or a Sizer.
+func (c *MemoryCache) Cost() int64 {
+	c.lockAll()
+	defer c.unlockAll()
+
+	cost := int64(0)
+	for _, shard := range c._shardList {
+		cost += shard.cost
+	}
+
+	return cost
+}
+
 func (c *MemoryCache) removeExpired() {
 	for {
 		time.Sleep(time.Duration(c._expireSeconds) * time.Second)
-		c._lruPool.RemoveExpired(c._expireSeconds)
+		for _, shard := range c._shardList {
+			shard.lock.Lock()
+			shard.lru.RemoveExpired(c._expireSeconds)
+			shard.unlock()
+		}
+	}
+}
+
+// getShard returns the shard that owns mainKey (FNV-1a hash).
+func (c *MemoryCache) getShard(mainKey string) *memoryShard {
+	if len(c._shardList) == 1 {
+		return c._shardList[0]
+	}
+
+	hash := uint32(2166136261)
+	for i := 0; i < len(mainKey); i++ {
+		hash ^= uint32(mainKey[i])
+		hash *= 16777619
+	}
+
+	return c._shardList[hash%uint32(len(c._shardList))]
+}
+
+// lockAll locks every shard, always in the same order to avoid deadlocks.
+func (c *MemoryCache) lockAll() {
+	for _, shard := range c._shardList {
+		shard.lock.Lock()
+	}
+}
+
+// unlockAll releases every shard lock and then fires the pending eviction
+// callbacks of all shards.
+func (c *MemoryCache) unlockAll() {
+	var evictedList []*evictedItem
+	for _, shard := range c._shardList {
+		evictedList = append(evictedList, shard.evictedList...)
+		shard.evictedList = nil
+		shard.lock.Unlock()
+	}
+
+	for _, item := range evictedList {
+		c._onEvicted(item.mainKey, item.subKey, item.value, item.reason)
 	}
 }
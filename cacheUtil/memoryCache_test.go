@@ -2,10 +2,15 @@ package cacheUtil
 
 import (
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"fmt"
 	"time"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
 )
 
 func BenchmarkLRU_Rand(b *testing.B) {
@@ -289,3 +294,395 @@ func TestExpire(t *testing.T) {
 	}
 	println(waitSecond)
 }
+
+// benchmarkCache is the part of MemoryCache exercised by the parallel benchmarks
+type benchmarkCache interface {
+	Set(mainKey, subKey string, value interface{}) bool
+	GetSub(mainKey, subKey string) (interface{}, bool)
+}
+
+// globalLockCache reproduces the previous MemoryCache design for comparison:
+// a single RWMutex guards every LruPool shard, and each LRU takes its own lock as well.
+type globalLockCache struct {
+	lock    sync.RWMutex
+	lruPool *simplelru.LruPool
+}
+
+func (c *globalLockCache) Set(mainKey, subKey string, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lruPool.GetLruModel(mainKey).Set(mainKey, subKey, value)
+}
+
+func (c *globalLockCache) GetSub(mainKey, subKey string) (interface{}, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.lruPool.GetLruModel(mainKey).GetSub(mainKey, subKey)
+}
+
+func benchmarkMemoryCacheParallel(b *testing.B, shardCount int) {
+	l, err := NewMemoryCache(shardCount, 32768/shardCount, 0)
+	if err != nil {
+		b.Fatalf("err: %v", err)
+	}
+
+	benchmarkCacheParallel(b, l)
+}
+
+func benchmarkGlobalLockParallel(b *testing.B, shardCount int) {
+	lruPool, err := simplelru.NewLruPool(shardCount, 32768/shardCount, nil)
+	if err != nil {
+		b.Fatalf("err: %v", err)
+	}
+
+	benchmarkCacheParallel(b, &globalLockCache{lruPool: lruPool})
+}
+
+func benchmarkCacheParallel(b *testing.B, l benchmarkCache) {
+	keyList := make([]string, 16384)
+	for i := range keyList {
+		keyList[i] = toString(i)
+		l.Set(keyList[i], "", i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			key := keyList[r.Intn(len(keyList))]
+			if r.Intn(4) == 0 {
+				l.Set(key, "", key)
+			} else {
+				l.GetSub(key, "")
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryCache_Parallel1(b *testing.B) {
+	benchmarkMemoryCacheParallel(b, 1)
+}
+
+func BenchmarkMemoryCache_Parallel16(b *testing.B) {
+	benchmarkMemoryCacheParallel(b, 16)
+}
+
+func BenchmarkMemoryCache_Parallel64(b *testing.B) {
+	benchmarkMemoryCacheParallel(b, 64)
+}
+
+func BenchmarkMemoryCache_GlobalLockParallel16(b *testing.B) {
+	benchmarkGlobalLockParallel(b, 16)
+}
+
+func BenchmarkMemoryCache_GlobalLockParallel64(b *testing.B) {
+	benchmarkGlobalLockParallel(b, 64)
+}
+
+// test that eviction callbacks may use the cache without deadlocking
+func TestEvictCallbackReentrant(t *testing.T) {
+	var l *MemoryCache
+	evictCounter := 0
+	onEvicted := func(mainKey, subKey string, v interface{}) {
+		evictCounter++
+		l.ContainsSub(mainKey, subKey)
+		l.Len()
+	}
+
+	l, err := NewMemoryCacheWithEvict(4, 1, 0, onEvicted)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for i := 0; i < 16; i++ {
+		l.Set(toString(i), "", i)
+	}
+	l.Purge()
+	if l.Len() != 0 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+	if evictCounter != 16 {
+		t.Fatalf("bad evict count: %v", evictCounter)
+	}
+}
+
+// test that per-entry ttl expires lazily and sliding ttl is refreshed by reads
+func TestLRUTTL(t *testing.T) {
+	l, err := NewMemoryCache(4, 16, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	l.SetWithTTL("session", "1", 1, 100*time.Millisecond)
+	l.SetWithSlidingTTL("config", "1", 2, 100*time.Millisecond)
+	l.Set("forever", "1", 3)
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(40 * time.Millisecond)
+		if _, ok := l.GetSub("config", "1"); !ok {
+			t.Fatalf("sliding entry should be refreshed by reads")
+		}
+	}
+
+	if _, ok := l.Peek("session", "1"); ok {
+		t.Fatalf("session should be expired")
+	}
+	if l.Len() != 3 {
+		t.Fatalf("expired entry should only be removed on read: %v", l.Len())
+	}
+	if _, ok := l.GetSub("session", "1"); ok {
+		t.Fatalf("session should be expired")
+	}
+	if l.Len() != 2 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if l.ContainsSub("config", "1") {
+		t.Fatalf("config should be expired")
+	}
+	if _, ok := l.GetSub("forever", "1"); !ok {
+		t.Fatalf("entry without ttl should not expire")
+	}
+}
+
+// test that stats and evict reasons are reported
+func TestStats(t *testing.T) {
+	reasonCount := make(map[simplelru.EvictReason]int)
+	onEvicted := func(mainKey, subKey string, v interface{}, reason simplelru.EvictReason) {
+		reasonCount[reason]++
+	}
+	l, err := NewMemoryCacheWithEvictReason(1, 4, 0, onEvicted)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	l.SetWithTTL("ttl", "", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	l.GetSub("ttl", "")
+	for i := 0; i < 6; i++ {
+		l.Set(toString(i), "", i)
+	}
+	l.GetSub("missing", "")
+	l.GetSubOrSet("load", "", func() interface{} { return 1 })
+	keys := l.Keys()
+	for _, k := range keys {
+		l.GetSub(k.MainKey, k.SubKey)
+	}
+	l.RemoveSub(keys[0].MainKey, keys[0].SubKey)
+	l.Purge()
+
+	stats := l.GetStats()
+	if stats.Hits != 4 || stats.Misses != 3 || stats.Loads != 1 || stats.Expirations != 1 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+	if stats.Evictions != int64(reasonCount[simplelru.Evict_Capacity]) || stats.Evictions == 0 {
+		t.Fatalf("bad evictions: %+v %v", stats, reasonCount)
+	}
+	if reasonCount[simplelru.Evict_Expired] != 1 || reasonCount[simplelru.Evict_Removed] != 1 || reasonCount[simplelru.Evict_Purged] != 3 {
+		t.Fatalf("bad evict reasons: %v", reasonCount)
+	}
+
+	shardHits := int64(0)
+	for _, item := range l.GetShardStats() {
+		shardHits += item.Hits
+	}
+	if shardHits != stats.Hits {
+		t.Fatalf("bad shard stats")
+	}
+}
+
+// test that the policy can be chosen at construction
+func TestMemoryCachePolicy(t *testing.T) {
+	l, err := NewMemoryCache2(&MemoryCacheOption{
+		Policy:     simplelru.Policy_TinyLFU,
+		ShardCount: 4,
+		ShardSize:  32,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for i := 0; i < 256; i++ {
+		l.Set(toString(i), "", i)
+	}
+	if l.Len() > 4*32 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+	for _, k := range l.Keys() {
+		if v, ok := l.GetSub(k.MainKey, k.SubKey); !ok || toString(v) != k.MainKey {
+			t.Fatalf("bad key: %v", k)
+		}
+	}
+
+	if _, err = NewMemoryCache2(&MemoryCacheOption{Policy: simplelru.Policy(100), ShardCount: 1, ShardSize: 1}); err == nil {
+		t.Fatalf("unknown policy should fail")
+	}
+}
+
+// test that the total cost is kept within MaxCost
+func TestMemoryCacheCost(t *testing.T) {
+	evictCounter := 0
+	l, err := NewMemoryCache2(&MemoryCacheOption{
+		ShardCount: 2,
+		ShardSize:  1000,
+		MaxCost:    200,
+		Sizer: func(mainKey, subKey string, value interface{}) int64 {
+			return int64(len(value.(string)))
+		},
+		OnEvicted: func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason) {
+			if reason == simplelru.Evict_Capacity {
+				evictCounter++
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		l.Set(toString(i), "", "0123456789")
+		if l.Cost() > 200 {
+			t.Fatalf("bad cost: %v", l.Cost())
+		}
+	}
+	if l.Cost() != int64(l.Len())*10 || evictCounter != 100-l.Len() {
+		t.Fatalf("bad cost: %v len: %v evict: %v", l.Cost(), l.Len(), evictCounter)
+	}
+
+	// replacing a value updates the cost
+	key := l.Keys()[0]
+	l.SetWithCost(key.MainKey, key.SubKey, "0", 1)
+	if l.Cost() != int64(l.Len()-1)*10+1 {
+		t.Fatalf("bad cost after replace: %v", l.Cost())
+	}
+
+	// an entry over the budget of its shard is not admitted
+	l.SetWithCost("big", "", "0", 101)
+	if l.ContainsSub("big", "") {
+		t.Fatalf("big entry should not be admitted")
+	}
+	if l.Cost() > 200 {
+		t.Fatalf("bad cost: %v", l.Cost())
+	}
+
+	l.Purge()
+	if l.Cost() != 0 {
+		t.Fatalf("bad cost after purge: %v", l.Cost())
+	}
+}
+
+func TestMemoryCacheSaveLoad(t *testing.T) {
+	l, err := NewMemoryCache2(&MemoryCacheOption{
+		ShardCount: 1,
+		ShardSize:  10,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	l.Set("a", "1", "a1")
+	l.SetWithTTL("a", "2", "a2", time.Hour)
+	l.SetWithSlidingTTL("b", "1", "b1", time.Hour)
+	l.SetWithTTL("expired", "", "x", 20*time.Millisecond)
+	l.Set("c", "", "c")
+	time.Sleep(50 * time.Millisecond)
+
+	filePath := filepath.Join(os.TempDir(), fmt.Sprintf("memoryCache_%d.snapshot", time.Now().UnixNano()))
+	defer os.Remove(filePath)
+	if err = l.Save(filePath, JsonCodec{}); err != nil {
+		t.Fatalf("save err: %v", err)
+	}
+
+	l2, err := NewMemoryCache2(&MemoryCacheOption{
+		ShardCount: 1,
+		ShardSize:  10,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	count, err := l2.Load(filePath, JsonCodec{}, func(mainKey, subKey string) interface{} {
+		return new(string)
+	})
+	if err != nil {
+		t.Fatalf("load err: %v", err)
+	}
+	if count != 4 || l2.Len() != 4 {
+		t.Fatalf("bad count: %v len: %v", count, l2.Len())
+	}
+	if l2.ContainsSub("expired", "") {
+		t.Fatalf("expired entry should not be loaded")
+	}
+
+	// order and expire times are kept
+	expected := l._shardList[0].lru.Entries()
+	actual := l2._shardList[0].lru.Entries()
+	for i, item := range actual {
+		if item.MainKey != expected[i].MainKey || item.SubKey != expected[i].SubKey ||
+			*item.Value.(*string) != expected[i].Value.(string) ||
+			item.ExpireTime != expected[i].ExpireTime || item.SlidingTTL != expected[i].SlidingTTL {
+			t.Fatalf("bad entry %d: %+v expected: %+v", i, item, expected[i])
+		}
+	}
+}
+
+func TestMemoryCacheSubKeys(t *testing.T) {
+	for _, policy := range []simplelru.Policy{simplelru.Policy_LRU, simplelru.Policy_LFU} {
+		l, err := NewMemoryCache2(&MemoryCacheOption{
+			Policy:     policy,
+			ShardCount: 4,
+			ShardSize:  100,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		items := make(map[simplelru.Key]interface{})
+		for i := 0; i < 5; i++ {
+			items[simplelru.Key{MainKey: "player.1", SubKey: toString(i)}] = i
+			items[simplelru.Key{MainKey: "player.2", SubKey: toString(i)}] = i
+			items[simplelru.Key{MainKey: "guild.1", SubKey: toString(i)}] = i
+		}
+		l.SetMulti(items)
+
+		if count := l.CountSub("player.1"); count != 5 {
+			t.Fatalf("%v bad count: %v", policy, count)
+		}
+		sum := 0
+		l.RangeSub("player.1", func(subKey string, value interface{}) bool {
+			// the cache may be used in fn
+			l.Peek("player.1", subKey)
+			sum += value.(int)
+			return true
+		})
+		if sum != 10 || len(l.SubKeys("player.1")) != 5 {
+			t.Fatalf("%v bad sum: %v", policy, sum)
+		}
+
+		result := l.GetMulti([]*simplelru.Key{
+			{MainKey: "player.1", SubKey: "1"},
+			{MainKey: "guild.1", SubKey: "2"},
+			{MainKey: "none", SubKey: "1"},
+		})
+		if len(result) != 2 || result[simplelru.Key{MainKey: "guild.1", SubKey: "2"}] != 2 {
+			t.Fatalf("%v bad result: %v", policy, result)
+		}
+
+		if count := l.ExpireSub("guild.1", 20*time.Millisecond); count != 5 {
+			t.Fatalf("%v bad expire count: %v", policy, count)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if l.CountSub("guild.1") != 0 || l.Contains("guild.1") {
+			t.Fatalf("%v sub-keys should be expired", policy)
+		}
+
+		if count := l.RemovePrefix("player."); count != 10 {
+			t.Fatalf("%v bad remove count: %v", policy, count)
+		}
+		if l.Contains("player.1") || l.Contains("player.2") {
+			t.Fatalf("%v prefix should be removed", policy)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package cacheUtil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
+)
+
+// evictedItem is an entry removed from a shard while its lock was held.
+type evictedItem struct {
+	mainKey string
+	subKey  string
+	value   interface{}
+	reason  simplelru.EvictReason
+}
+
+// memoryShard is one partition of a MemoryCache. Every operation on the
+// underlying LRU is done while holding the shard's own lock, so operations
+// on different shards never contend with each other. The LRU is created
+// unsynchronized and takes no lock of its own.
+type memoryShard struct {
+	// stats is the first field so its int64 counters are 64-bit aligned
+	stats cacheStats
+
+	lock sync.Mutex
+	lru  simplelru.LRUCache
+
+	// evicted entries are collected while the lock is held and passed to
+	// onEvicted after it is released, so the callback may use the cache.
+	evictedList []*evictedItem
+	onEvicted   func(mainKey, subKey string, value interface{}, reason simplelru.EvictReason)
+
+	// cost of every entry, nil unless the cache has a MaxCost or a Sizer
+	costMap map[simplelru.Key]int64
+	cost    int64
+	maxCost int64
+	sizer   func(mainKey, subKey string, value interface{}) int64
+
+	// isEvictingForCost makes entries removed by evictForCost count as
+	// capacity evictions
+	isEvictingForCost bool
+}
+
+// newMemoryShard constructs a shard holding at most option.ShardSize entries
+// whose total cost is at most maxCost (<= 0 means unlimited).
+func newMemoryShard(option *MemoryCacheOption, maxCost int64) (*memoryShard, error) {
+	shard := &memoryShard{
+		onEvicted: option.OnEvicted,
+		maxCost:   maxCost,
+		sizer:     option.Sizer,
+	}
+	if maxCost > 0 || option.Sizer != nil {
+		shard.costMap = make(map[simplelru.Key]int64)
+	}
+
+	lru, err := simplelru.NewUnsynchronizedCache(option.Policy, option.ShardSize, shard.collectEvicted)
+	if err != nil {
+		return nil, err
+	}
+	shard.lru = lru
+
+	return shard, nil
+}
+
+// collectEvicted is the LRU eviction callback; it is always called with the
+// shard lock held.
+func (s *memoryShard) collectEvicted(mainKey, subKey string, value interface{}, reason simplelru.EvictReason) {
+	if s.isEvictingForCost {
+		reason = simplelru.Evict_Capacity
+	}
+	if s.costMap != nil {
+		key := simplelru.Key{MainKey: mainKey, SubKey: subKey}
+		s.cost -= s.costMap[key]
+		delete(s.costMap, key)
+	}
+
+	s.stats.recordEvict(reason)
+	if s.onEvicted == nil {
+		return
+	}
+
+	s.evictedList = append(s.evictedList, &evictedItem{
+		mainKey: mainKey,
+		subKey:  subKey,
+		value:   value,
+		reason:  reason,
+	})
+}
+
+// set adds a value with the shard lock held. cost < 0 means it is computed by
+// the sizer (0 without a sizer). An entry costing more than the budget is not
+// admitted and its old value is removed. Returns true if an eviction occurred.
+func (s *memoryShard) set(mainKey, subKey string, value interface{}, ttl time.Duration, isSliding bool, cost int64) (evicted bool) {
+	if s.costMap == nil {
+		return s.lru.SetWithTTL(mainKey, subKey, value, ttl, isSliding)
+	}
+
+	cost, isAdmitted := s.admit(mainKey, subKey, value, cost)
+	if isAdmitted == false {
+		return false
+	}
+
+	evicted = s.lru.SetWithTTL(mainKey, subKey, value, ttl, isSliding)
+	if s.evictForCost() {
+		evicted = true
+	}
+
+	return
+}
+
+// restore adds an entry from a snapshot as the newest one with the shard lock
+// held, cost is handled as in set. Returns true if an eviction occurred.
+func (s *memoryShard) restore(snapshot *simplelru.Entry, cost int64) (evicted bool) {
+	if s.costMap == nil {
+		return s.lru.Restore(snapshot)
+	}
+
+	if _, isAdmitted := s.admit(snapshot.MainKey, snapshot.SubKey, snapshot.Value, cost); isAdmitted == false {
+		return false
+	}
+
+	evicted = s.lru.Restore(snapshot)
+	if s.evictForCost() {
+		evicted = true
+	}
+
+	return
+}
+
+// admit computes the cost of a value and records it before the value is
+// added, since the entry may be evicted while it is added. An entry costing
+// more than the budget is not admitted and its old value is removed.
+func (s *memoryShard) admit(mainKey, subKey string, value interface{}, cost int64) (int64, bool) {
+	if cost < 0 {
+		cost = 0
+		if s.sizer != nil {
+			cost = s.sizer(mainKey, subKey, value)
+		}
+	}
+	if s.maxCost > 0 && cost > s.maxCost {
+		s.isEvictingForCost = true
+		s.lru.RemoveSub(mainKey, subKey)
+		s.isEvictingForCost = false
+		return cost, false
+	}
+
+	key := simplelru.Key{MainKey: mainKey, SubKey: subKey}
+	s.cost += cost - s.costMap[key]
+	s.costMap[key] = cost
+
+	return cost, true
+}
+
+// evictForCost evicts the oldest entries until the cost is within budget
+func (s *memoryShard) evictForCost() (evicted bool) {
+	if s.maxCost <= 0 {
+		return false
+	}
+
+	s.isEvictingForCost = true
+	defer func() {
+		s.isEvictingForCost = false
+	}()
+
+	for s.cost > s.maxCost {
+		if _, _, _, ok := s.lru.RemoveOldest(); ok == false {
+			break
+		}
+		evicted = true
+	}
+
+	return
+}
+
+// unlock releases the shard lock and then fires the pending eviction callbacks.
+func (s *memoryShard) unlock() {
+	evictedList := s.evictedList
+	s.evictedList = nil
+	s.lock.Unlock()
+
+	for _, item := range evictedList {
+		s.onEvicted(item.mainKey, item.subKey, item.value, item.reason)
+	}
+}
@@ -0,0 +1,175 @@
+package cacheUtil
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
+)
+
+// version of the snapshot file format
+const con_SNAPSHOT_VERSION = 1
+
+// snapshotHeader is the first record of a snapshot file
+type snapshotHeader struct {
+	Version  int
+	SaveTime int64
+}
+
+// snapshotRecord is one entry of a snapshot file
+type snapshotRecord struct {
+	MainKey string
+	SubKey  string
+
+	// ExpireTime is the unix nano time the entry expires at, 0 means never
+	ExpireTime int64
+	SlidingTTL time.Duration
+
+	// Cost is the cost of the entry, < 0 if the cache did not track costs
+	Cost int64
+
+	Value []byte
+}
+
+// Save writes every live entry with its expire time to filePath, shard by
+// shard and from oldest to newest, so Load restores the same eviction order.
+// Values are marshaled with marshalObj. The file is written to filePath+".tmp"
+// first and renamed, so a failed Save never leaves a broken snapshot.
+// Negative and failed results of a Loader are not saved.
+func (c *MemoryCache) Save(filePath string, marshalObj Marshaler) (err error) {
+	var entryList []*simplelru.Entry
+	var costList []int64
+
+	c.lockAll()
+	for _, shard := range c._shardList {
+		for _, item := range shard.lru.Entries() {
+			cost := int64(-1)
+			if shard.costMap != nil {
+				cost = shard.costMap[simplelru.Key{MainKey: item.MainKey, SubKey: item.SubKey}]
+			}
+
+			entryList = append(entryList, item)
+			costList = append(costList, cost)
+		}
+	}
+	c.unlockAll()
+
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	err = encoder.Encode(&snapshotHeader{
+		Version:  con_SNAPSHOT_VERSION,
+		SaveTime: time.Now().UnixNano(),
+	})
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	for index, item := range entryList {
+		value := item.Value
+		if loaded, isLoaded := value.(*loadedValue); isLoaded {
+			if loaded.exists == false || loaded.err != nil {
+				continue
+			}
+			value = loaded.value
+		}
+
+		var bytesData []byte
+		if bytesData, err = marshalObj.Marshal(value); err != nil {
+			file.Close()
+			return fmt.Errorf("marshal %s.%s error: %s", item.MainKey, item.SubKey, err)
+		}
+
+		err = encoder.Encode(&snapshotRecord{
+			MainKey:    item.MainKey,
+			SubKey:     item.SubKey,
+			ExpireTime: item.ExpireTime,
+			SlidingTTL: item.SlidingTTL,
+			Cost:       costList[index],
+			Value:      bytesData,
+		})
+		if err != nil {
+			file.Close()
+			return
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// Load restores the entries saved by Save into the cache, skipping those that
+// expired in the meantime. newValueFunc returns the value to unmarshal each
+// entry into. Entries keep their expire time and are added from oldest to
+// newest, so entries saved as recently used stay the last to be evicted.
+// Returns the number of entries restored.
+func (c *MemoryCache) Load(filePath string, unmarshalObj Unmarshaler, newValueFunc func(mainKey, subKey string) interface{}) (count int, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	header := new(snapshotHeader)
+	if err = decoder.Decode(header); err != nil {
+		return
+	}
+	if header.Version != con_SNAPSHOT_VERSION {
+		return 0, fmt.Errorf("unknown snapshot version %d", header.Version)
+	}
+
+	for {
+		record := new(snapshotRecord)
+		if err = decoder.Decode(record); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		if record.ExpireTime > 0 && record.ExpireTime <= time.Now().UnixNano() {
+			continue
+		}
+
+		value := newValueFunc(record.MainKey, record.SubKey)
+		if err = unmarshalObj.Unmarshal(record.Value, value); err != nil {
+			return count, fmt.Errorf("unmarshal %s.%s error: %s", record.MainKey, record.SubKey, err)
+		}
+
+		shard := c.getShard(record.MainKey)
+		shard.lock.Lock()
+		shard.restore(&simplelru.Entry{
+			MainKey:    record.MainKey,
+			SubKey:     record.SubKey,
+			Value:      value,
+			ExpireTime: record.ExpireTime,
+			SlidingTTL: record.SlidingTTL,
+		}, record.Cost)
+		shard.unlock()
+
+		count++
+	}
+}
@@ -3,6 +3,7 @@ package cacheUtil
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/polariseye/goutil/redisUtil"
 	"github.com/polariseye/goutil/syncUtil"
@@ -19,7 +20,18 @@ type RedisCache struct {
 
 	doGroup *syncUtil.Group
 
+	// loader is nil unless SetLoader was called
+	loader       Loader
+	loaderOption *LoaderOption
+	loaderLock   sync.RWMutex
+
 	defaultRedisExpireSeconds int
+
+	stats cacheStats
+
+	// invalidationBus is nil unless EnableInvalidation was called
+	invalidationBus  *invalidationBus
+	invalidationLock sync.RWMutex
 }
 
 // Set add value to memory and redis
@@ -40,6 +52,7 @@ func (r *RedisCache) SetExpire(mainKey, subKey string, value interface{}, expire
 	}
 
 	r.memoryCache.Set(mainKey, subKey, value)
+	r.publishInvalidation(mainKey, subKey)
 
 	return
 }
@@ -67,10 +80,20 @@ func (r *RedisCache) setToRedis(mainKey, subKey string, value interface{}, expir
 // Get get from memory and redis.
 // it will save to memory cache when get from redis
 // it will set a nil to memory when not exist in redis
+// in read-through mode (see SetLoader) it will load the value when not exist in redis
 func (r *RedisCache) Get(mainKey string, subKey string, newValueFunc func() interface{}) (actualValue interface{}, ok bool, err error) {
+	if loader, option := r.getLoader(); loader != nil {
+		return r.getOrLoad(mainKey, subKey, newValueFunc, loader, option)
+	}
+
 	if actualValue, ok = r.memoryCache.GetSub(mainKey, subKey); ok {
+		r.stats.recordGet(true)
+		if item, isLoaded := actualValue.(*loadedValue); isLoaded {
+			actualValue, ok, err = item.value, item.exists, item.err
+		}
 		return
 	}
+	r.stats.recordGet(false)
 
 	actualValue, ok, err = r.GetFromRedis(mainKey, subKey, newValueFunc)
 	if err != nil {
@@ -113,8 +136,10 @@ func (r *RedisCache) getFromRedis(mainKey string, subKey string, newValueFunc fu
 	var bytesData []byte
 	bytesData, ok, err = r.redisPool.GetBytes(key)
 	if err != nil {
+		r.stats.recordLoad(err)
 		return
 	} else if ok == false {
+		r.stats.recordLoad(nil)
 		r.memoryCache.Set(mainKey, subKey, nil)
 		return
 	}
@@ -124,6 +149,7 @@ func (r *RedisCache) getFromRedis(mainKey string, subKey string, newValueFunc fu
 	if err != nil {
 		actualValue = nil
 	}
+	r.stats.recordLoad(err)
 	return
 }
 
@@ -134,11 +160,9 @@ func (r *RedisCache) ContainsSubInMemory(mainKey, subKey string) (ok bool) {
 	if ok == false {
 		return ok
 	}
-	if val == nil {
-		return false
-	}
 
-	return true
+	_, ok = unwrapMemoryValue(val)
+	return ok
 }
 
 // ContainsInRedis check if val in redis
@@ -175,9 +199,28 @@ func (r *RedisCache) Remove(mainKey string, subKey string) (err error) {
 	}
 
 	r.memoryCache.RemoveSub(mainKey, subKey)
+	r.publishInvalidation(mainKey, subKey)
 	return
 }
 
+// GetStats returns the counters of the cache. Hits and misses are counted on
+// the memory cache by Get, loads are reads from redis, and evictions and
+// expirations are those of the memory cache.
+func (r *RedisCache) GetStats() *CacheStats {
+	result := r.stats.snapshot()
+	memoryStats := r.memoryCache.GetStats()
+	result.Evictions = memoryStats.Evictions
+	result.Expirations = memoryStats.Expirations
+
+	return result
+}
+
+// ResetStats sets every counter to 0, including those of the memory cache
+func (r *RedisCache) ResetStats() {
+	r.stats.reset()
+	r.memoryCache.ResetStats()
+}
+
 // ConvertToRedisKey convert to redis key
 func (r *RedisCache) ConvertToRedisKey(mainKey string, subKey string) string {
 	return fmt.Sprintf("%s.%s", mainKey, subKey)
@@ -185,24 +228,35 @@ func (r *RedisCache) ConvertToRedisKey(mainKey string, subKey string) string {
 
 // ConvertFromRedisKey convert from redis key
 func (r *RedisCache) ConvertFromRedisKey(key string) (mainKey string, subKey string, err error) {
-	valList := strings.Split(key, ".")
-	if len(valList) < 2 {
+	index := strings.Index(key, ".")
+	if index < 0 {
 		err = fmt.Errorf("error rediskey format")
 		return
 	}
 
-	mainKey = valList[0]
-	subKey = key[len(mainKey):]
+	mainKey = key[:index]
+	subKey = key[index+1:]
 	return
 }
 
 // NewRedisCache create and initialize RedisCache
+// marshalObj/unmarshalObj default to basic types as text and JsonCodec for the others when nil
 func NewRedisCache(memoryPoolNum int, memoryCachePerElementCount int, memoryExpireSeconds int,
 	redisPool *redisUtil.RedisPool, redisExpireSeconds int,
 	marshalObj Marshaler,
 	unmarshalObj Unmarshaler) (cacheContainer *RedisCache, err error) {
 	var memoryCache *MemoryCache
 	memoryCache, err = NewMemoryCache(memoryPoolNum, memoryCachePerElementCount, memoryExpireSeconds)
+	if err != nil {
+		return
+	}
+	if marshalObj == nil {
+		marshalObj = NewMarshal(JsonCodec{})
+	}
+	if unmarshalObj == nil {
+		unmarshalObj = NewUnmarhsal(JsonCodec{})
+	}
+
 	return &RedisCache{
 		redisPool:                 redisPool,
 		memoryCache:               memoryCache,
@@ -1,9 +1,11 @@
 package cacheUtil
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/polariseye/goutil/cacheUtil/simplelru"
 	"github.com/polariseye/goutil/redisUtil"
 )
 
@@ -119,3 +121,168 @@ func TestRemove(t *testing.T) {
 		t.Fatal("data should not exist")
 	}
 }
+
+func TestInvalidation(t *testing.T) {
+	redisPoolObj := redisUtil.NewRedisPool2("tst", &redisUtil.RedisConfig{
+		ConnectionString:   "127.0.0.1:6379",
+		Database:           0,
+		MaxActive:          10,
+		MaxIdle:            1,
+		IdleTimeout:        60 * time.Second,
+		DialConnectTimeout: 2 * time.Second,
+	})
+	defer redisPoolObj.Close()
+	if err := redisPoolObj.TestConnection(); err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj1, err := NewRedisCache(2, 10, 0, redisPoolObj, 100, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj2, err := NewRedisCache(2, 10, 0, redisPoolObj, 100, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	for _, cacheObj := range []*RedisCache{cacheObj1, cacheObj2} {
+		if err = cacheObj.EnableInvalidation("cacheUtil.test.invalidation"); err != nil {
+			t.Fatal(err.Error())
+			return
+		}
+		defer cacheObj.DisableInvalidation()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cacheObj2.memoryCache.Set("1", "", &TVal{1})
+	err = cacheObj1.Set("1", "", &TVal{2})
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if cacheObj2.ContainsSubInMemory("1", "") {
+		t.Fatal("stale data should be removed")
+	}
+	if cacheObj1.ContainsSubInMemory("1", "") == false {
+		t.Fatal("own data should not be removed")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	redisPoolObj := redisUtil.NewRedisPool2("tst", &redisUtil.RedisConfig{
+		ConnectionString:   "127.0.0.1:6379",
+		Database:           0,
+		MaxActive:          10,
+		MaxIdle:            1,
+		IdleTimeout:        60 * time.Second,
+		DialConnectTimeout: 2 * time.Second,
+	})
+	defer redisPoolObj.Close()
+	if err := redisPoolObj.TestConnection(); err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj, err := NewRedisCache(2, 10, 10, redisPoolObj, 100, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj.Remove("loader", "")
+	cacheObj.Remove("loader", "none")
+
+	// a miss before SetLoader leaves a nil placeholder in memory, which must not hide the loader
+	if _, ok, err := cacheObj.Get("loader", "", func() interface{} { return &TVal{} }); err != nil || ok {
+		t.Fatalf("data should not exist:%v %v", ok, err)
+	}
+
+	loadCount := 0
+	cacheObj.SetLoader(func(mainKey, subKey string) (interface{}, bool, error) {
+		loadCount++
+		if subKey == "none" {
+			return nil, false, nil
+		}
+
+		return &TVal{3}, true, nil
+	}, &LoaderOption{NegativeTTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		tmpVal, ok, err := cacheObj.Get("loader", "", func() interface{} { return &TVal{} })
+		if err != nil {
+			t.Fatal(err.Error())
+		} else if ok == false || tmpVal.(*TVal).Val != 3 {
+			t.Fatal("data no correct")
+		}
+
+		if _, ok, err = cacheObj.Get("loader", "none", func() interface{} { return &TVal{} }); err != nil {
+			t.Fatal(err.Error())
+		} else if ok {
+			t.Fatal("data should not exist")
+		}
+	}
+	if loadCount != 2 {
+		t.Fatalf("loader should be called once per key:%v", loadCount)
+	}
+	if exist, err := cacheObj.ContainsInRedis("loader", ""); err != nil || exist == false {
+		t.Fatal("loaded data should be saved to redis")
+	}
+}
+
+func TestMultiAndPrefix(t *testing.T) {
+	redisPoolObj := redisUtil.NewRedisPool2("tst", &redisUtil.RedisConfig{
+		ConnectionString:   "127.0.0.1:6379",
+		Database:           0,
+		MaxActive:          10,
+		MaxIdle:            1,
+		IdleTimeout:        60 * time.Second,
+		DialConnectTimeout: 2 * time.Second,
+	})
+	defer redisPoolObj.Close()
+	if err := redisPoolObj.TestConnection(); err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj, err := NewRedisCache(2, 10, 0, redisPoolObj, 100, nil, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+
+	items := make(map[simplelru.Key]interface{})
+	for i := 0; i < 3; i++ {
+		items[simplelru.Key{MainKey: "multi1", SubKey: fmt.Sprint(i)}] = &TVal{i}
+		items[simplelru.Key{MainKey: "multi2", SubKey: fmt.Sprint(i)}] = &TVal{i}
+	}
+	if err = cacheObj.SetMulti(items); err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	cacheObj.RemoveFromMemory("multi1")
+
+	keyList := []*simplelru.Key{{MainKey: "multi1", SubKey: "1"}, {MainKey: "multi2", SubKey: "2"}, {MainKey: "multi3", SubKey: "1"}}
+	result, err := cacheObj.GetMulti(keyList, func(mainKey, subKey string) interface{} {
+		return &TVal{}
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+		return
+	}
+	if len(result) != 2 || result[*keyList[0]].(*TVal).Val != 1 || result[*keyList[1]].(*TVal).Val != 2 {
+		t.Fatalf("bad result: %v", result)
+	}
+
+	subKeyList, err := cacheObj.SubKeys("multi1")
+	if err != nil || len(subKeyList) != 3 {
+		t.Fatalf("bad sub keys: %v %v", subKeyList, err)
+	}
+
+	count, err := cacheObj.RemovePrefix("multi")
+	if err != nil || count != 6 {
+		t.Fatalf("bad remove count: %v %v", count, err)
+	}
+	if ok, _ := cacheObj.Contains("multi2", "1"); ok {
+		t.Fatal("prefix should be removed")
+	}
+}
@@ -0,0 +1,237 @@
+package simplelru
+
+import "container/list"
+
+// arcNode is a resident entry of arcPolicy
+type arcNode struct {
+	*entry
+
+	// isFrequent is true if the entry is in t2 (used at least twice)
+	isFrequent bool
+	elem       *list.Element
+}
+
+func (n *arcNode) getEntry() *entry {
+	return n.entry
+}
+
+// arcPolicy implements the Adaptive Replacement Cache: t1 holds entries used
+// once and t2 entries used more often, while the ghost lists b1 and b2 keep
+// the keys recently evicted from them. A hit in a ghost list moves the target
+// size p of t1, so the cache adapts between recency and frequency.
+type arcPolicy struct {
+	size int
+
+	// p is the target size of t1
+	p int
+
+	t1 *list.List
+	t2 *list.List
+
+	// ghost lists hold Key values, newest at the front
+	b1    *list.List
+	b2    *list.List
+	b1Map map[Key]*list.Element
+	b2Map map[Key]*list.Element
+}
+
+func newARCPolicy(size int) *arcPolicy {
+	return &arcPolicy{
+		size:  size,
+		t1:    list.New(),
+		t2:    list.New(),
+		b1:    list.New(),
+		b2:    list.New(),
+		b1Map: make(map[Key]*list.Element),
+		b2Map: make(map[Key]*list.Element),
+	}
+}
+
+func (p *arcPolicy) push(ent *entry) (node policyNode, evicted []policyNode) {
+	key := Key{MainKey: ent.mainKey, SubKey: ent.subKey}
+	newNode := &arcNode{
+		entry: ent,
+	}
+
+	if elem, exists := p.b1Map[key]; exists {
+		// recently evicted from t1: favour recency
+		delta := 1
+		if p.b1.Len() < p.b2.Len() {
+			delta = p.b2.Len() / p.b1.Len()
+		}
+		p.p = minInt(p.size, p.p+delta)
+
+		p.removeGhost(p.b1, p.b1Map, elem)
+		evicted = p.replace(false, evicted)
+		newNode.isFrequent = true
+		newNode.elem = p.t2.PushFront(newNode)
+		return newNode, evicted
+	}
+
+	if elem, exists := p.b2Map[key]; exists {
+		// recently evicted from t2: favour frequency
+		delta := 1
+		if p.b2.Len() < p.b1.Len() {
+			delta = p.b1.Len() / p.b2.Len()
+		}
+		p.p = maxInt(0, p.p-delta)
+
+		p.removeGhost(p.b2, p.b2Map, elem)
+		evicted = p.replace(true, evicted)
+		newNode.isFrequent = true
+		newNode.elem = p.t2.PushFront(newNode)
+		return newNode, evicted
+	}
+
+	if p.t1.Len()+p.b1.Len() >= p.size {
+		if p.t1.Len() < p.size {
+			p.removeGhost(p.b1, p.b1Map, p.b1.Back())
+			evicted = p.replace(false, evicted)
+		} else {
+			evicted = append(evicted, p.removeResident(p.t1.Back()))
+		}
+	} else if total := p.t1.Len() + p.t2.Len() + p.b1.Len() + p.b2.Len(); total >= p.size {
+		if total >= 2*p.size {
+			p.removeGhost(p.b2, p.b2Map, p.b2.Back())
+		}
+		evicted = p.replace(false, evicted)
+	}
+
+	newNode.elem = p.t1.PushFront(newNode)
+	return newNode, evicted
+}
+
+func (p *arcPolicy) touch(node policyNode) {
+	arcNode := node.(*arcNode)
+	if arcNode.isFrequent {
+		p.t2.MoveToFront(arcNode.elem)
+		return
+	}
+
+	p.t1.Remove(arcNode.elem)
+	arcNode.isFrequent = true
+	arcNode.elem = p.t2.PushFront(arcNode)
+}
+
+func (p *arcPolicy) remove(node policyNode) {
+	p.removeResident(node.(*arcNode).elem)
+}
+
+func (p *arcPolicy) victim() policyNode {
+	if elem := p.victimElement(false); elem != nil {
+		return elem.Value.(*arcNode)
+	}
+
+	return nil
+}
+
+func (p *arcPolicy) walk(fn func(node policyNode)) {
+	first, second := p.t2, p.t1
+	if elem := p.victimElement(false); elem != nil && elem.Value.(*arcNode).isFrequent == false {
+		first, second = p.t1, p.t2
+	}
+
+	for _, l := range []*list.List{first, second} {
+		for elem := l.Back(); elem != nil; elem = elem.Prev() {
+			fn(elem.Value.(*arcNode))
+		}
+	}
+}
+
+func (p *arcPolicy) resize(size int) (evicted []policyNode) {
+	p.size = size
+	p.p = minInt(p.p, size)
+	for p.t1.Len()+p.t2.Len() > size {
+		evicted = p.replace(false, evicted)
+	}
+	for p.t1.Len()+p.b1.Len() > size && p.b1.Len() > 0 {
+		p.removeGhost(p.b1, p.b1Map, p.b1.Back())
+	}
+	for p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*size && p.b2.Len() > 0 {
+		p.removeGhost(p.b2, p.b2Map, p.b2.Back())
+	}
+
+	return
+}
+
+func (p *arcPolicy) len() int {
+	return p.t1.Len() + p.t2.Len()
+}
+
+func (p *arcPolicy) reset() {
+	p.p = 0
+	p.t1.Init()
+	p.t2.Init()
+	p.b1.Init()
+	p.b2.Init()
+	p.b1Map = make(map[Key]*list.Element)
+	p.b2Map = make(map[Key]*list.Element)
+}
+
+// replace evicts one resident entry into its ghost list if the cache is full
+func (p *arcPolicy) replace(isInB2 bool, evicted []policyNode) []policyNode {
+	if p.t1.Len()+p.t2.Len() < p.size {
+		return evicted
+	}
+
+	elem := p.victimElement(isInB2)
+	if elem == nil {
+		return evicted
+	}
+
+	node := p.removeResident(elem)
+	key := Key{MainKey: node.mainKey, SubKey: node.subKey}
+	if node.isFrequent {
+		p.b2Map[key] = p.b2.PushFront(key)
+	} else {
+		p.b1Map[key] = p.b1.PushFront(key)
+	}
+
+	return append(evicted, node)
+}
+
+// victimElement returns the resident element replace would evict
+func (p *arcPolicy) victimElement(isInB2 bool) *list.Element {
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || (isInB2 && p.t1.Len() == p.p) || p.t2.Len() == 0) {
+		return p.t1.Back()
+	}
+
+	return p.t2.Back()
+}
+
+// removeResident removes a resident element from t1 or t2
+func (p *arcPolicy) removeResident(elem *list.Element) *arcNode {
+	node := elem.Value.(*arcNode)
+	if node.isFrequent {
+		p.t2.Remove(elem)
+	} else {
+		p.t1.Remove(elem)
+	}
+
+	return node
+}
+
+// removeGhost removes a key from a ghost list
+func (p *arcPolicy) removeGhost(l *list.List, ghostMap map[Key]*list.Element, elem *list.Element) {
+	if elem == nil {
+		return
+	}
+
+	delete(ghostMap, l.Remove(elem).(Key))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,148 @@
+package simplelru
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// lfuNode is an entry of lfuPolicy
+type lfuNode struct {
+	*entry
+
+	// freq is the number of times the entry was used
+	freq uint32
+
+	// tick is when the entry was last used, to evict the older one first
+	// among entries with the same freq
+	tick uint64
+
+	// index is the position in the heap
+	index int
+}
+
+func (n *lfuNode) getEntry() *entry {
+	return n.entry
+}
+
+// lfuHeap is a min-heap of lfuNode ordered by (freq, tick)
+type lfuHeap []*lfuNode
+
+func (h lfuHeap) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap) Less(i, j int) bool {
+	return lfuLess(h[i], h[j])
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	node := x.(*lfuNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	node.index = -1
+	return node
+}
+
+// lfuLess reports whether a should be evicted before b
+func lfuLess(a, b *lfuNode) bool {
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+
+	return a.tick < b.tick
+}
+
+// lfuPolicy evicts the least frequently used entry, and the least recently
+// used one among entries used equally often
+type lfuPolicy struct {
+	size int
+	heap lfuHeap
+	tick uint64
+}
+
+func newLFUPolicy(size int) *lfuPolicy {
+	return &lfuPolicy{
+		size: size,
+	}
+}
+
+func (p *lfuPolicy) push(ent *entry) (node policyNode, evicted []policyNode) {
+	for len(p.heap) >= p.size {
+		evicted = append(evicted, heap.Pop(&p.heap).(*lfuNode))
+	}
+
+	p.tick++
+	newNode := &lfuNode{
+		entry: ent,
+		freq:  1,
+		tick:  p.tick,
+	}
+	heap.Push(&p.heap, newNode)
+
+	return newNode, evicted
+}
+
+func (p *lfuPolicy) touch(node policyNode) {
+	lfuNode := node.(*lfuNode)
+
+	p.tick++
+	lfuNode.tick = p.tick
+	if lfuNode.freq < ^uint32(0) {
+		lfuNode.freq++
+	}
+	heap.Fix(&p.heap, lfuNode.index)
+}
+
+func (p *lfuPolicy) remove(node policyNode) {
+	heap.Remove(&p.heap, node.(*lfuNode).index)
+}
+
+func (p *lfuPolicy) victim() policyNode {
+	if len(p.heap) == 0 {
+		return nil
+	}
+
+	return p.heap[0]
+}
+
+func (p *lfuPolicy) walk(fn func(node policyNode)) {
+	nodeList := make([]*lfuNode, len(p.heap))
+	copy(nodeList, p.heap)
+	sort.Slice(nodeList, func(i, j int) bool {
+		return lfuLess(nodeList[i], nodeList[j])
+	})
+
+	for _, node := range nodeList {
+		fn(node)
+	}
+}
+
+func (p *lfuPolicy) resize(size int) (evicted []policyNode) {
+	p.size = size
+	for len(p.heap) > size {
+		evicted = append(evicted, heap.Pop(&p.heap).(*lfuNode))
+	}
+
+	return
+}
+
+func (p *lfuPolicy) len() int {
+	return len(p.heap)
+}
+
+func (p *lfuPolicy) reset() {
+	p.heap = nil
+}
@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,13 +19,80 @@ const newElemInsertIndex = 10
 // EvictCallback is used to get a callback when a cache entry is evicted
 type EvictCallback func(mainKey, subKey string, value interface{})
 
+// EvictReasonCallback is used to get a callback, together with the reason,
+// when a cache entry is evicted
+type EvictReasonCallback func(mainKey, subKey string, value interface{}, reason EvictReason)
+
+// EvictReason tells why an entry left the cache
+type EvictReason int
+
+const (
+	// Evict_Capacity means the entry was evicted to make room for others
+	Evict_Capacity EvictReason = iota + 1
+
+	// Evict_Expired means the entry's ttl or the cache's expireSeconds passed
+	Evict_Expired
+
+	// Evict_Removed means the entry was removed explicitly
+	Evict_Removed
+
+	// Evict_Purged means the whole cache was purged
+	Evict_Purged
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Evict_Capacity:
+		return "capacity"
+	case Evict_Expired:
+		return "expired"
+	case Evict_Removed:
+		return "removed"
+	case Evict_Purged:
+		return "purged"
+	default:
+		return "unknown"
+	}
+}
+
 // LRU implements a non-thread safe fixed size LRU cache
 type LRU struct {
 	size      int
 	evictList *list.List
 	items     map[string]map[string]*list.Element
-	onEvict   EvictCallback
+	onEvict   EvictReasonCallback
 	sync.RWMutex
+
+	// isUnsynchronized skips the lock, the caller serializes every access
+	isUnsynchronized bool
+}
+
+// lock takes the write lock unless the LRU is unsynchronized
+func (c *LRU) lock() {
+	if !c.isUnsynchronized {
+		c.Lock()
+	}
+}
+
+// unlock releases the write lock unless the LRU is unsynchronized
+func (c *LRU) unlock() {
+	if !c.isUnsynchronized {
+		c.Unlock()
+	}
+}
+
+// rlock takes the read lock unless the LRU is unsynchronized
+func (c *LRU) rlock() {
+	if !c.isUnsynchronized {
+		c.RLock()
+	}
+}
+
+// runlock releases the read lock unless the LRU is unsynchronized
+func (c *LRU) runlock() {
+	if !c.isUnsynchronized {
+		c.RUnlock()
+	}
 }
 
 // entry is used to hold a value in the evictList
@@ -34,6 +102,32 @@ type entry struct {
 	value        interface{}
 	referenceNum int32
 	lastGetTime  int64
+
+	// expireTime is the unix nano time the entry expires at, 0 means never
+	expireTime int64
+
+	// slidingTTL is added to the current time on every read, 0 means the
+	// expire time is absolute
+	slidingTTL int64
+}
+
+// isExpired checks whether the entry's own ttl has passed
+func (e *entry) isExpired(now int64) bool {
+	return e.expireTime > 0 && e.expireTime <= now
+}
+
+// setTTL sets the entry's own ttl, ttl <= 0 means never expire
+func (e *entry) setTTL(ttl time.Duration, isSliding bool) {
+	e.expireTime = 0
+	e.slidingTTL = 0
+	if ttl <= 0 {
+		return
+	}
+
+	e.expireTime = time.Now().UnixNano() + int64(ttl)
+	if isSliding {
+		e.slidingTTL = int64(ttl)
+	}
 }
 
 // Key is used to return entry's key
@@ -42,8 +136,57 @@ type Key struct {
 	SubKey  string
 }
 
+// Entry is a snapshot of a cache entry, used to save and restore a cache
+type Entry struct {
+	MainKey string
+	SubKey  string
+	Value   interface{}
+
+	// ExpireTime is the unix nano time the entry expires at, 0 means never
+	ExpireTime int64
+
+	// SlidingTTL is pushed back on every read, 0 means ExpireTime is absolute
+	SlidingTTL time.Duration
+}
+
+// toEntry returns the snapshot of e
+func (e *entry) toEntry() *Entry {
+	return &Entry{
+		MainKey:    e.mainKey,
+		SubKey:     e.subKey,
+		Value:      e.value,
+		ExpireTime: e.expireTime,
+		SlidingTTL: time.Duration(e.slidingTTL),
+	}
+}
+
+// newEntryFromSnapshot creates an entry from its snapshot
+func newEntryFromSnapshot(snapshot *Entry) *entry {
+	return &entry{
+		mainKey:     snapshot.MainKey,
+		subKey:      snapshot.SubKey,
+		value:       snapshot.Value,
+		lastGetTime: time.Now().Unix(),
+		expireTime:  snapshot.ExpireTime,
+		slidingTTL:  int64(snapshot.SlidingTTL),
+	}
+}
+
 // NewLRU constructs an LRU of the given size
 func NewLRU(size int, onEvict EvictCallback) (*LRU, error) {
+	var callback EvictReasonCallback
+	if onEvict != nil {
+		callback = func(mainKey, subKey string, value interface{}, reason EvictReason) {
+			onEvict(mainKey, subKey, value)
+		}
+	}
+
+	return NewLRUWithReason(size, callback)
+}
+
+// NewLRUWithReason constructs an LRU of the given size whose eviction
+// callback is also told why the entry was evicted
+func NewLRUWithReason(size int, onEvict EvictReasonCallback) (*LRU, error) {
 	if size <= 0 {
 		return nil, errors.New("Must provide a positive size")
 	}
@@ -58,13 +201,13 @@ func NewLRU(size int, onEvict EvictCallback) (*LRU, error) {
 
 // Purge is used to completely clear the cache.
 func (c *LRU) Purge() {
-	c.Lock()
-	defer c.Unlock()
+	c.lock()
+	defer c.unlock()
 
 	for mainKey, valueByMainKey := range c.items {
 		for subKey, value := range valueByMainKey {
 			if c.onEvict != nil {
-				c.onEvict(mainKey, subKey, value.Value.(*entry).value)
+				c.onEvict(mainKey, subKey, value.Value.(*entry).value, Evict_Purged)
 			}
 		}
 
@@ -75,8 +218,15 @@ func (c *LRU) Purge() {
 
 // Set adds a value to the cache.  Returns true if an eviction occurred.
 func (c *LRU) Set(mainKey, subKey string, value interface{}) (evicted bool) {
+	return c.SetWithTTL(mainKey, subKey, value, 0, false)
+}
+
+// SetWithTTL adds a value that expires after ttl (ttl <= 0 means never).
+// If isSliding is true every read pushes the expire time back by ttl.
+// Returns true if an eviction occurred.
+func (c *LRU) SetWithTTL(mainKey, subKey string, value interface{}, ttl time.Duration, isSliding bool) (evicted bool) {
 	// Check for existing item
-	c.Lock()
+	c.lock()
 
 	mainEntry, exist := c.items[mainKey]
 	if exist == false {
@@ -89,7 +239,8 @@ func (c *LRU) Set(mainKey, subKey string, value interface{}) (evicted bool) {
 		ent := subItem.Value.(*entry)
 		ent.value = value
 		ent.lastGetTime = time.Now().Unix()
-		c.Unlock()
+		ent.setTTL(ttl, isSliding)
+		c.unlock()
 
 		// 尝试将数据放到列表头部
 		c.tryPushElemToHead(ent, subItem)
@@ -103,6 +254,7 @@ func (c *LRU) Set(mainKey, subKey string, value interface{}) (evicted bool) {
 		value:       value,
 		lastGetTime: time.Now().Unix(),
 	}
+	ent.setTTL(ttl, isSliding)
 
 	insertIndex := c.evictList.Len() * newElemInsertIndex / 100
 	var entry *list.Element
@@ -119,7 +271,7 @@ func (c *LRU) Set(mainKey, subKey string, value interface{}) (evicted bool) {
 
 	mainEntry[subKey] = entry
 	evict := c.evictList.Len() > c.size
-	c.Unlock()
+	c.unlock()
 
 	// Verify size not exceeded
 	if evict {
@@ -129,12 +281,13 @@ func (c *LRU) Set(mainKey, subKey string, value interface{}) (evicted bool) {
 	return evict
 }
 
-// Get looks up a key's value from the cache.
+// Get looks up a key's value from the cache. An entry whose ttl has passed
+// is removed and reported as not found.
 func (c *LRU) GetSub(mainKey string, subKey string) (value interface{}, ok bool) {
 	var ent *entry
 	var elem *list.Element
 
-	c.RLock()
+	c.lock()
 	var mainEntry map[string]*list.Element
 	mainEntry, ok = c.items[mainKey]
 	if ok == true {
@@ -142,15 +295,22 @@ func (c *LRU) GetSub(mainKey string, subKey string) (value interface{}, ok bool)
 		if ok == true {
 			//c.evictList.MoveToFront(ent)
 			ent, _ = elem.Value.(*entry)
-			if ent != nil {
-				ent.lastGetTime = time.Now().Unix()
-				value = ent.value
-				ok = true
+			now := time.Now()
+			if ent.isExpired(now.UnixNano()) {
+				c.removeElementNoLock(elem, Evict_Expired)
+				c.unlock()
+				return nil, false
 			}
+
+			ent.lastGetTime = now.Unix()
+			if ent.slidingTTL > 0 {
+				ent.expireTime = now.UnixNano() + ent.slidingTTL
+			}
+			value = ent.value
 		}
 	}
 
-	c.RUnlock()
+	c.unlock()
 
 	// 尝试将元素防止列表头部
 	c.tryPushElemToHead(ent, elem)
@@ -161,7 +321,7 @@ func (c *LRU) GetSub(mainKey string, subKey string) (value interface{}, ok bool)
 // GetSub looks up a mainkey's values from cache
 func (c *LRU) Get(mainKey string) (value map[string]interface{}, ok bool) {
 	var subKeys []string
-	c.RLock()
+	c.rlock()
 	mainEntry, ifExist := c.items[mainKey]
 	if ifExist == true {
 		subKeys = make([]string, 0)
@@ -169,7 +329,7 @@ func (c *LRU) Get(mainKey string) (value map[string]interface{}, ok bool) {
 			subKeys = append(subKeys, subKey)
 		}
 	}
-	c.RUnlock()
+	c.runlock()
 
 	if subKeys != nil && len(subKeys) > 0 {
 		value = make(map[string]interface{})
@@ -188,59 +348,142 @@ func (c *LRU) Get(mainKey string) (value map[string]interface{}, ok bool) {
 // ContainsSub checks if a key is in the cache, without updating the recent-ness
 // or deleting it for being stale.
 func (c *LRU) ContainsSub(mainKey, subKey string) (ok bool) {
-	c.RLock()
+	c.rlock()
 
 	var mainEntry map[string]*list.Element
 	mainEntry, ok = c.items[mainKey]
 	if ok == true {
-		_, ok = mainEntry[subKey]
+		var elem *list.Element
+		if elem, ok = mainEntry[subKey]; ok == true {
+			ok = !elem.Value.(*entry).isExpired(time.Now().UnixNano())
+		}
 	}
 
-	c.RUnlock()
+	c.runlock()
 	return ok
 }
 
 // Contains checks if a key is in the cache, without updating the recent-ness
 // or deleting it for being stale.
 func (c *LRU) Contains(mainKey string) (ok bool) {
-	c.RLock()
-	_, ok = c.items[mainKey]
-	c.RUnlock()
-	return ok
+	c.rlock()
+	defer c.runlock()
+
+	now := time.Now().UnixNano()
+	for _, elem := range c.items[mainKey] {
+		if !elem.Value.(*entry).isExpired(now) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Peek returns the key value (or undefined if not found) without updating
 // the "recently used"-ness of the key.
 func (c *LRU) Peek(mainKey, subKey string) (value interface{}, ok bool) {
-	c.RLock()
+	c.rlock()
 	var mainEntry map[string]*list.Element
 	if mainEntry, ok = c.items[mainKey]; ok == true {
 		var ent *list.Element
 		if ent, ok = mainEntry[subKey]; ok == true {
-			value = ent.Value.(*entry).value
-			ok = true
+			if kv := ent.Value.(*entry); !kv.isExpired(time.Now().UnixNano()) {
+				value = kv.value
+			} else {
+				ok = false
+			}
 		}
 	}
 
-	c.RUnlock()
+	c.runlock()
 
 	return
 }
 
+// RangeSub calls fn for every live sub-key of mainKey, without updating the
+// recent-ness, until fn returns false. fn must not use the cache.
+func (c *LRU) RangeSub(mainKey string, fn func(subKey string, value interface{}) bool) {
+	c.rlock()
+	defer c.runlock()
+
+	now := time.Now().UnixNano()
+	for subKey, elem := range c.items[mainKey] {
+		if kv := elem.Value.(*entry); !kv.isExpired(now) {
+			if !fn(subKey, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// CountSub returns the number of live sub-keys of mainKey.
+func (c *LRU) CountSub(mainKey string) (count int) {
+	c.rlock()
+	defer c.runlock()
+
+	now := time.Now().UnixNano()
+	for _, elem := range c.items[mainKey] {
+		if !elem.Value.(*entry).isExpired(now) {
+			count++
+		}
+	}
+
+	return
+}
+
+// ExpireSub makes every live sub-key of mainKey expire after ttl (ttl <= 0
+// means never), returns the number of sub-keys changed.
+func (c *LRU) ExpireSub(mainKey string, ttl time.Duration) (count int) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	for _, elem := range c.items[mainKey] {
+		if kv := elem.Value.(*entry); !kv.isExpired(now) {
+			kv.setTTL(ttl, false)
+			count++
+		}
+	}
+
+	return
+}
+
+// RemovePrefix removes every entry whose mainKey starts with prefix, returns
+// the number of entries removed.
+func (c *LRU) RemovePrefix(prefix string) (count int) {
+	c.lock()
+	defer c.unlock()
+
+	var elemList []*list.Element
+	for mainKey, mainEntry := range c.items {
+		if strings.HasPrefix(mainKey, prefix) {
+			for _, elem := range mainEntry {
+				elemList = append(elemList, elem)
+			}
+		}
+	}
+
+	for _, elem := range elemList {
+		c.removeElementNoLock(elem, Evict_Removed)
+	}
+
+	return len(elemList)
+}
+
 // Remove removes the provided key from the cache, returning if the
 // key was contained.
 func (c *LRU) RemoveSub(mainKey, subKey string) (present bool) {
 	var subEntry *list.Element
 
-	c.RLock()
+	c.rlock()
 	mainEntry, ok := c.items[mainKey]
 	if ok == true {
 		subEntry, ok = mainEntry[subKey]
 	}
-	c.RUnlock()
+	c.runlock()
 
 	if ok == true {
-		c.removeElement(subEntry)
+		c.removeElement(subEntry, Evict_Removed)
 		present = true
 	}
 
@@ -250,7 +493,7 @@ func (c *LRU) RemoveSub(mainKey, subKey string) (present bool) {
 // Remove removes the provided key from the cache, returning if the
 // key was contained.
 func (c *LRU) Remove(mainKey string) (present bool) {
-	c.RLock()
+	c.rlock()
 	mainEntry, ok := c.items[mainKey]
 	var node []*list.Element
 	if ok {
@@ -261,11 +504,11 @@ func (c *LRU) Remove(mainKey string) (present bool) {
 			count += 1
 		}
 	}
-	c.RUnlock()
+	c.runlock()
 
 	if ok == true {
 		for _, entry := range node {
-			c.removeElement(entry)
+			c.removeElement(entry, Evict_Removed)
 		}
 	}
 
@@ -274,15 +517,15 @@ func (c *LRU) Remove(mainKey string) (present bool) {
 
 // RemoveOldest removes the oldest item from the cache.
 func (c *LRU) RemoveOldest() (mainKey string, subKey string, value interface{}, ok bool) {
-	c.RLock()
+	c.rlock()
 	ent := c.evictList.Back()
-	c.RUnlock()
+	c.runlock()
 
 	if ent != nil {
 		entryValue := ent.Value.(*entry)
 
 		// remove from list
-		c.removeElement(ent)
+		c.removeElement(ent, Evict_Removed)
 
 		mainKey = entryValue.mainKey
 		subKey = entryValue.subKey
@@ -295,7 +538,7 @@ func (c *LRU) RemoveOldest() (mainKey string, subKey string, value interface{},
 
 // GetOldest returns the oldest entry
 func (c *LRU) GetOldest() (mainKey string, subKey string, value interface{}, ok bool) {
-	c.RLock()
+	c.rlock()
 	ent := c.evictList.Back()
 	if ent != nil {
 		kv := ent.Value.(*entry)
@@ -305,13 +548,13 @@ func (c *LRU) GetOldest() (mainKey string, subKey string, value interface{}, ok
 		ok = true
 	}
 
-	c.RUnlock()
+	c.runlock()
 	return
 }
 
 // Keys returns a slice of the keys in the cache, from oldest to newest.
 func (c *LRU) Keys() []*Key {
-	c.RLock()
+	c.rlock()
 
 	keys := make([]*Key, c.evictList.Len())
 	i := 0
@@ -321,15 +564,58 @@ func (c *LRU) Keys() []*Key {
 		i++
 	}
 
-	c.RUnlock()
+	c.runlock()
 	return keys
 }
 
+// Entries returns a snapshot of the live entries, from oldest to newest.
+func (c *LRU) Entries() []*Entry {
+	c.rlock()
+	defer c.runlock()
+
+	now := time.Now().UnixNano()
+	entries := make([]*Entry, 0, c.evictList.Len())
+	for ent := c.evictList.Back(); ent != nil; ent = ent.Prev() {
+		if kv := ent.Value.(*entry); !kv.isExpired(now) {
+			entries = append(entries, kv.toEntry())
+		}
+	}
+
+	return entries
+}
+
+// Restore adds an entry from a snapshot as the newest one, returns true if
+// an eviction occurred.
+func (c *LRU) Restore(snapshot *Entry) (evicted bool) {
+	c.lock()
+	defer c.unlock()
+
+	mainEntry, exist := c.items[snapshot.MainKey]
+	if exist == false {
+		mainEntry = make(map[string]*list.Element)
+		c.items[snapshot.MainKey] = mainEntry
+	}
+
+	if elem, exist := mainEntry[snapshot.SubKey]; exist {
+		elem.Value = newEntryFromSnapshot(snapshot)
+		c.evictList.MoveToFront(elem)
+		return false
+	}
+
+	mainEntry[snapshot.SubKey] = c.evictList.PushFront(newEntryFromSnapshot(snapshot))
+	for c.evictList.Len() > c.size {
+		c.removeElementNoLock(c.evictList.Back(), Evict_Capacity)
+		evicted = true
+	}
+
+	return
+}
+
 // Len returns the number of items in the cache.
 func (c *LRU) Len() int {
-	c.RLock()
+	c.rlock()
 	result := c.evictList.Len()
-	c.RUnlock()
+	c.runlock()
 	return result
 }
 
@@ -346,30 +632,30 @@ func (c *LRU) Resize(size int) (evicted int) {
 	return diff
 }
 
-// RemoveExpired remove timeout cache
+// RemoveExpired removes the entries whose own ttl has passed, and the entries
+// not read for expireSeconds (expireSeconds <= 0 means only the former).
 func (c *LRU) RemoveExpired(expireSeconds int) {
-	minSaveTime := time.Now().Unix() - int64(expireSeconds)
-	c.Lock()
-	defer c.Unlock()
-	for {
-		backItem := c.evictList.Back()
-		if backItem == nil {
-			break
-		}
-
-		entry := backItem.Value.(*entry)
-		if entry.lastGetTime > minSaveTime {
-			break
+	now := time.Now()
+	minSaveTime := now.Unix() - int64(expireSeconds)
+	c.lock()
+	defer c.unlock()
+
+	for item := c.evictList.Back(); item != nil; {
+		prev := item.Prev()
+
+		entry := item.Value.(*entry)
+		if entry.isExpired(now.UnixNano()) || (expireSeconds > 0 && entry.lastGetTime <= minSaveTime) {
+			// remove expire item
+			c.removeElementNoLock(item, Evict_Expired)
 		}
 
-		// remove expire item
-		c.removeElementNoLock(backItem)
+		item = prev
 	}
 }
 
 func (c *LRU) Print() {
-	c.Lock()
-	defer c.Unlock()
+	c.lock()
+	defer c.unlock()
 	element := c.evictList.Back()
 	count := 0
 	for {
@@ -394,7 +680,7 @@ func (c *LRU) tryPushElemToHead(ent *entry, elem *list.Element) {
 
 		// 超过一定的引用次数才将数据放到列表头部
 		if atomic.LoadInt32(&ent.referenceNum) >= maxReferenceNum {
-			c.Lock()
+			c.lock()
 			if atomic.LoadInt32(&ent.referenceNum) >= maxReferenceNum {
 				ifExist := false
 				main, mainExist := c.items[ent.mainKey]
@@ -415,7 +701,7 @@ func (c *LRU) tryPushElemToHead(ent *entry, elem *list.Element) {
 				atomic.StoreInt32(&ent.referenceNum, 0)
 			}
 
-			c.Unlock()
+			c.unlock()
 		}
 	}
 
@@ -423,22 +709,22 @@ func (c *LRU) tryPushElemToHead(ent *entry, elem *list.Element) {
 
 // removeOldest removes the oldest item from the cache.
 func (c *LRU) removeOldest() {
-	c.RLock()
+	c.rlock()
 	ent := c.evictList.Back()
-	c.RUnlock()
+	c.runlock()
 
 	if ent != nil {
-		c.removeElement(ent)
+		c.removeElement(ent, Evict_Capacity)
 	}
 }
 
 // removeElement is used to remove a given list element from the cache
-func (c *LRU) removeElement(e *list.Element) {
-	c.Lock()
-	defer c.Unlock()
-	c.removeElementNoLock(e)
+func (c *LRU) removeElement(e *list.Element, reason EvictReason) {
+	c.lock()
+	defer c.unlock()
+	c.removeElementNoLock(e, reason)
 }
-func (c *LRU) removeElementNoLock(e *list.Element) {
+func (c *LRU) removeElementNoLock(e *list.Element, reason EvictReason) {
 	c.evictList.Remove(e)
 	kv := e.Value.(*entry)
 
@@ -449,6 +735,6 @@ func (c *LRU) removeElementNoLock(e *list.Element) {
 	}
 
 	if c.onEvict != nil {
-		c.onEvict(kv.mainKey, kv.subKey, kv.value)
+		c.onEvict(kv.mainKey, kv.subKey, kv.value, reason)
 	}
 }
@@ -37,6 +37,36 @@ func NewLruPool(poolCapacity int, lruCapacity int, callback EvictCallback) (*Lru
 	}, nil
 }
 
+/*
+	func:创建使用指定淘汰算法的lru池
+	param:
+		Policy:淘汰算法
+		int:lru池大小
+		int:单个lru大小
+		EvictReasonCallback:淘汰回调(包含淘汰原因)
+	return:
+		*LruPool:池对象
+*/
+func NewLruPool2(policy Policy, poolCapacity int, lruCapacity int, callback EvictReasonCallback) (*LruPool, error) {
+	if poolCapacity <= 0 {
+		return nil, errors.New("Must provide a positive size")
+	}
+
+	tempPools := make([]LRUCache, poolCapacity)
+	for i := 0; i < poolCapacity; i++ {
+		temp, err := NewCache(policy, lruCapacity, callback)
+		if err != nil {
+			return nil, err
+		}
+		tempPools[i] = temp
+	}
+
+	return &LruPool{
+		_pollCapacity: poolCapacity,
+		_lruPool:      tempPools,
+	}, nil
+}
+
 /*
 	func:根据主模块获取lru对象
 	param:
@@ -1,11 +1,17 @@
 package simplelru
 
+import "time"
+
 // LRUCache is the interface for simple LRU cache.
 type LRUCache interface {
 	// Adds a value to the cache, returns true if an eviction occurred and
 	// updates the "recently used"-ness of the key.
 	Set(mainKey, subKey string, value interface{}) (evicted bool)
 
+	// Adds a value that expires after ttl (ttl <= 0 means never), if isSliding
+	// is true every read pushes the expire time back by ttl.
+	SetWithTTL(mainKey, subKey string, value interface{}, ttl time.Duration, isSliding bool) (evicted bool)
+
 	// GetSub looks up a mainkey's values from cache
 	// updates the "recently used"-ness of the key. #value, isFound
 	Get(mainKey string) (value map[string]interface{}, ok bool)
@@ -23,6 +29,21 @@ type LRUCache interface {
 	// Returns key's value without updating the "recently used"-ness of the key.
 	Peek(mainKey, subKey string) (value interface{}, ok bool)
 
+	// Calls fn for every live sub-key of mainKey without updating the
+	// recent-ness, until fn returns false. fn must not use the cache.
+	RangeSub(mainKey string, fn func(subKey string, value interface{}) bool)
+
+	// Returns the number of live sub-keys of mainKey.
+	CountSub(mainKey string) int
+
+	// Makes every live sub-key of mainKey expire after ttl (ttl <= 0 means
+	// never), returns the number of sub-keys changed.
+	ExpireSub(mainKey string, ttl time.Duration) int
+
+	// Removes every entry whose mainKey starts with prefix, returns the
+	// number of entries removed.
+	RemovePrefix(prefix string) int
+
 	// Removes a key from the cache.
 	Remove(mainKey string) (present bool)
 
@@ -38,6 +59,13 @@ type LRUCache interface {
 	// Returns a slice of the keys in the cache, from oldest to newest.
 	Keys() []*Key
 
+	// Returns a snapshot of the live entries, from oldest to newest.
+	Entries() []*Entry
+
+	// Adds an entry from a snapshot as the newest one, returns true if an
+	// eviction occurred.
+	Restore(snapshot *Entry) (evicted bool)
+
 	// Returns the number of items in the cache.
 	Len() int
 
@@ -47,6 +75,6 @@ type LRUCache interface {
 	// Resizes cache, returning number evicted
 	Resize(int) int
 
-	// remove timeout cache
+	// Removes entries whose ttl has passed and entries not read for expireSeconds
 	RemoveExpired(expireSeconds int)
 }
@@ -0,0 +1,568 @@
+package simplelru
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy is the algorithm that decides which entry is evicted
+type Policy int
+
+const (
+	// Policy_LRU evicts the least recently used entry (see LRU)
+	Policy_LRU Policy = iota
+
+	// Policy_LFU evicts the least frequently used entry
+	Policy_LFU
+
+	// Policy_ARC balances between recency and frequency (Adaptive Replacement Cache)
+	Policy_ARC
+
+	// Policy_TinyLFU keeps a small LRU window in front of a segmented LRU and
+	// only admits an entry into it if it is used more often than the entry it
+	// would replace (W-TinyLFU)
+	Policy_TinyLFU
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Policy_LRU:
+		return "LRU"
+	case Policy_LFU:
+		return "LFU"
+	case Policy_ARC:
+		return "ARC"
+	case Policy_TinyLFU:
+		return "TinyLFU"
+	default:
+		return "unknown"
+	}
+}
+
+// NewCache constructs a cache of the given size using the given policy
+func NewCache(policy Policy, size int, onEvict EvictReasonCallback) (LRUCache, error) {
+	if size <= 0 {
+		return nil, errors.New("Must provide a positive size")
+	}
+
+	switch policy {
+	case Policy_LRU:
+		return NewLRUWithReason(size, onEvict)
+	case Policy_LFU:
+		return newPolicyCache(newLFUPolicy(size), onEvict), nil
+	case Policy_ARC:
+		return newPolicyCache(newARCPolicy(size), onEvict), nil
+	case Policy_TinyLFU:
+		return newPolicyCache(newTinyLFUPolicy(size), onEvict), nil
+	default:
+		return nil, errors.New("Unknown policy")
+	}
+}
+
+// NewUnsynchronizedCache is like NewCache but the returned cache takes no
+// lock of its own. The caller must serialize every access to it, e.g. with a
+// lock that already guards the cache.
+func NewUnsynchronizedCache(policy Policy, size int, onEvict EvictReasonCallback) (LRUCache, error) {
+	cache, err := NewCache(policy, size, onEvict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := cache.(type) {
+	case *LRU:
+		c.isUnsynchronized = true
+	case *policyCache:
+		c.isUnsynchronized = true
+	}
+
+	return cache, nil
+}
+
+// policyNode is the node an evictionPolicy keeps for each entry
+type policyNode interface {
+	getEntry() *entry
+}
+
+// evictionPolicy decides which entries stay in a policyCache. Its methods are
+// called with the cache lock held.
+type evictionPolicy interface {
+	// push adds a new entry, returning its node and the nodes evicted to make
+	// room; the new node itself may be among them if it was not admitted.
+	push(ent *entry) (node policyNode, evicted []policyNode)
+
+	// touch records a hit on node
+	touch(node policyNode)
+
+	// remove removes node
+	remove(node policyNode)
+
+	// victim returns the node that would be evicted next, nil if empty
+	victim() policyNode
+
+	// walk calls fn for every node, starting with the next victim
+	walk(fn func(node policyNode))
+
+	// resize changes the capacity, returning the nodes evicted
+	resize(size int) (evicted []policyNode)
+
+	// len returns the number of nodes
+	len() int
+
+	// reset removes every node
+	reset()
+}
+
+// policyCache implements LRUCache on top of an evictionPolicy. It keeps the
+// (mainKey, subKey) index, handles ttl and calls the eviction callback.
+type policyCache struct {
+	policy  evictionPolicy
+	items   map[string]map[string]policyNode
+	onEvict EvictReasonCallback
+	sync.Mutex
+
+	// isUnsynchronized skips the lock, the caller serializes every access
+	isUnsynchronized bool
+}
+
+// lock takes the lock unless the cache is unsynchronized
+func (c *policyCache) lock() {
+	if !c.isUnsynchronized {
+		c.Lock()
+	}
+}
+
+// unlock releases the lock unless the cache is unsynchronized
+func (c *policyCache) unlock() {
+	if !c.isUnsynchronized {
+		c.Unlock()
+	}
+}
+
+// newPolicyCache constructs a policyCache
+func newPolicyCache(policy evictionPolicy, onEvict EvictReasonCallback) *policyCache {
+	return &policyCache{
+		policy:  policy,
+		items:   make(map[string]map[string]policyNode),
+		onEvict: onEvict,
+	}
+}
+
+// Set adds a value to the cache.  Returns true if an eviction occurred.
+func (c *policyCache) Set(mainKey, subKey string, value interface{}) (evicted bool) {
+	return c.SetWithTTL(mainKey, subKey, value, 0, false)
+}
+
+// SetWithTTL adds a value that expires after ttl (ttl <= 0 means never).
+// If isSliding is true every read pushes the expire time back by ttl.
+// Returns true if an eviction occurred.
+func (c *policyCache) SetWithTTL(mainKey, subKey string, value interface{}, ttl time.Duration, isSliding bool) (evicted bool) {
+	c.lock()
+	defer c.unlock()
+
+	if node, exists := c.items[mainKey][subKey]; exists {
+		ent := node.getEntry()
+		ent.value = value
+		ent.lastGetTime = time.Now().Unix()
+		ent.setTTL(ttl, isSliding)
+		c.policy.touch(node)
+		return false
+	}
+
+	ent := &entry{
+		mainKey:     mainKey,
+		subKey:      subKey,
+		value:       value,
+		lastGetTime: time.Now().Unix(),
+	}
+	ent.setTTL(ttl, isSliding)
+
+	return c.add(ent)
+}
+
+// Entries returns a snapshot of the live entries, starting with the entry
+// that would be evicted next.
+func (c *policyCache) Entries() []*Entry {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	entries := make([]*Entry, 0, c.policy.len())
+	c.policy.walk(func(node policyNode) {
+		if ent := node.getEntry(); !ent.isExpired(now) {
+			entries = append(entries, ent.toEntry())
+		}
+	})
+
+	return entries
+}
+
+// Restore adds an entry from a snapshot, returns true if an eviction occurred.
+func (c *policyCache) Restore(snapshot *Entry) (evicted bool) {
+	c.lock()
+	defer c.unlock()
+
+	if node, exists := c.items[snapshot.MainKey][snapshot.SubKey]; exists {
+		c.removeNode(node, Evict_Removed)
+	}
+
+	return c.add(newEntryFromSnapshot(snapshot))
+}
+
+// add adds a new entry, returns true if an eviction occurred.
+func (c *policyCache) add(ent *entry) (evicted bool) {
+	node, evictedList := c.policy.push(ent)
+	isAdmitted := true
+	for _, item := range evictedList {
+		if item == node {
+			isAdmitted = false
+			continue
+		}
+		c.unindex(item.getEntry())
+	}
+	if isAdmitted {
+		mainEntry, exists := c.items[ent.mainKey]
+		if exists == false {
+			mainEntry = make(map[string]policyNode)
+			c.items[ent.mainKey] = mainEntry
+		}
+		mainEntry[ent.subKey] = node
+	}
+
+	for _, item := range evictedList {
+		c.evict(item.getEntry(), Evict_Capacity)
+	}
+
+	return len(evictedList) > 0
+}
+
+// Get looks up a mainkey's values from cache
+func (c *policyCache) Get(mainKey string) (value map[string]interface{}, ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	mainEntry, exists := c.items[mainKey]
+	if exists == false {
+		return
+	}
+
+	subKeys := make([]string, 0, len(mainEntry))
+	for subKey := range mainEntry {
+		subKeys = append(subKeys, subKey)
+	}
+
+	value = make(map[string]interface{}, len(subKeys))
+	for _, subKey := range subKeys {
+		if subValue, exists := c.getSub(mainKey, subKey); exists {
+			value[subKey] = subValue
+			ok = true
+		}
+	}
+
+	return
+}
+
+// GetSub looks up a key's value from the cache. An entry whose ttl has passed
+// is removed and reported as not found.
+func (c *policyCache) GetSub(mainKey string, subKey string) (value interface{}, ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	return c.getSub(mainKey, subKey)
+}
+
+// Contains checks if a key is in the cache, without updating the recent-ness
+// or deleting it for being stale.
+func (c *policyCache) Contains(mainKey string) (ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	for _, node := range c.items[mainKey] {
+		if !node.getEntry().isExpired(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContainsSub checks if a key is in the cache, without updating the recent-ness
+// or deleting it for being stale.
+func (c *policyCache) ContainsSub(mainKey, subKey string) (ok bool) {
+	_, ok = c.Peek(mainKey, subKey)
+	return
+}
+
+// Peek returns the key value (or undefined if not found) without updating
+// the "recently used"-ness of the key.
+func (c *policyCache) Peek(mainKey, subKey string) (value interface{}, ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	node, exists := c.items[mainKey][subKey]
+	if exists == false || node.getEntry().isExpired(time.Now().UnixNano()) {
+		return nil, false
+	}
+
+	return node.getEntry().value, true
+}
+
+// RangeSub calls fn for every live sub-key of mainKey, without updating the
+// recent-ness, until fn returns false. fn must not use the cache.
+func (c *policyCache) RangeSub(mainKey string, fn func(subKey string, value interface{}) bool) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	for subKey, node := range c.items[mainKey] {
+		if ent := node.getEntry(); !ent.isExpired(now) {
+			if !fn(subKey, ent.value) {
+				return
+			}
+		}
+	}
+}
+
+// CountSub returns the number of live sub-keys of mainKey.
+func (c *policyCache) CountSub(mainKey string) (count int) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	for _, node := range c.items[mainKey] {
+		if !node.getEntry().isExpired(now) {
+			count++
+		}
+	}
+
+	return
+}
+
+// ExpireSub makes every live sub-key of mainKey expire after ttl (ttl <= 0
+// means never), returns the number of sub-keys changed.
+func (c *policyCache) ExpireSub(mainKey string, ttl time.Duration) (count int) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now().UnixNano()
+	for _, node := range c.items[mainKey] {
+		if ent := node.getEntry(); !ent.isExpired(now) {
+			ent.setTTL(ttl, false)
+			count++
+		}
+	}
+
+	return
+}
+
+// RemovePrefix removes every entry whose mainKey starts with prefix, returns
+// the number of entries removed.
+func (c *policyCache) RemovePrefix(prefix string) (count int) {
+	c.lock()
+	defer c.unlock()
+
+	var nodeList []policyNode
+	for mainKey, mainEntry := range c.items {
+		if strings.HasPrefix(mainKey, prefix) {
+			for _, node := range mainEntry {
+				nodeList = append(nodeList, node)
+			}
+		}
+	}
+
+	for _, node := range nodeList {
+		c.removeNode(node, Evict_Removed)
+	}
+
+	return len(nodeList)
+}
+
+// Remove removes the provided key from the cache, returning if the
+// key was contained.
+func (c *policyCache) Remove(mainKey string) (present bool) {
+	c.lock()
+	defer c.unlock()
+
+	mainEntry, exists := c.items[mainKey]
+	if exists == false {
+		return false
+	}
+
+	nodeList := make([]policyNode, 0, len(mainEntry))
+	for _, node := range mainEntry {
+		nodeList = append(nodeList, node)
+	}
+	for _, node := range nodeList {
+		c.removeNode(node, Evict_Removed)
+	}
+
+	return true
+}
+
+// RemoveSub removes the provided key from the cache, returning if the
+// key was contained.
+func (c *policyCache) RemoveSub(mainKey, subKey string) (present bool) {
+	c.lock()
+	defer c.unlock()
+
+	node, exists := c.items[mainKey][subKey]
+	if exists == false {
+		return false
+	}
+
+	c.removeNode(node, Evict_Removed)
+	return true
+}
+
+// RemoveOldest removes the entry that would be evicted next.
+func (c *policyCache) RemoveOldest() (mainKey string, subKey string, value interface{}, ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	node := c.policy.victim()
+	if node == nil {
+		return
+	}
+
+	ent := node.getEntry()
+	c.removeNode(node, Evict_Removed)
+	return ent.mainKey, ent.subKey, ent.value, true
+}
+
+// GetOldest returns the entry that would be evicted next.
+func (c *policyCache) GetOldest() (mainKey string, subKey string, value interface{}, ok bool) {
+	c.lock()
+	defer c.unlock()
+
+	node := c.policy.victim()
+	if node == nil {
+		return
+	}
+
+	ent := node.getEntry()
+	return ent.mainKey, ent.subKey, ent.value, true
+}
+
+// Keys returns a slice of the keys in the cache, starting with the entry
+// that would be evicted next.
+func (c *policyCache) Keys() []*Key {
+	c.lock()
+	defer c.unlock()
+
+	keys := make([]*Key, 0, c.policy.len())
+	c.policy.walk(func(node policyNode) {
+		ent := node.getEntry()
+		keys = append(keys, &Key{ent.mainKey, ent.subKey})
+	})
+
+	return keys
+}
+
+// Len returns the number of items in the cache.
+func (c *policyCache) Len() int {
+	c.lock()
+	defer c.unlock()
+
+	return c.policy.len()
+}
+
+// Purge is used to completely clear the cache.
+func (c *policyCache) Purge() {
+	c.lock()
+	defer c.unlock()
+
+	var entryList []*entry
+	c.policy.walk(func(node policyNode) {
+		entryList = append(entryList, node.getEntry())
+	})
+
+	c.policy.reset()
+	c.items = make(map[string]map[string]policyNode)
+	for _, ent := range entryList {
+		c.evict(ent, Evict_Purged)
+	}
+}
+
+// Resize changes the cache size, returning number evicted.
+func (c *policyCache) Resize(size int) (evicted int) {
+	c.lock()
+	defer c.unlock()
+
+	evictedList := c.policy.resize(size)
+	for _, node := range evictedList {
+		c.unindex(node.getEntry())
+		c.evict(node.getEntry(), Evict_Capacity)
+	}
+
+	return len(evictedList)
+}
+
+// RemoveExpired removes the entries whose own ttl has passed, and the entries
+// not read for expireSeconds (expireSeconds <= 0 means only the former).
+func (c *policyCache) RemoveExpired(expireSeconds int) {
+	c.lock()
+	defer c.unlock()
+
+	now := time.Now()
+	minSaveTime := now.Unix() - int64(expireSeconds)
+
+	var expiredList []policyNode
+	c.policy.walk(func(node policyNode) {
+		ent := node.getEntry()
+		if ent.isExpired(now.UnixNano()) || (expireSeconds > 0 && ent.lastGetTime <= minSaveTime) {
+			expiredList = append(expiredList, node)
+		}
+	})
+
+	for _, node := range expiredList {
+		c.removeNode(node, Evict_Expired)
+	}
+}
+
+// getSub is GetSub without locking
+func (c *policyCache) getSub(mainKey string, subKey string) (value interface{}, ok bool) {
+	node, exists := c.items[mainKey][subKey]
+	if exists == false {
+		return nil, false
+	}
+
+	ent := node.getEntry()
+	now := time.Now()
+	if ent.isExpired(now.UnixNano()) {
+		c.removeNode(node, Evict_Expired)
+		return nil, false
+	}
+
+	ent.lastGetTime = now.Unix()
+	if ent.slidingTTL > 0 {
+		ent.expireTime = now.UnixNano() + ent.slidingTTL
+	}
+	c.policy.touch(node)
+
+	return ent.value, true
+}
+
+// removeNode removes node from the policy and the index
+func (c *policyCache) removeNode(node policyNode, reason EvictReason) {
+	c.policy.remove(node)
+	c.unindex(node.getEntry())
+	c.evict(node.getEntry(), reason)
+}
+
+// unindex removes ent from the index
+func (c *policyCache) unindex(ent *entry) {
+	mainEntry := c.items[ent.mainKey]
+	delete(mainEntry, ent.subKey)
+	if len(mainEntry) <= 0 {
+		delete(c.items, ent.mainKey)
+	}
+}
+
+// evict calls the eviction callback
+func (c *policyCache) evict(ent *entry, reason EvictReason) {
+	if c.onEvict != nil {
+		c.onEvict(ent.mainKey, ent.subKey, ent.value, reason)
+	}
+}
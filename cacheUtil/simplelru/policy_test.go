@@ -0,0 +1,130 @@
+package simplelru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicyList = []Policy{Policy_LRU, Policy_LFU, Policy_ARC, Policy_TinyLFU}
+
+// test that every policy keeps the size, reports evictions and supports ttl
+func TestPolicyBasic(t *testing.T) {
+	for _, policy := range testPolicyList {
+		evictCount := 0
+		l, err := NewCache(policy, 16, func(mainKey, subKey string, value interface{}, reason EvictReason) {
+			if reason == Evict_Capacity {
+				evictCount++
+			}
+		})
+		if err != nil {
+			t.Fatalf("%v err: %v", policy, err)
+		}
+
+		for i := 0; i < 64; i++ {
+			l.Set(fmt.Sprint(i), "", i)
+		}
+		if l.Len() != 16 || evictCount != 48 || len(l.Keys()) != 16 {
+			t.Fatalf("%v bad len: %v evict: %v", policy, l.Len(), evictCount)
+		}
+		for _, key := range l.Keys() {
+			if v, ok := l.Peek(key.MainKey, key.SubKey); !ok || fmt.Sprint(v) != key.MainKey {
+				t.Fatalf("%v bad key: %v", policy, key)
+			}
+		}
+
+		l.SetWithTTL("ttl", "1", 1, time.Millisecond, false)
+		l.SetWithTTL("ttl", "2", 2, time.Hour, false)
+		time.Sleep(5 * time.Millisecond)
+		if l.ContainsSub("ttl", "1") {
+			t.Fatalf("%v ttl should be expired", policy)
+		}
+		if value, ok := l.Get("ttl"); !ok || len(value) != 1 {
+			t.Fatalf("%v bad get: %v", policy, value)
+		}
+
+		l.Remove("ttl")
+		if l.Contains("ttl") {
+			t.Fatalf("%v should be removed", policy)
+		}
+
+		if _, _, _, ok := l.RemoveOldest(); !ok {
+			t.Fatalf("%v should remove oldest", policy)
+		}
+		l.Resize(4)
+		if l.Len() != 4 {
+			t.Fatalf("%v bad len after resize: %v", policy, l.Len())
+		}
+		l.Purge()
+		if l.Len() != 0 || len(l.Keys()) != 0 {
+			t.Fatalf("%v bad len after purge: %v", policy, l.Len())
+		}
+	}
+}
+
+// test that a scan of one-off keys does not flush frequently used keys
+func TestPolicyScanResistance(t *testing.T) {
+	for _, policy := range []Policy{Policy_LFU, Policy_ARC, Policy_TinyLFU} {
+		l, err := NewCache(policy, 100, nil)
+		if err != nil {
+			t.Fatalf("%v err: %v", policy, err)
+		}
+
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprint("hot", i)
+				if _, ok := l.GetSub(key, ""); !ok {
+					l.Set(key, "", i)
+				}
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			l.Set(fmt.Sprint("scan", i), "", i)
+		}
+
+		hit := 0
+		for i := 0; i < 50; i++ {
+			if l.ContainsSub(fmt.Sprint("hot", i), "") {
+				hit++
+			}
+		}
+		if hit < 45 {
+			t.Fatalf("%v hot keys were flushed by the scan, hit: %v", policy, hit)
+		}
+	}
+}
+
+// test that an unsynchronized cache works while its own lock is held, so it
+// never takes the lock
+func TestUnsynchronizedCache(t *testing.T) {
+	for _, policy := range testPolicyList {
+		l, err := NewUnsynchronizedCache(policy, 4, nil)
+		if err != nil {
+			t.Fatalf("%v err: %v", policy, err)
+		}
+
+		var locker sync.Locker
+		switch c := l.(type) {
+		case *LRU:
+			locker = c
+		case *policyCache:
+			locker = c
+		}
+		locker.Lock()
+
+		for i := 0; i < 4; i++ {
+			l.Set(fmt.Sprint(i), "", i)
+			l.Get(fmt.Sprint(i))
+		}
+		if l.Len() != 4 || !l.Contains("3") {
+			t.Fatalf("%v bad len: %v", policy, l.Len())
+		}
+		l.Remove("3")
+		if l.Len() != 3 {
+			t.Fatalf("%v bad len after remove: %v", policy, l.Len())
+		}
+
+		locker.Unlock()
+	}
+}
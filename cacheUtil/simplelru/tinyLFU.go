@@ -0,0 +1,295 @@
+package simplelru
+
+import "container/list"
+
+const (
+	// percent of the capacity used by the LRU window
+	tinyLFUWindowPercent = 1
+
+	// percent of the main space used by the protected segment
+	tinyLFUProtectedPercent = 80
+
+	// the counters of the sketch are halved after this many increments per entry
+	tinyLFUSampleFactor = 10
+)
+
+// segments of tinyLFUPolicy
+const (
+	tinyLFUWindow = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+// tinyLFUNode is an entry of tinyLFUPolicy
+type tinyLFUNode struct {
+	*entry
+
+	hash    uint64
+	segment int
+	elem    *list.Element
+}
+
+func (n *tinyLFUNode) getEntry() *entry {
+	return n.entry
+}
+
+// tinyLFUPolicy implements W-TinyLFU: new entries go to a small LRU window.
+// An entry leaving the window only enters the main segmented LRU if the
+// sketch says it is used more often than the entry it would replace, so a
+// scan of one-off keys cannot flush the frequently used ones.
+type tinyLFUPolicy struct {
+	windowSize    int
+	protectedSize int
+	mainSize      int
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+
+	sketch *countMinSketch
+}
+
+func newTinyLFUPolicy(size int) *tinyLFUPolicy {
+	p := &tinyLFUPolicy{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		sketch:    newCountMinSketch(size),
+	}
+	p.setSize(size)
+
+	return p
+}
+
+func (p *tinyLFUPolicy) push(ent *entry) (node policyNode, evicted []policyNode) {
+	newNode := &tinyLFUNode{
+		entry:   ent,
+		hash:    hashKey(ent.mainKey, ent.subKey),
+		segment: tinyLFUWindow,
+	}
+	p.sketch.increment(newNode.hash)
+	newNode.elem = p.window.PushFront(newNode)
+
+	if p.window.Len() <= p.windowSize {
+		return newNode, nil
+	}
+
+	candidate := p.window.Remove(p.window.Back()).(*tinyLFUNode)
+	if p.probation.Len()+p.protected.Len() < p.mainSize {
+		p.pushFront(p.probation, tinyLFUProbation, candidate)
+		return newNode, nil
+	}
+
+	victimList := p.probation
+	if victimList.Len() == 0 {
+		victimList = p.protected
+	}
+	victimElem := victimList.Back()
+	if victimElem == nil {
+		// there is no main space at all
+		return newNode, []policyNode{candidate}
+	}
+
+	victim := victimElem.Value.(*tinyLFUNode)
+	if p.sketch.estimate(candidate.hash) > p.sketch.estimate(victim.hash) {
+		victimList.Remove(victimElem)
+		p.pushFront(p.probation, tinyLFUProbation, candidate)
+		return newNode, []policyNode{victim}
+	}
+
+	return newNode, []policyNode{candidate}
+}
+
+func (p *tinyLFUPolicy) touch(node policyNode) {
+	tinyNode := node.(*tinyLFUNode)
+	p.sketch.increment(tinyNode.hash)
+
+	switch tinyNode.segment {
+	case tinyLFUWindow:
+		p.window.MoveToFront(tinyNode.elem)
+	case tinyLFUProtected:
+		p.protected.MoveToFront(tinyNode.elem)
+	case tinyLFUProbation:
+		// promote, demoting the least recently used protected entry if full
+		p.probation.Remove(tinyNode.elem)
+		p.pushFront(p.protected, tinyLFUProtected, tinyNode)
+		for p.protected.Len() > p.protectedSize {
+			demoted := p.protected.Remove(p.protected.Back()).(*tinyLFUNode)
+			p.pushFront(p.probation, tinyLFUProbation, demoted)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) remove(node policyNode) {
+	tinyNode := node.(*tinyLFUNode)
+	p.getList(tinyNode.segment).Remove(tinyNode.elem)
+}
+
+func (p *tinyLFUPolicy) victim() policyNode {
+	for _, l := range []*list.List{p.probation, p.protected, p.window} {
+		if elem := l.Back(); elem != nil {
+			return elem.Value.(*tinyLFUNode)
+		}
+	}
+
+	return nil
+}
+
+func (p *tinyLFUPolicy) walk(fn func(node policyNode)) {
+	for _, l := range []*list.List{p.probation, p.protected, p.window} {
+		for elem := l.Back(); elem != nil; elem = elem.Prev() {
+			fn(elem.Value.(*tinyLFUNode))
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) resize(size int) (evicted []policyNode) {
+	p.setSize(size)
+
+	for p.window.Len() > p.windowSize {
+		node := p.window.Remove(p.window.Back()).(*tinyLFUNode)
+		p.pushFront(p.probation, tinyLFUProbation, node)
+	}
+	for p.protected.Len() > p.protectedSize {
+		node := p.protected.Remove(p.protected.Back()).(*tinyLFUNode)
+		p.pushFront(p.probation, tinyLFUProbation, node)
+	}
+	for p.len() > size {
+		node := p.victim().(*tinyLFUNode)
+		p.remove(node)
+		evicted = append(evicted, node)
+	}
+
+	return
+}
+
+func (p *tinyLFUPolicy) len() int {
+	return p.window.Len() + p.probation.Len() + p.protected.Len()
+}
+
+func (p *tinyLFUPolicy) reset() {
+	p.window.Init()
+	p.probation.Init()
+	p.protected.Init()
+	p.sketch.reset()
+}
+
+// setSize splits size into the window and the main segments
+func (p *tinyLFUPolicy) setSize(size int) {
+	p.windowSize = size * tinyLFUWindowPercent / 100
+	if p.windowSize < 1 {
+		p.windowSize = 1
+	}
+	p.mainSize = size - p.windowSize
+	p.protectedSize = p.mainSize * tinyLFUProtectedPercent / 100
+}
+
+// pushFront adds node to the front of a segment
+func (p *tinyLFUPolicy) pushFront(l *list.List, segment int, node *tinyLFUNode) {
+	node.segment = segment
+	node.elem = l.PushFront(node)
+}
+
+// getList returns the list of a segment
+func (p *tinyLFUPolicy) getList(segment int) *list.List {
+	switch segment {
+	case tinyLFUWindow:
+		return p.window
+	case tinyLFUProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+// countMinSketch estimates how often a key was used, with 4 rows of 4-bit
+// counters. All counters are halved periodically so old popularity fades.
+type countMinSketch struct {
+	counters   []uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(size int) *countMinSketch {
+	width := 16
+	for width < size {
+		width <<= 1
+	}
+
+	return &countMinSketch{
+		counters:   make([]uint8, width*4),
+		mask:       uint64(width - 1),
+		sampleSize: size * tinyLFUSampleFactor,
+	}
+}
+
+// increment adds one use of the key with the given hash
+func (s *countMinSketch) increment(hash uint64) {
+	isAdded := false
+	for i := 0; i < 4; i++ {
+		index := s.index(hash, i)
+		if s.counters[index] < 15 {
+			s.counters[index]++
+			isAdded = true
+		}
+	}
+
+	if isAdded {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.halve()
+		}
+	}
+}
+
+// estimate returns how often the key with the given hash was used
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	result := uint8(15)
+	for i := 0; i < 4; i++ {
+		if value := s.counters[s.index(hash, i)]; value < result {
+			result = value
+		}
+	}
+
+	return result
+}
+
+// halve divides every counter by 2
+func (s *countMinSketch) halve() {
+	for i := range s.counters {
+		s.counters[i] >>= 1
+	}
+	s.additions /= 2
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.additions = 0
+}
+
+// index returns the position of the counter of row i
+func (s *countMinSketch) index(hash uint64, i int) int {
+	rowHash := (hash + uint64(i)*(hash>>32)) * 0x9E3779B97F4A7C15
+	return i*int(s.mask+1) + int((rowHash>>32)&s.mask)
+}
+
+// hashKey hashes (mainKey, subKey) with FNV-1a
+func hashKey(mainKey, subKey string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(mainKey); i++ {
+		hash ^= uint64(mainKey[i])
+		hash *= 1099511628211
+	}
+
+	hash ^= 0xff
+	hash *= 1099511628211
+	for i := 0; i < len(subKey); i++ {
+		hash ^= uint64(subKey[i])
+		hash *= 1099511628211
+	}
+
+	return hash
+}
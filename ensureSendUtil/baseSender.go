@@ -2,6 +2,11 @@ package ensureSendUtil
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/logUtil"
 )
 
 /*
@@ -12,19 +17,49 @@ type baseSender struct {
 	// 待发送的数据channel
 	waitingDataChan chan dataItem
 
-	// 失败数据缓存
-	cachedDataChan chan dataItem
+	// 发送失败等待重发的数据
+	retries *retryQueue
 
 	// 用于停止协程
 	done chan struct{}
+
+	// 数据目录
+	dataFolder string
+
+	// 发送器选项(已填充默认值)
+	option *SenderOption
+
+	// 预写日志，数据写入后才会放入待发送的数据channel
+	log *writeAheadLog
+
+	// 多次发送失败的数据的预写日志，需要时才打开
+	giveUpLog   *writeAheadLog
+	giveUpMutex sync.Mutex
+
+	// 根据原始数据创建dataItem
+	newItem func(string) (dataItem, error)
+
+	// 启动时预写日志中的下一条记录的序号，之前的未发送记录需要重发
+	replayEndSeq uint64
 }
 
-func newBaseSender() *baseSender {
+func newBaseSender(dataFolder string, option *SenderOption, newItem func(string) (dataItem, error)) (*baseSender, error) {
+	option = option.normalize()
+	log, err := openWAL(dataFolder, option.WAL)
+	if err != nil {
+		return nil, err
+	}
+
 	return &baseSender{
 		waitingDataChan: make(chan dataItem, 1024),
-		cachedDataChan:  make(chan dataItem, 1024000),
+		retries:         newRetryQueue(),
 		done:            make(chan struct{}),
-	}
+		dataFolder:      dataFolder,
+		option:          option,
+		log:             log,
+		newItem:         newItem,
+		replayEndSeq:    log.getNextSeq(),
+	}, nil
 }
 
 // Sender接口
@@ -42,9 +77,9 @@ func (this *baseSender) Data() <-chan dataItem {
 }
 
 // Sender接口
-// Cache：返回失败数据缓存channel
-func (this *baseSender) Cache() chan dataItem {
-	return this.cachedDataChan
+// Retries：返回重发队列
+func (this *baseSender) Retries() *retryQueue {
+	return this.retries
 }
 
 // Sender接口
@@ -52,3 +87,137 @@ func (this *baseSender) Cache() chan dataItem {
 func (this *baseSender) Done() <-chan struct{} {
 	return this.done
 }
+
+// Sender接口
+// Ack：确认数据已发送
+func (this *baseSender) Ack(item dataItem) {
+	this.log.ack(item.Seq())
+}
+
+// Sender接口
+// Retry：发送失败后按退避时间安排重发；超过最大发送次数或最长保留时间的数据交给死信处理，此时返回true
+func (this *baseSender) Retry(item dataItem, err error) (isDeadLetter bool) {
+	now := time.Now()
+	if item.Count() >= uint(this.option.MaxAttempts) ||
+		(this.option.MaxAge > 0 && now.Sub(item.CreateTime()) >= this.option.MaxAge) {
+		return this.reject(item, err)
+	}
+
+	this.retries.push(item, now.Add(this.option.backoff(item.Count())))
+	return false
+}
+
+// 不再重试，直接交给死信处理(如接收方明确拒绝的数据)；死信处理失败时继续重发，此时返回false
+func (this *baseSender) reject(item dataItem, err error) (isDeadLetter bool) {
+	e := this.deadLetter(item, err)
+	if e == nil {
+		return true
+	}
+
+	// 死信处理失败时继续重发
+	log := fmt.Sprintf("ensureSendUtil.baseSender.Retry: 死信处理失败，错误信息为：%s, Data:%s", e, item.String())
+	logUtil.NormalLog(log, logUtil.Error)
+
+	this.retries.push(item, time.Now().Add(this.option.backoff(item.Count())))
+	return false
+}
+
+// 死信处理：交给DeadLetter方法，未设置时保存到放弃目录中，之后不再重发
+func (this *baseSender) deadLetter(item dataItem, err error) (resultErr error) {
+	if this.option.DeadLetter == nil {
+		return this.giveUp(item)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			resultErr = fmt.Errorf("DeadLetter panic: %v", r)
+		}
+	}()
+
+	this.option.DeadLetter(item.String(), err)
+	this.log.ack(item.Seq())
+	return nil
+}
+
+// 将数据保存到放弃目录中
+func (this *baseSender) giveUp(item dataItem) error {
+	this.giveUpMutex.Lock()
+	defer this.giveUpMutex.Unlock()
+
+	if this.giveUpLog == nil {
+		giveUpLog, err := openWAL(filepath.Clean(this.dataFolder)+"_giveup", this.option.WAL)
+		if err != nil {
+			return err
+		}
+		this.giveUpLog = giveUpLog
+	}
+
+	if _, err := this.giveUpLog.append([]byte(item.String())); err != nil {
+		return err
+	}
+
+	this.log.ack(item.Seq())
+	return nil
+}
+
+// 写入数据：先写入预写日志，然后放入待发送的数据channel
+func (this *baseSender) write(data string) error {
+	item, err := this.newItem(data)
+	if err != nil {
+		return err
+	}
+
+	seq, err := this.log.append([]byte(data))
+	if err != nil {
+		return err
+	}
+	item.SetSeq(seq)
+
+	select {
+	case this.waitingDataChan <- item:
+	case <-this.done:
+		// 已经关闭，数据已在预写日志中，下次启动时发送
+	}
+
+	return nil
+}
+
+// 将上次未发送的数据放入待发送的数据channel(在单独的协程中调用)
+func (this *baseSender) replay() {
+	err := this.log.replay(this.replayEndSeq, func(seq uint64, data []byte) bool {
+		item, err := this.newItem(string(data))
+		if err != nil {
+			log := fmt.Sprintf("ensureSendUtil.baseSender.replay: Failed To Create Item: %s %s", err, string(data))
+			logUtil.NormalLog(log, logUtil.Error)
+			this.log.ack(seq)
+			return true
+		}
+		item.SetSeq(seq)
+
+		select {
+		case this.waitingDataChan <- item:
+			return true
+		case <-this.done:
+			return false
+		}
+	})
+	if err != nil {
+		log := fmt.Sprintf("ensureSendUtil.baseSender.replay: Failed To Read %s: %s", this.dataFolder, err)
+		logUtil.NormalLog(log, logUtil.Error)
+	}
+}
+
+// 关闭预写日志，未发送的数据会在下次启动时发送
+func (this *baseSender) closeLog() error {
+	err := this.log.close()
+
+	this.giveUpMutex.Lock()
+	defer this.giveUpMutex.Unlock()
+	if this.giveUpLog != nil {
+		if e := this.giveUpLog.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
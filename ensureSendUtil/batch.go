@@ -0,0 +1,90 @@
+package ensureSendUtil
+
+import (
+	"sync"
+	"time"
+)
+
+// 将数据凑成批次：数量达到批次大小或等待超过指定时间后调用发送方法
+// 发送方法在持有锁时调用，同一时刻只会发送一个批次
+type batcher struct {
+	// 批次的最大数据条数
+	size int
+
+	// 凑批次的最长等待时间
+	delay time.Duration
+
+	// 发送方法
+	send func([]dataItem)
+
+	// 锁对象
+	mutex sync.Mutex
+
+	// 正在凑批次的数据
+	itemList []dataItem
+
+	// 凑批次的定时器
+	timer *time.Timer
+
+	// 是否已停止
+	isStopped bool
+}
+
+func newBatcher(size int, delay time.Duration, send func([]dataItem)) *batcher {
+	return &batcher{
+		size:  size,
+		delay: delay,
+		send:  send,
+	}
+}
+
+// 加入数据
+func (this *batcher) add(item dataItem) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.isStopped {
+		return
+	}
+
+	this.itemList = append(this.itemList, item)
+	if len(this.itemList) >= this.size {
+		this.flush()
+	} else if this.timer == nil {
+		this.timer = time.AfterFunc(this.delay, func() {
+			this.mutex.Lock()
+			defer this.mutex.Unlock()
+			this.flush()
+		})
+	}
+}
+
+// 发送正在凑批次的数据(需要持有锁)
+func (this *batcher) flush() {
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+
+	itemList := this.itemList
+	this.itemList = nil
+	if len(itemList) == 0 || this.isStopped {
+		return
+	}
+
+	this.send(itemList)
+}
+
+// 停止并丢弃正在凑批次的数据(数据已在预写日志中，下次启动时发送)
+// 返回时正在进行的发送已经完成
+func (this *batcher) stop() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.isStopped = true
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+	this.itemList = nil
+}
@@ -1,6 +1,8 @@
 package ensureSendUtil
 
 import (
+	"time"
+
 	"github.com/Jordan/goutil/zlibUtil"
 )
 
@@ -16,6 +18,15 @@ type dataItem interface {
 
 	// 返回发送次数
 	Count() uint
+
+	// 设置在预写日志中的序号
+	SetSeq(uint64)
+
+	// 返回在预写日志中的序号
+	Seq() uint64
+
+	// 返回创建时间
+	CreateTime() time.Time
 }
 
 /////////////////////////////////////////////////
@@ -27,12 +38,19 @@ type httpDataItem struct {
 
 	// 发送次数
 	count uint
+
+	// 在预写日志中的序号
+	seq uint64
+
+	// 创建时间
+	createTime time.Time
 }
 
 func newHTTPData(_data string) dataItem {
 	return &httpDataItem{
-		data:  _data,
-		count: 0,
+		data:       _data,
+		count:      0,
+		createTime: time.Now(),
 	}
 }
 
@@ -54,6 +72,18 @@ func (this *httpDataItem) Count() uint {
 	return this.count
 }
 
+func (this *httpDataItem) SetSeq(seq uint64) {
+	this.seq = seq
+}
+
+func (this *httpDataItem) Seq() uint64 {
+	return this.seq
+}
+
+func (this *httpDataItem) CreateTime() time.Time {
+	return this.createTime
+}
+
 /////////////////////////////////////////////////
 // tcpDataItem
 
@@ -66,6 +96,12 @@ type tcpDataItem struct {
 
 	// 重试次数
 	count uint
+
+	// 在预写日志中的序号
+	seq uint64
+
+	// 创建时间
+	createTime time.Time
 }
 
 func newTCPDataItem(_data string) (dataItem, error) {
@@ -75,9 +111,10 @@ func newTCPDataItem(_data string) (dataItem, error) {
 	}
 
 	item := &tcpDataItem{
-		origin: _data,
-		data:   compressed,
-		count:  0,
+		origin:     _data,
+		data:       compressed,
+		count:      0,
+		createTime: time.Now(),
 	}
 	return item, nil
 }
@@ -99,3 +136,15 @@ func (this *tcpDataItem) SetCount(cnt uint) {
 func (this *tcpDataItem) Count() uint {
 	return this.count
 }
+
+func (this *tcpDataItem) SetSeq(seq uint64) {
+	this.seq = seq
+}
+
+func (this *tcpDataItem) Seq() uint64 {
+	return this.seq
+}
+
+func (this *tcpDataItem) CreateTime() time.Time {
+	return this.createTime
+}
@@ -2,7 +2,18 @@ package ensureSendUtil
 
 /*
 ensureSendUtil 用于推送数据
-支持TCP和HTTP两种形式，在发送失败时会缓存数据，并在一定时间间隔后重试
+支持TCP、HTTP、Redis列表/流和本地文件等形式，在发送失败时会缓存数据，并按指数退避(可加随机浮动)分别为每条数据安排重试，
+超过最大发送次数或最长保留时间的数据交给死信处理(见SenderOption)
+数据在Write返回前先写入数据目录中的预写日志(按段追加，落盘策略见WALOption)，发送成功后推进已发送序号并删除已发送完成的段，
+重启后会重发未发送的数据；未设置死信处理方法时，放弃的数据保存到"数据目录_giveup"中
+
+TCP模式使用带确认的分帧协议(见tcpProtocol.go)：数据按批次发送，每条数据带有预写日志中的序号，
+接收方处理完批次后回复确认，发送器收到确认后才认为数据发送成功；连接断开或确认超时时重发未确认的数据
+接收方可以使用TCPReceiver：
+func NewTCPReceiver(_address string, _handler func(seqList []uint64, dataList []string) error) (*TCPReceiver, error) {
+
+HTTP模式可以通过SenderOption.HTTP(HTTPOption)设置请求头、Content-Type、HmacSha256签名、gzip压缩、
+将多条数据作为JSON数组批量发送，以及判断请求是否成功的方法；状态码为4xx的数据直接交给死信处理，其它失败等待重发
 
 通过NewTCPSender和NewHTTPSender两个接口分别创建TCP和HTTP模式的EnsureSender
 
@@ -26,4 +37,24 @@ func NewTCPSender(_dataFolder, _address string) (EnsureSender, error) {
 //      _dataFolder  数据存放目录
 //      _url         发送地址
 func NewHTTPSender(_dataFolder, _url string) (EnsureSender, error) {
+
+// NewTCPSender2和NewHTTPSender2可以通过SenderOption指定预写日志的段大小和落盘策略，重试和死信策略，TCP的批次大小和确认超时，以及HTTP的请求选项
+func NewTCPSender2(_dataFolder, _address string, _option *SenderOption) (EnsureSender, error) {
+func NewHTTPSender2(_dataFolder, _url string, _option *SenderOption) (EnsureSender, error) {
+
+其它传输方式实现Transport接口后通过NewSender创建发送器，与TCP、HTTP发送器使用相同的预写日志、批次、重发和死信处理逻辑：
+type Transport interface {
+    // 发送一个批次的数据，返回Reject包装的错误表示数据被拒绝，批次会逐条重发，单条被拒绝的数据交给死信处理
+    Send(dataList []string) error
+
+    // 关闭
+    Close() error
+}
+func NewSender(_dataFolder string, _transport Transport, _option *SenderOption) (EnsureSender, error) {
+
+内置的传输方式：
+func NewRedisListSender(_dataFolder string, _redisPool *redisUtil.RedisPool, _key string, _option *SenderOption) (EnsureSender, error) {
+func NewRedisStreamSender(_dataFolder string, _redisPool *redisUtil.RedisPool, _key, _field string, _maxLen int64, _option *SenderOption) (EnsureSender, error) {
+// 文件中每条数据占一行，数据中的\、换行符和回车符分别写为\\、\n和\r
+func NewFileSender(_dataFolder, _path, _fileNamePrefix string, _maxFileSize int, _option *SenderOption) (EnsureSender, error) {
 */
@@ -1,5 +1,7 @@
 package ensureSendUtil
 
+import "time"
+
 type EnsureSender interface {
 	// use Write to send data
 	Write(string) error
@@ -8,6 +10,45 @@ type EnsureSender interface {
 	Close() error
 }
 
+// 发送器选项，未设置的字段使用默认值
+type SenderOption struct {
+	// 预写日志选项
+	WAL WALOption
+
+	// HTTP发送器选项
+	HTTP HTTPOption
+
+	// 最大发送次数，发送失败这么多次后交给死信处理，<=0表示使用默认值(3)
+	MaxAttempts int
+
+	// 第一次失败后的重发等待时间，<=0表示使用默认值(1秒)
+	InitialBackoff time.Duration
+
+	// 每次失败后等待时间的倍数，<1表示使用默认值(2)
+	BackoffMultiplier float64
+
+	// 最长的重发等待时间，<=0表示使用默认值(5分钟，debug模式为1秒)
+	MaxBackoff time.Duration
+
+	// 等待时间的随机浮动比例(0~1)，如0.2表示在0.8~1.2倍之间浮动，用于避免大量数据同时重发；0表示不浮动
+	Jitter float64
+
+	// 数据的最长保留时间(从写入或重启后加载时开始计算)，超过后交给死信处理，<=0表示不限制
+	MaxAge time.Duration
+
+	// 死信处理方法，参数为原始数据和最后一次发送的错误；nil表示保存到"数据目录_giveup"中
+	DeadLetter func(data string, err error)
+
+	// TCP发送器和NewSender创建的发送器每个批次的最大数据条数，<=0表示使用默认值(100)
+	BatchSize int
+
+	// 凑批次的最长等待时间(TCP发送器以及HTTP批量发送时使用)，<=0表示使用默认值(10毫秒)
+	BatchDelay time.Duration
+
+	// TCP发送器等待接收方确认的最长时间，超时后断开连接并重发，<=0表示使用默认值(30秒)
+	AckTimeout time.Duration
+}
+
 // resend和dataSaver通过此接口调用tcpSender与httpSender
 type sender interface {
 	// 发送数据
@@ -16,9 +57,15 @@ type sender interface {
 	// 返回待发送的数据channel
 	Data() <-chan dataItem
 
-	// 返回失败数据缓存channel
-	Cache() chan dataItem
+	// 返回重发队列
+	Retries() *retryQueue
 
 	// 用于判断是否关闭
 	Done() <-chan struct{}
+
+	// 确认数据已发送，之后不再重发
+	Ack(dataItem)
+
+	// 发送失败后安排重发，交给死信处理时返回true
+	Retry(dataItem, error) bool
 }
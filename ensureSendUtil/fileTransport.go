@@ -0,0 +1,73 @@
+package ensureSendUtil
+
+import (
+	"strings"
+
+	"github.com/polariseye/goutil/fileUtil"
+)
+
+// 写入文件前对数据中的反斜杠和换行符转义，保证一条数据只占一行
+var fileRecordEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// 将数据逐行写入本地文件，文件达到指定大小后切换到新文件
+type fileTransport struct {
+	bigFile *fileUtil.BigFile
+}
+
+// 创建本地文件传输方式
+// 文件格式：每条数据占一行(以\n结尾)，数据中的\、换行符和回车符分别写为\\、\n和\r，读取时按行拆分后反转义即可
+// 参数：
+//      _path            文件夹路径
+//      _fileNamePrefix  文件名称前缀
+//      _maxFileSize     单个文件大小的最大值（单位：Byte）
+func NewFileTransport(_path, _fileNamePrefix string, _maxFileSize int) (Transport, error) {
+	bigFile, err := fileUtil.NewBigFile2(_path, _fileNamePrefix, _maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTransport{
+		bigFile: bigFile,
+	}, nil
+}
+
+// Transport接口
+// Send：每条数据转义后写入一行
+func (this *fileTransport) Send(dataList []string) error {
+	for _, data := range dataList {
+		if err := this.bigFile.SaveMessage(fileRecordEscaper.Replace(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transport接口
+// Close：关闭文件
+func (this *fileTransport) Close() error {
+	this.bigFile.Close()
+	return nil
+}
+
+// 创建一个将数据写入本地文件的发送器
+// 参数：
+//      _dataFolder      数据存放目录(预写日志)
+//      _path            文件夹路径
+//      _fileNamePrefix  文件名称前缀
+//      _maxFileSize     单个文件大小的最大值（单位：Byte）
+//      _option          发送器选项，nil表示使用默认值
+func NewFileSender(_dataFolder, _path, _fileNamePrefix string, _maxFileSize int, _option *SenderOption) (EnsureSender, error) {
+	transport, err := NewFileTransport(_path, _fileNamePrefix, _maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := NewSender(_dataFolder, transport, _option)
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+
+	return sender, nil
+}
@@ -1,11 +1,45 @@
 package ensureSendUtil
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
+	"github.com/polariseye/goutil/securityUtil"
 	"github.com/polariseye/goutil/webUtil"
 )
 
+// 默认的签名头
+const con_DEFAULT_SIGNATURE_HEADER = "X-Signature"
+
+// HTTP发送器选项，未设置的字段使用默认值
+type HTTPOption struct {
+	// 每个请求附带的头部
+	Header map[string]string
+
+	// Content-Type，为空时不设置(批量发送时默认为application/json)
+	ContentType string
+
+	// 签名密钥，不为空时对请求内容(压缩后)计算HmacSha256，以16进制放入签名头中
+	SignKey string
+
+	// 签名头，为空表示使用默认值(X-Signature)
+	SignatureHeader string
+
+	// 是否使用gzip压缩请求内容，压缩时设置Content-Encoding: gzip
+	Gzip bool
+
+	// 每个请求包含的最大数据条数，>1时将多条数据作为字符串放入一个JSON数组中发送，凑批次的等待时间见SenderOption.BatchDelay；
+	// <=1表示每条数据单独发送原始内容
+	BatchSize int
+
+	// 判断请求是否成功，nil表示状态码为200时成功
+	// 失败时状态码为4xx的数据直接交给死信处理(多条数据的批次被拒绝时先逐条重发，以找出被拒绝的数据)，其它数据等待重发
+	IsSuccess func(statusCode int, result []byte) bool
+}
+
 // 实现 EnsureSender和sender接口
 type httpSender struct {
 	// 需要实现的接口
@@ -20,6 +54,9 @@ type httpSender struct {
 	// 发送地址
 	url string
 
+	// 将数据凑成批次发送，不批量发送时为nil
+	batcher *batcher
+
 	// 用于sendLoop和resendLoop发送退出信号
 	closeSignal chan struct{}
 }
@@ -29,18 +66,44 @@ type httpSender struct {
 //      _dataFolder  数据存放目录
 //      _url         发送地址
 func NewHTTPSender(_dataFolder, _url string) (EnsureSender, error) {
+	return NewHTTPSender2(_dataFolder, _url, nil)
+}
+
+// 创建一个http数据发送器
+// 参数：
+//      _dataFolder  数据存放目录(预写日志)
+//      _url         发送地址
+//      _option      发送器选项，nil表示使用默认值
+func NewHTTPSender2(_dataFolder, _url string, _option *SenderOption) (EnsureSender, error) {
+	if _option == nil {
+		_option = &SenderOption{}
+	}
+
+	base, err := newBaseSender(_dataFolder, _option, func(data string) (dataItem, error) {
+		return newHTTPData(data), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	this := &httpSender{
 		dataFolder:  _dataFolder,
 		url:         _url,
-		baseSender:  newBaseSender(),
+		baseSender:  base,
 		closeSignal: make(chan struct{}),
 	}
+	if this.option.HTTP.BatchSize > 1 {
+		this.batcher = newBatcher(this.option.HTTP.BatchSize, this.option.BatchDelay, this.sendBatch)
+	}
+
+	// 重发上次未发送的数据
+	go this.replay()
 
 	// 新开协程发送数据
 	go sendLoop(this, this.closeSignal)
 
 	// 定时重发
-	go resendLoop(this, _dataFolder, this.closeSignal)
+	go resendLoop(this, this.closeSignal)
 
 	return this, nil
 }
@@ -48,11 +111,7 @@ func NewHTTPSender(_dataFolder, _url string) (EnsureSender, error) {
 // EnsureSender接口
 // Write：写入数据
 func (this *httpSender) Write(data string) error {
-	item := newHTTPData(data)
-
-	this.waitingDataChan <- item
-
-	return nil
+	return this.write(data)
 }
 
 // EnsureSender接口
@@ -64,32 +123,141 @@ func (this *httpSender) Close() error {
 	<-this.closeSignal
 	<-this.closeSignal
 
-	// 保存数据
-	_, e1 := saveData(this.Cache(), this.dataFolder)
-	_, e2 := saveData(this.Data(), this.dataFolder)
-
-	if e2 != nil {
-		if e1 != nil {
-			return fmt.Errorf("%s %s", e1, e2)
-		}
-		return e2
-	} else {
-		return e1
+	// 丢弃正在凑批次的数据
+	if this.batcher != nil {
+		this.batcher.stop()
 	}
+
+	// 未发送的数据已在预写日志中，下次启动时发送
+	return this.closeLog()
 }
 
 // sender接口
 // Send：发送数据
 func (this *httpSender) Send(item dataItem) error {
-	statusCode, _, err := webUtil.PostByteData2(this.url, item.Bytes(), nil, nil)
-	if err != nil || statusCode != 200 {
+	if this.batcher != nil {
+		this.batcher.add(item)
+		return errSendPending
+	}
+
+	isRejected, err := this.post(item.Bytes(), this.option.HTTP.ContentType)
+	if err == nil {
+		return nil
+	}
+
+	if isRejected {
+		this.reject(item, err)
+		return errSendPending
+	}
+
+	// 发送失败时发送次数+1
+	item.SetCount(item.Count() + 1)
+	return err
+}
+
+// 将一个批次的数据作为JSON数组发送
+func (this *httpSender) sendBatch(itemList []dataItem) {
+	// 已关闭的数据在下次启动时发送
+	select {
+	case <-this.Done():
+		return
+	default:
+	}
+
+	dataList := make([]string, 0, len(itemList))
+	for _, item := range itemList {
+		dataList = append(dataList, item.String())
+	}
+
+	contentType := this.option.HTTP.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	data, err := json.Marshal(dataList)
+	isRejected := false
+	if err == nil {
+		isRejected, err = this.post(data, contentType)
+	}
+
+	// 整个批次被拒绝时逐条重发，只将被拒绝的数据交给死信处理
+	if isRejected && len(itemList) > 1 {
+		for _, item := range itemList {
+			this.sendBatch([]dataItem{item})
+		}
+		return
+	}
+
+	for _, item := range itemList {
 		if err == nil {
-			err = fmt.Errorf("StatusCode is not 200")
+			this.Ack(item)
+		} else if isRejected {
+			this.reject(item, err)
+		} else {
+			// 发送失败时发送次数+1
+			item.SetCount(item.Count() + 1)
+			this.Retry(item, err)
 		}
+	}
+}
 
-		// 发送失败时发送次数+1
-		item.SetCount(item.Count() + 1)
+// 发送请求
+// 参数：
+// data:请求内容
+// contentType:Content-Type，为空时不设置
+// 返回值:
+// 是否被接收方拒绝(状态码为4xx)，被拒绝的数据不再重发
+// 错误对象
+func (this *httpSender) post(data []byte, contentType string) (isRejected bool, err error) {
+	option := &this.option.HTTP
+	header := make(map[string]string, len(option.Header)+3)
+	for k, v := range option.Header {
+		header[k] = v
+	}
+	if contentType != "" {
+		header["Content-Type"] = contentType
 	}
 
-	return err
+	if option.Gzip {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err = writer.Write(data); err != nil {
+			return
+		}
+		if err = writer.Close(); err != nil {
+			return
+		}
+
+		data = buffer.Bytes()
+		header["Content-Encoding"] = "gzip"
+	}
+
+	if option.SignKey != "" {
+		var sign []byte
+		if sign, err = securityUtil.HmacSha256(string(data), option.SignKey); err != nil {
+			return
+		}
+
+		signatureHeader := option.SignatureHeader
+		if signatureHeader == "" {
+			signatureHeader = con_DEFAULT_SIGNATURE_HEADER
+		}
+		header[signatureHeader] = hex.EncodeToString(sign)
+	}
+
+	statusCode, result, err := webUtil.PostByteData2(this.url, data, header, nil)
+	if err != nil {
+		return
+	}
+
+	isSuccess := statusCode == 200
+	if option.IsSuccess != nil {
+		isSuccess = option.IsSuccess(statusCode, result)
+	}
+	if isSuccess == false {
+		err = fmt.Errorf("StatusCode is %d", statusCode)
+		isRejected = statusCode >= 400 && statusCode < 500
+	}
+
+	return
 }
@@ -1,13 +1,21 @@
 package ensureSendUtil
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/polariseye/goutil/debugUtil"
+	"github.com/polariseye/goutil/securityUtil"
 )
 
 // 保存接收的数据用于校验
@@ -30,9 +38,9 @@ func (ctx *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 	} else {
 		ctx.cnt++
-		// 模拟一次失败
+		// 模拟一次服务器错误
 		if ctx.cnt == 2 {
-			http.NotFound(w, r)
+			w.WriteHeader(http.StatusInternalServerError)
 		} else {
 			http_recv_msg = append(http_recv_msg, result...)
 		}
@@ -56,7 +64,7 @@ func Test_http(t *testing.T) {
 
 	time.Sleep(time.Millisecond)
 
-	// 发送消息，此数据会多次失败，被丢弃到giveup目录
+	// 发送消息，此数据被拒绝(404)，直接丢弃到giveup目录
 	httpSender.Write("http-msg-failed")
 
 	time.Sleep(time.Second * 4)
@@ -84,3 +92,88 @@ func Test_http(t *testing.T) {
 		fmt.Println("HTTP OK")
 	}
 }
+
+func Test_httpOption(t *testing.T) {
+	folder := "./test_http_option"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	var mutex sync.Mutex
+	var recvList []string
+	var errList []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		sign, _ := securityUtil.HmacSha256(string(body), "secret")
+		if r.Header.Get("X-Signature") != hex.EncodeToString(sign) || r.Header.Get("X-App") != "test" ||
+			r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Content-Encoding") != "gzip" {
+			errList = append(errList, fmt.Sprint(r.Header))
+		}
+
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			errList = append(errList, err.Error())
+			return
+		}
+		body, _ = ioutil.ReadAll(reader)
+
+		var dataList []string
+		if err = json.Unmarshal(body, &dataList); err != nil {
+			errList = append(errList, err.Error())
+			return
+		}
+
+		// 含有bad的批次被拒绝，之后逐条重发时只有bad被拒绝
+		for _, data := range dataList {
+			if data == "bad" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		recvList = append(recvList, dataList...)
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer server.Close()
+
+	var deadLetterList []string
+	sender, err := NewHTTPSender2(folder, server.URL, &SenderOption{
+		BatchDelay: 50 * time.Millisecond,
+		HTTP: HTTPOption{
+			Header:    map[string]string{"X-App": "test"},
+			SignKey:   "secret",
+			Gzip:      true,
+			BatchSize: 3,
+			IsSuccess: func(statusCode int, result []byte) bool {
+				return statusCode == 200 && string(result) == `{"code":0}`
+			},
+		},
+		DeadLetter: func(data string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			deadLetterList = append(deadLetterList, data)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"a", "b", "c", "bad", "d"} {
+		sender.Write(data)
+	}
+	time.Sleep(500 * time.Millisecond)
+	sender.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(errList) > 0 {
+		t.Fatalf("bad requests: %v", errList)
+	}
+	if fmt.Sprint(recvList) != "[a b c d]" {
+		t.Fatalf("bad data: %v", recvList)
+	}
+	if fmt.Sprint(deadLetterList) != "[bad]" {
+		t.Fatalf("bad dead letters: %v", deadLetterList)
+	}
+}
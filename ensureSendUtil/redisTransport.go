@@ -0,0 +1,122 @@
+package ensureSendUtil
+
+import (
+	"github.com/polariseye/goutil/redisUtil"
+)
+
+// 通过RPUSH将数据追加到Redis列表中
+type redisListTransport struct {
+	redisPool *redisUtil.RedisPool
+
+	// 列表的key
+	key string
+}
+
+// 创建Redis列表传输方式，每个批次通过一次RPUSH追加到列表末尾
+// 参数：
+//      _redisPool   Redis连接池，关闭发送器时不会关闭
+//      _key         列表的key
+func NewRedisListTransport(_redisPool *redisUtil.RedisPool, _key string) Transport {
+	return &redisListTransport{
+		redisPool: _redisPool,
+		key:       _key,
+	}
+}
+
+// Transport接口
+// Send：发送数据
+func (this *redisListTransport) Send(dataList []string) error {
+	_, err := this.redisPool.RPush(this.key, dataList...)
+	return err
+}
+
+// Transport接口
+// Close：关闭
+func (this *redisListTransport) Close() error {
+	return nil
+}
+
+// 创建一个将数据追加到Redis列表中的发送器
+// 参数：
+//      _dataFolder  数据存放目录(预写日志)
+//      _redisPool   Redis连接池，关闭发送器时不会关闭
+//      _key         列表的key
+//      _option      发送器选项，nil表示使用默认值
+func NewRedisListSender(_dataFolder string, _redisPool *redisUtil.RedisPool, _key string, _option *SenderOption) (EnsureSender, error) {
+	return NewSender(_dataFolder, NewRedisListTransport(_redisPool, _key), _option)
+}
+
+// 通过XADD将数据添加到Redis流中
+type redisStreamTransport struct {
+	redisPool *redisUtil.RedisPool
+
+	// 流的key
+	key string
+
+	// 数据所在的字段
+	field string
+
+	// 流的最大长度(近似裁剪)，<=0表示不裁剪
+	maxLen int64
+}
+
+// 创建Redis流传输方式，每个批次通过管道执行XADD，每条数据一个消息
+// 参数：
+//      _redisPool   Redis连接池，关闭发送器时不会关闭
+//      _key         流的key
+//      _field       数据所在的字段
+//      _maxLen      流的最大长度(近似裁剪)，<=0表示不裁剪
+func NewRedisStreamTransport(_redisPool *redisUtil.RedisPool, _key, _field string, _maxLen int64) Transport {
+	return &redisStreamTransport{
+		redisPool: _redisPool,
+		key:       _key,
+		field:     _field,
+		maxLen:    _maxLen,
+	}
+}
+
+// Transport接口
+// Send：发送数据，部分消息添加失败时整个批次重发(已添加的消息会重复)
+func (this *redisStreamTransport) Send(dataList []string) error {
+	pipeline := this.redisPool.NewPipeline()
+	replyList := make([]*redisUtil.Reply, 0, len(dataList))
+	for _, data := range dataList {
+		args := make([]interface{}, 0, 7)
+		args = append(args, this.key)
+		if this.maxLen > 0 {
+			args = append(args, "MAXLEN", "~", this.maxLen)
+		}
+		args = append(args, "*", this.field, data)
+
+		replyList = append(replyList, pipeline.Do("XADD", args...))
+	}
+
+	if err := pipeline.Exec(); err != nil {
+		return err
+	}
+	for _, reply := range replyList {
+		if err := reply.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transport接口
+// Close：关闭
+func (this *redisStreamTransport) Close() error {
+	return nil
+}
+
+// 创建一个将数据添加到Redis流中的发送器
+// 参数：
+//      _dataFolder  数据存放目录(预写日志)
+//      _redisPool   Redis连接池，关闭发送器时不会关闭
+//      _key         流的key
+//      _field       数据所在的字段
+//      _maxLen      流的最大长度(近似裁剪)，<=0表示不裁剪
+//      _option      发送器选项，nil表示使用默认值
+func NewRedisStreamSender(_dataFolder string, _redisPool *redisUtil.RedisPool, _key, _field string, _maxLen int64, _option *SenderOption) (EnsureSender, error) {
+	return NewSender(_dataFolder, NewRedisStreamTransport(_redisPool, _key, _field, _maxLen), _option)
+}
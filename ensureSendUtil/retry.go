@@ -0,0 +1,204 @@
+package ensureSendUtil
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/debugUtil"
+)
+
+const (
+	// 默认的最大发送次数
+	con_DEFAULT_MAX_ATTEMPTS = 3
+
+	// 默认的第一次重发前的等待时间
+	con_DEFAULT_INITIAL_BACKOFF = time.Second
+
+	// 默认的等待时间倍数
+	con_DEFAULT_BACKOFF_MULTIPLIER = 2
+
+	// 默认的最长等待时间
+	con_DEFAULT_MAX_BACKOFF = 5 * time.Minute
+
+	// 默认的批次最大数据条数
+	con_DEFAULT_BATCH_SIZE = 100
+
+	// 默认的凑批次等待时间
+	con_DEFAULT_BATCH_DELAY = 10 * time.Millisecond
+
+	// 默认的确认超时时间
+	con_DEFAULT_ACK_TIMEOUT = 30 * time.Second
+)
+
+// 获取填充了默认值的选项
+func (this *SenderOption) normalize() *SenderOption {
+	result := SenderOption{}
+	if this != nil {
+		result = *this
+	}
+
+	if result.MaxAttempts <= 0 {
+		result.MaxAttempts = con_DEFAULT_MAX_ATTEMPTS
+	}
+	if result.InitialBackoff <= 0 {
+		result.InitialBackoff = con_DEFAULT_INITIAL_BACKOFF
+	}
+	if result.BackoffMultiplier < 1 {
+		result.BackoffMultiplier = con_DEFAULT_BACKOFF_MULTIPLIER
+	}
+	if result.MaxBackoff <= 0 {
+		// debug模式每秒重试1次
+		if debugUtil.IsDebug() {
+			result.MaxBackoff = time.Second
+		} else {
+			result.MaxBackoff = con_DEFAULT_MAX_BACKOFF
+		}
+	}
+	if result.MaxBackoff < result.InitialBackoff {
+		result.InitialBackoff = result.MaxBackoff
+	}
+	if result.Jitter < 0 {
+		result.Jitter = 0
+	} else if result.Jitter > 1 {
+		result.Jitter = 1
+	}
+	if result.BatchSize <= 0 {
+		result.BatchSize = con_DEFAULT_BATCH_SIZE
+	}
+	if result.BatchDelay <= 0 {
+		result.BatchDelay = con_DEFAULT_BATCH_DELAY
+	}
+	if result.AckTimeout <= 0 {
+		result.AckTimeout = con_DEFAULT_ACK_TIMEOUT
+	}
+
+	return &result
+}
+
+// 获取第attempt次发送失败后的等待时间
+func (this *SenderOption) backoff(attempt uint) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(this.InitialBackoff) * math.Pow(this.BackoffMultiplier, float64(attempt-1))
+	if delay > float64(this.MaxBackoff) {
+		delay = float64(this.MaxBackoff)
+	}
+	if this.Jitter > 0 {
+		delay *= 1 + this.Jitter*(rand.Float64()*2-1)
+	}
+
+	return time.Duration(delay)
+}
+
+// 等待重发的数据
+type retryItem struct {
+	item dataItem
+
+	// 重发时间
+	retryTime time.Time
+}
+
+// 按重发时间排序的最小堆
+type retryHeap []*retryItem
+
+func (h retryHeap) Len() int {
+	return len(h)
+}
+
+func (h retryHeap) Less(i, j int) bool {
+	return h[i].retryTime.Before(h[j].retryTime)
+}
+
+func (h retryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *retryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*retryItem))
+}
+
+func (h *retryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// 重发队列，每条数据有各自的重发时间
+type retryQueue struct {
+	mutex sync.Mutex
+	heap  retryHeap
+
+	// 加入了比原来更早重发的数据时通知重发协程
+	notify chan struct{}
+}
+
+func newRetryQueue() *retryQueue {
+	return &retryQueue{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// 加入数据
+// item:数据
+// retryTime:重发时间
+func (this *retryQueue) push(item dataItem, retryTime time.Time) {
+	this.mutex.Lock()
+	heap.Push(&this.heap, &retryItem{
+		item:      item,
+		retryTime: retryTime,
+	})
+	isFirst := this.heap[0].item == item
+	this.mutex.Unlock()
+
+	if isFirst {
+		select {
+		case this.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 取出已到重发时间的数据
+// now:当前时间
+// 返回值:
+// 数据列表
+func (this *retryQueue) popDue(now time.Time) (itemList []dataItem) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for len(this.heap) > 0 && this.heap[0].retryTime.After(now) == false {
+		itemList = append(itemList, heap.Pop(&this.heap).(*retryItem).item)
+	}
+
+	return
+}
+
+// 获取距离下一条数据重发的时间
+// 返回值:
+// 等待时间
+// 是否有数据
+func (this *retryQueue) nextDelay() (time.Duration, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.heap) == 0 {
+		return 0, false
+	}
+
+	return time.Until(this.heap[0].retryTime), true
+}
+
+// 获取数据数量
+func (this *retryQueue) len() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.heap)
+}
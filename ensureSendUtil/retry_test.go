@@ -0,0 +1,74 @@
+package ensureSendUtil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_backoff(t *testing.T) {
+	option := (&SenderOption{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         0.2,
+	}).normalize()
+
+	for attempt, expected := range []time.Duration{100, 100, 200, 400, 800, 1000, 1000} {
+		expected *= time.Millisecond
+		delay := option.backoff(uint(attempt))
+		if delay < expected*8/10 || delay > expected*12/10 {
+			t.Errorf("attempt %d: delay %v not around %v", attempt, delay, expected)
+		}
+	}
+}
+
+func Test_retry(t *testing.T) {
+	folder := "./test_retry"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	var requestCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var mutex sync.Mutex
+	var deadLetterList []string
+	var deadLetterTime time.Time
+	startTime := time.Now()
+	sender, err := NewHTTPSender2(folder, server.URL, &SenderOption{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		DeadLetter: func(data string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			deadLetterList = append(deadLetterList, data)
+			deadLetterTime = time.Now()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	sender.Write("retry-msg")
+	time.Sleep(time.Second)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(deadLetterList) != 1 || deadLetterList[0] != "retry-msg" {
+		t.Fatalf("bad dead letters: %v", deadLetterList)
+	}
+	if count := atomic.LoadInt32(&requestCount); count != 3 {
+		t.Fatalf("bad request count: %d", count)
+	}
+	if deadLetterTime.Sub(startTime) < 150*time.Millisecond {
+		t.Fatal("retries should wait for the backoff")
+	}
+}
@@ -6,10 +6,12 @@ import (
 
 	"github.com/polariseye/Framework/goroutineMgr"
 	"github.com/polariseye/Framework/monitorMgr"
-	"github.com/polariseye/goutil/debugUtil"
 	"github.com/polariseye/goutil/logUtil"
 )
 
+// Send返回此错误表示数据已交给发送器异步发送，之后由发送器自行调用Ack或Retry
+var errSendPending = fmt.Errorf("send pending")
+
 // 负责发送数据的协程
 func sendLoop(s sender, closeSignal chan struct{}) {
 	name := "ensureSendUtil.send.sendLoop"
@@ -22,89 +24,74 @@ func sendLoop(s sender, closeSignal chan struct{}) {
 			closeSignal <- struct{}{}
 			return
 		case v := <-s.Data():
-			if err := s.Send(v); err != nil {
-				// 发送失败存入缓存
-				s.Cache() <- v
+			if err := s.Send(v); err == errSendPending {
+				// 等待发送器确认
+			} else if err != nil {
+				// 发送失败等待重发
+				s.Retry(v, err)
+			} else {
+				s.Ack(v)
 			}
 		}
 	}
 }
 
-// 定时重发失败的数据
-func resendLoop(s sender, folder string, closeSignal chan struct{}) {
+// 在每条数据各自的重发时间重发失败的数据
+func resendLoop(s sender, closeSignal chan struct{}) {
 	name := "ensureSendUtil.send.resendLoop"
 	goroutineMgr.MonitorZero(name)
 	defer goroutineMgr.ReleaseMonitor(name)
 
-	// debug模式每秒重试1次
-	var delay time.Duration
-	if debugUtil.IsDebug() {
-		delay = time.Second
-	} else {
-		delay = time.Minute * 5
-	}
-
-	// 定时重发失败数据
 	for {
+		// 没有待重发的数据时等待新的失败数据
+		delay, exists := s.Retries().nextDelay()
+		if exists == false {
+			delay = time.Hour
+		}
+
+		timer := time.NewTimer(delay)
 		select {
 		case <-s.Done():
+			timer.Stop()
 			closeSignal <- struct{}{}
 			return
-		case <-time.After(delay):
-			sendCacheData(s, folder)
-			loadData(s.(EnsureSender), folder)
+		case <-s.Retries().notify:
+		case <-timer.C:
 		}
+		timer.Stop()
+
+		resendDueData(s)
 	}
 }
 
-// 从sender获取失败数据重发
-func sendCacheData(s sender, folder string) {
-	failed := make([]dataItem, 0)
-	length := len(s.Cache())
-
-	defer func() {
-		// 用于记录多次失败后放弃发送的数据
-		giveUpItems := make(chan dataItem, len(failed))
-
-		for _, v := range failed {
-			if v.Count() >= 3 {
-				// 失败次数太多的数据准备存放到磁盘中
-				giveUpItems <- v
-			} else {
-				s.Cache() <- v
-			}
-		}
-
-		giveUpLen := len(giveUpItems)
-		if giveUpLen > 0 {
-			// 将多次失败的数据保存到文件中
-			if folder[len(folder)-1] == '/' {
-				folder = folder[:len(folder)-1]
-			}
-			saveData(giveUpItems, folder+"_giveup")
+// 重发已到重发时间的数据
+func resendDueData(s sender) {
+	itemList := s.Retries().popDue(time.Now())
+	if len(itemList) == 0 {
+		return
+	}
 
-			if giveUpLen >= 5 {
-				log := fmt.Sprintf("ensureSendUtil: 有%d条数据多次发送失败", giveUpLen)
-				logUtil.NormalLog(log, logUtil.Error)
-				monitorMgr.Report(log)
+	failedCount, deadLetterCount := 0, 0
+	for _, v := range itemList {
+		if err := s.Send(v); err == errSendPending {
+			// 等待发送器确认
+		} else if err != nil {
+			failedCount++
+			if s.Retry(v, err) {
+				deadLetterCount++
 			}
+		} else {
+			s.Ack(v)
 		}
+	}
 
-		// 输出信息
-		log := fmt.Sprintf("ensureSendUtil: 重发%d条数据，失败%d条，存盘%d条\n", length, len(failed), giveUpLen)
-		logUtil.NormalLog(log, logUtil.Info)
-	}()
-
-	for {
-		select {
-		case v := <-s.Cache():
-			// 重发数据
-			if e := s.Send(v); e != nil {
-				// 记录失败的数据
-				failed = append(failed, v)
-			}
-		default:
-			return
-		}
+	if deadLetterCount >= 5 {
+		log := fmt.Sprintf("ensureSendUtil: 有%d条数据多次发送失败", deadLetterCount)
+		logUtil.NormalLog(log, logUtil.Error)
+		monitorMgr.Report(log)
 	}
+
+	// 输出信息
+	log := fmt.Sprintf("ensureSendUtil: 重发%d条数据，失败%d条，放弃%d条，等待重发%d条\n", len(itemList), failedCount, deadLetterCount, s.Retries().len())
+	logUtil.NormalLog(log, logUtil.Info)
 }
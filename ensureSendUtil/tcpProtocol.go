@@ -0,0 +1,140 @@
+package ensureSendUtil
+
+import (
+	"fmt"
+	"io"
+)
+
+/*
+TCP发送器与TCPReceiver之间的协议
+帧格式：[长度(4字节，类型+内容的长度)+类型(1字节)+内容]
+心跳帧：发送器定时发送，没有内容
+批次帧：[批次序号(8字节)+数量(4字节)+数量*[数据序号(8字节)+数据长度(4字节)+zlib压缩后的数据]]
+确认帧：[批次序号(8字节)]，接收方处理完批次后回复，发送器收到确认后才删除批次中的数据
+所有整数均为小端字节序
+*/
+
+// 帧类型
+const (
+	frame_Heartbeat byte = iota
+	frame_Batch
+	frame_Ack
+)
+
+// 帧的最大长度
+const con_MAX_FRAME_SIZE = 64 * 1024 * 1024
+
+// 写入一帧
+// w:写入对象
+// frameType:帧类型
+// body:内容
+// 返回值:
+// 错误对象
+func writeFrame(w io.Writer, frameType byte, body []byte) error {
+	frame := make([]byte, 5+len(body))
+	byterOrder.PutUint32(frame[0:4], uint32(1+len(body)))
+	frame[4] = frameType
+	copy(frame[5:], body)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// 读取一帧
+// r:读取对象
+// 返回值:
+// 帧类型
+// 内容
+// 错误对象
+func readFrame(r io.Reader) (frameType byte, body []byte, err error) {
+	header := make([]byte, 5)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+
+	length := byterOrder.Uint32(header[0:4])
+	if length < 1 || length > con_MAX_FRAME_SIZE {
+		err = fmt.Errorf("invalid frame length %d", length)
+		return
+	}
+
+	frameType = header[4]
+	body = make([]byte, length-1)
+	_, err = io.ReadFull(r, body)
+	return
+}
+
+// 生成批次帧的内容
+func encodeBatch(batchId uint64, itemList []dataItem) []byte {
+	size := 12
+	for _, item := range itemList {
+		size += 12 + len(item.Bytes())
+	}
+
+	body := make([]byte, 12, size)
+	byterOrder.PutUint64(body[0:8], batchId)
+	byterOrder.PutUint32(body[8:12], uint32(len(itemList)))
+
+	itemHeader := make([]byte, 12)
+	for _, item := range itemList {
+		byterOrder.PutUint64(itemHeader[0:8], item.Seq())
+		byterOrder.PutUint32(itemHeader[8:12], uint32(len(item.Bytes())))
+		body = append(body, itemHeader...)
+		body = append(body, item.Bytes()...)
+	}
+
+	return body
+}
+
+// 解析批次帧的内容
+// 返回值:
+// 批次序号
+// 数据序号列表
+// 数据列表(压缩后的数据)
+// 错误对象
+func decodeBatch(body []byte) (batchId uint64, seqList []uint64, dataList [][]byte, err error) {
+	if len(body) < 12 {
+		err = fmt.Errorf("invalid batch frame")
+		return
+	}
+
+	batchId = byterOrder.Uint64(body[0:8])
+	count := int(byterOrder.Uint32(body[8:12]))
+	body = body[12:]
+	for i := 0; i < count; i++ {
+		if len(body) < 12 {
+			err = fmt.Errorf("invalid batch frame")
+			return
+		}
+
+		seq := byterOrder.Uint64(body[0:8])
+		length := int(byterOrder.Uint32(body[8:12]))
+		if len(body) < 12+length {
+			err = fmt.Errorf("invalid batch frame")
+			return
+		}
+
+		seqList = append(seqList, seq)
+		dataList = append(dataList, body[12:12+length])
+		body = body[12+length:]
+	}
+
+	return
+}
+
+// 生成确认帧的内容
+func encodeAck(batchId uint64) []byte {
+	body := make([]byte, 8)
+	byterOrder.PutUint64(body, batchId)
+	return body
+}
+
+// 解析确认帧的内容
+func decodeAck(body []byte) (batchId uint64, err error) {
+	if len(body) != 8 {
+		err = fmt.Errorf("invalid ack frame")
+		return
+	}
+
+	return byterOrder.Uint64(body), nil
+}
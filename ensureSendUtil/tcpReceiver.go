@@ -0,0 +1,148 @@
+package ensureSendUtil
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/polariseye/goutil/logUtil"
+	"github.com/polariseye/goutil/zlibUtil"
+)
+
+// TCP发送器的接收方：接收批次帧，解压后交给处理方法，处理成功后回复确认帧
+// 处理失败时关闭连接，发送器会重发该连接上所有未确认的数据
+// 同一条数据可能被接收多次(如确认帧丢失时)，可以通过处理方法收到的数据序号去重
+type TCPReceiver struct {
+	// 监听对象
+	listener net.Listener
+
+	// 处理方法，返回错误表示处理失败
+	handler func(seqList []uint64, dataList []string) error
+
+	// 当前的连接
+	connMap   map[net.Conn]struct{}
+	connMutex sync.Mutex
+
+	// 用于等待所有连接的协程退出
+	waitGroup sync.WaitGroup
+}
+
+// 创建一个TCP接收方并开始监听
+// 参数：
+// 		_address     监听地址
+// 		_handler     处理方法，参数为一个批次中数据的序号(发送方预写日志中的序号，重发时不变)和数据，返回错误表示处理失败
+func NewTCPReceiver(_address string, _handler func(seqList []uint64, dataList []string) error) (*TCPReceiver, error) {
+	listener, err := net.Listen("tcp", _address)
+	if err != nil {
+		return nil, err
+	}
+
+	this := &TCPReceiver{
+		listener: listener,
+		handler:  _handler,
+		connMap:  make(map[net.Conn]struct{}),
+	}
+
+	this.waitGroup.Add(1)
+	go this.acceptLoop()
+
+	return this, nil
+}
+
+// 获取监听地址
+func (this *TCPReceiver) Addr() net.Addr {
+	return this.listener.Addr()
+}
+
+// 停止监听并关闭所有连接
+func (this *TCPReceiver) Close() error {
+	err := this.listener.Close()
+
+	this.connMutex.Lock()
+	for conn := range this.connMap {
+		conn.Close()
+	}
+	this.connMutex.Unlock()
+
+	this.waitGroup.Wait()
+	return err
+}
+
+// 接受连接
+func (this *TCPReceiver) acceptLoop() {
+	defer this.waitGroup.Done()
+
+	for {
+		conn, err := this.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		this.connMutex.Lock()
+		this.connMap[conn] = struct{}{}
+		this.connMutex.Unlock()
+
+		this.waitGroup.Add(1)
+		go this.handleConn(conn)
+	}
+}
+
+// 处理一个连接上的帧
+func (this *TCPReceiver) handleConn(conn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			logUtil.LogUnknownError(r)
+		}
+
+		conn.Close()
+		this.connMutex.Lock()
+		delete(this.connMap, conn)
+		this.connMutex.Unlock()
+		this.waitGroup.Done()
+	}()
+
+	for {
+		frameType, body, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		switch frameType {
+		case frame_Heartbeat:
+			continue
+		case frame_Batch:
+			if err = this.handleBatch(conn, body); err != nil {
+				log := fmt.Sprintf("ensureSendUtil.TCPReceiver: 处理来自%s的数据失败，错误信息为：%s", conn.RemoteAddr(), err)
+				logUtil.NormalLog(log, logUtil.Error)
+				return
+			}
+		default:
+			log := fmt.Sprintf("ensureSendUtil.TCPReceiver: 收到来自%s的未知帧类型%d", conn.RemoteAddr(), frameType)
+			logUtil.NormalLog(log, logUtil.Error)
+			return
+		}
+	}
+}
+
+// 处理批次帧，成功后回复确认帧
+func (this *TCPReceiver) handleBatch(conn net.Conn, body []byte) error {
+	batchId, seqList, compressedList, err := decodeBatch(body)
+	if err != nil {
+		return err
+	}
+
+	dataList := make([]string, 0, len(compressedList))
+	for _, compressed := range compressedList {
+		decompressed, err := zlibUtil.Decompress(compressed)
+		if err != nil {
+			return err
+		}
+		dataList = append(dataList, string(decompressed))
+	}
+
+	if err = this.handler(seqList, dataList); err != nil {
+		return err
+	}
+
+	return writeFrame(conn, frame_Ack, encodeAck(batchId))
+}
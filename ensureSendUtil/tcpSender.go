@@ -8,14 +8,55 @@ import (
 	"time"
 
 	"github.com/Jordan/Framework/goroutineMgr"
-	"github.com/Jordan/goutil/intAndBytesUtil"
+	"github.com/polariseye/goutil/logUtil"
 )
 
 var (
 	errConnectEmpty = fmt.Errorf("scoket reconnecting...")
+	errAckTimeout   = fmt.Errorf("wait ack timeout")
 	byterOrder      = binary.LittleEndian
 )
 
+const (
+	// 心跳间隔
+	con_HEARTBEAT_INTERVAL = 15 * time.Second
+
+	// 重连间隔
+	con_RECONNECT_INTERVAL = 5 * time.Second
+)
+
+// 已发送等待确认的批次
+type tcpBatch struct {
+	// 批次中的数据
+	itemList []dataItem
+
+	// 发送时间
+	sendTime time.Time
+}
+
+// 一个TCP连接，以及在该连接上等待确认的批次
+type tcpConnection struct {
+	conn net.Conn
+
+	// 用于写入帧时互斥
+	writeMutex sync.Mutex
+
+	// 用于nextBatchId、inflightMap和isClosed的互斥
+	mutex sync.Mutex
+
+	// 下一个批次的序号
+	nextBatchId uint64
+
+	// 等待确认的批次
+	inflightMap map[uint64]*tcpBatch
+
+	// 是否已关闭
+	isClosed bool
+
+	// 读取协程退出时关闭
+	readDone chan struct{}
+}
+
 // 实现 EnsureSender和sender接口
 type tcpSender struct {
 	// 需要实现的接口
@@ -30,13 +71,16 @@ type tcpSender struct {
 	// 服务器地址
 	address string
 
-	// 连接
-	conn net.Conn
+	// 连接，重连期间为nil
+	conn *tcpConnection
 
 	// 用于重连时互斥
 	mutex sync.Mutex
 
-	// 用于sendLoop和resendLoop发送退出信号
+	// 将数据凑成批次发送
+	batcher *batcher
+
+	// 用于sendLoop、resendLoop和heartBeat发送退出信号
 	closeSignal chan struct{}
 }
 
@@ -45,46 +89,79 @@ type tcpSender struct {
 // 		_dataFolder  数据存放目录
 // 		_address     连接地址
 func NewTCPSender(_dataFolder, _address string) (EnsureSender, error) {
+	return NewTCPSender2(_dataFolder, _address, nil)
+}
+
+// 创建一个tcp数据发送器
+// 参数：
+// 		_dataFolder  数据存放目录(预写日志)
+// 		_address     连接地址，需要运行TCPReceiver或实现了相同协议的服务器
+// 		_option      发送器选项，nil表示使用默认值
+func NewTCPSender2(_dataFolder, _address string, _option *SenderOption) (EnsureSender, error) {
+	if _option == nil {
+		_option = &SenderOption{}
+	}
+
 	// 连接服务器
 	conn, err := net.DialTimeout("tcp", _address, 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
 
+	base, err := newBaseSender(_dataFolder, _option, newTCPDataItem)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	this := &tcpSender{
 		dataFolder:  _dataFolder,
-		baseSender:  newBaseSender(),
+		baseSender:  base,
 		address:     _address,
-		conn:        conn,
 		closeSignal: make(chan struct{}),
 	}
+	this.conn = this.newConnection(conn)
+	this.batcher = newBatcher(this.option.BatchSize, this.option.BatchDelay, this.sendBatch)
+
+	// 重发上次未发送的数据
+	go this.replay()
 
 	// 新开协程发送数据
 	go sendLoop(this, this.closeSignal)
 
 	// 定时重发
-	go resendLoop(this, _dataFolder, this.closeSignal)
+	go resendLoop(this, this.closeSignal)
 
-	// 发送心跳包
+	// 发送心跳包并检查确认超时
 	go this.heartBeat()
 
 	return this, nil
 }
 
-// 每隔15秒发送心跳包
+// 每隔15秒发送心跳包，每秒检查一次是否有批次确认超时
 func (this *tcpSender) heartBeat() {
 	name := "ensureSendUtil.tcpSender.heartBeat"
 	goroutineMgr.MonitorZero(name)
 	defer goroutineMgr.ReleaseMonitor(name)
 
-	tick := time.Tick(time.Second * 15)
+	heartBeatTicker := time.NewTicker(con_HEARTBEAT_INTERVAL)
+	defer heartBeatTicker.Stop()
+	checkTicker := time.NewTicker(time.Second)
+	defer checkTicker.Stop()
 
 	for {
 		select {
 		case <-this.Done():
+			this.closeSignal <- struct{}{}
 			return
-		case <-tick:
-			this.sendBytes([]byte{})
+		case <-heartBeatTicker.C:
+			if c := this.getConnection(); c != nil {
+				this.writeFrame(c, frame_Heartbeat, nil)
+			}
+		case <-checkTicker.C:
+			if c := this.getConnection(); c != nil && c.isAckTimeout(this.option.AckTimeout) {
+				this.closeConnection(c, errAckTimeout)
+			}
 		}
 	}
 }
@@ -92,14 +169,7 @@ func (this *tcpSender) heartBeat() {
 // EnsureSender接口
 // Write：写入数据
 func (this *tcpSender) Write(data string) error {
-	item, err := newTCPDataItem(data)
-	if err != nil {
-		return err
-	}
-
-	this.waitingDataChan <- item
-
-	return nil
+	return this.write(data)
 }
 
 // EnsureSender接口
@@ -107,99 +177,220 @@ func (this *tcpSender) Write(data string) error {
 func (this *tcpSender) Close() error {
 	close(this.done)
 
-	// 关闭socket连接
-	conn := this.conn
-	if conn != nil {
-		conn.Close()
-	}
-
-	// 等待sendLoop和resendLoop退出
+	// 等待sendLoop、resendLoop和heartBeat退出
+	<-this.closeSignal
 	<-this.closeSignal
 	<-this.closeSignal
 
-	// 保存数据
-	_, e1 := saveData(this.Cache(), this.dataFolder)
-	_, e2 := saveData(this.Data(), this.dataFolder)
+	// 丢弃正在凑批次的数据
+	this.batcher.stop()
 
-	if e2 != nil {
-		if e1 != nil {
-			return fmt.Errorf("%s %s", e1, e2)
-		}
-		return e2
-	} else {
-		return e1
+	// 关闭socket连接，并等待读取协程退出
+	this.mutex.Lock()
+	c := this.conn
+	this.conn = nil
+	this.mutex.Unlock()
+	if c != nil {
+		this.closeConnection(c, errConnectEmpty)
+		<-c.readDone
 	}
+
+	// 未确认的数据已在预写日志中，下次启动时发送
+	return this.closeLog()
 }
 
 // Sender接口
-// Send：发送dataItem
+// Send：将dataItem加入批次，批次满或凑批次超时后发送，收到确认后才调用Ack
 func (this *tcpSender) Send(item dataItem) error {
-	err := this.sendBytes(item.Bytes())
-	if err != nil && err != errConnectEmpty {
-		// 发送失败时发送次数+1
-		item.SetCount(item.Count() + 1)
-	}
-
-	return err
+	this.batcher.add(item)
+	return errSendPending
 }
 
-// 发送字节数据
-// 发送格式：[lenght+data]
-func (this *tcpSender) sendBytes(data []byte) error {
-	conn := this.conn
-	if conn == nil {
-		return errConnectEmpty
+// 发送一个批次
+func (this *tcpSender) sendBatch(itemList []dataItem) {
+	// 已关闭的数据在下次启动时发送
+	select {
+	case <-this.Done():
+		return
+	default:
 	}
 
-	// 将长度转化为字节数组
-	header := intAndBytesUtil.Int32ToBytes(int32(len(data)), byterOrder)
-
-	if len(data) > 0 {
-		data = append(header, data...)
-	} else {
-		data = header
+	c := this.getConnection()
+	if c == nil {
+		// 重连中，不计入发送次数
+		for _, item := range itemList {
+			this.Retry(item, errConnectEmpty)
+		}
+		return
 	}
 
-	_, err := conn.Write(data)
-	if err != nil {
-		this.mutex.Lock()
-		// 发送失败
-		// 检查失败的conn是否this.conn（避免多个线程失败后均调用reconnect）
-		// 是则关闭并重连
-		if conn == this.conn {
-			this.conn.Close()
-			this.conn = nil
-			this.mutex.Unlock()
-
-			// 重连
-			go this.reconnect()
-		} else {
-			this.mutex.Unlock()
+	// 先登记再发送，避免确认比登记先到达
+	c.mutex.Lock()
+	if c.isClosed {
+		c.mutex.Unlock()
+		for _, item := range itemList {
+			this.Retry(item, errConnectEmpty)
 		}
+		return
 	}
+	batchId := c.nextBatchId
+	c.nextBatchId++
+	c.inflightMap[batchId] = &tcpBatch{
+		itemList: itemList,
+		sendTime: time.Now(),
+	}
+	c.mutex.Unlock()
 
-	return err
+	// 发送失败时由closeConnection安排重发
+	this.writeFrame(c, frame_Batch, encodeBatch(batchId, itemList))
 }
 
-// 重连服务器
-func (this *tcpSender) reconnect() error {
-	// lock-it
+// 在连接上写入一帧，失败时关闭连接
+func (this *tcpSender) writeFrame(c *tcpConnection, frameType byte, body []byte) {
+	c.writeMutex.Lock()
+	err := writeFrame(c.conn, frameType, body)
+	c.writeMutex.Unlock()
+
+	if err != nil {
+		this.closeConnection(c, err)
+	}
+}
+
+// 获取当前连接，重连期间返回nil
+func (this *tcpSender) getConnection() *tcpConnection {
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 
+	return this.conn
+}
+
+// 创建连接对象并开启读取协程
+func (this *tcpSender) newConnection(conn net.Conn) *tcpConnection {
+	c := &tcpConnection{
+		conn:        conn,
+		inflightMap: make(map[uint64]*tcpBatch),
+		readDone:    make(chan struct{}),
+	}
+	go this.readLoop(c)
+
+	return c
+}
+
+// 读取接收方的确认帧
+func (this *tcpSender) readLoop(c *tcpConnection) {
+	defer close(c.readDone)
+
 	for {
-		// 检查是否已经重连
-		if this.conn != nil {
-			return nil
+		frameType, body, err := readFrame(c.conn)
+		if err != nil {
+			this.closeConnection(c, err)
+			return
 		}
+		if frameType != frame_Ack {
+			continue
+		}
+
+		batchId, err := decodeAck(body)
+		if err != nil {
+			this.closeConnection(c, err)
+			return
+		}
+
+		c.mutex.Lock()
+		batch, exists := c.inflightMap[batchId]
+		delete(c.inflightMap, batchId)
+		c.mutex.Unlock()
 
+		if exists {
+			for _, item := range batch.itemList {
+				this.Ack(item)
+			}
+		}
+	}
+}
+
+// 关闭连接，连接上未确认的数据安排重发，然后重连
+// 同一个连接只处理一次
+func (this *tcpSender) closeConnection(c *tcpConnection, err error) {
+	c.mutex.Lock()
+	if c.isClosed {
+		c.mutex.Unlock()
+		return
+	}
+	c.isClosed = true
+	inflightMap := c.inflightMap
+	c.inflightMap = nil
+	c.mutex.Unlock()
+
+	c.conn.Close()
+
+	select {
+	case <-this.Done():
+		// 已关闭，未确认的数据在下次启动时发送
+		return
+	default:
+	}
+
+	log := fmt.Sprintf("ensureSendUtil.tcpSender: 连接%s断开，%d个批次未确认，错误信息为：%s", this.address, len(inflightMap), err)
+	logUtil.NormalLog(log, logUtil.Warn)
+
+	for _, batch := range inflightMap {
+		for _, item := range batch.itemList {
+			// 发送失败时发送次数+1
+			item.SetCount(item.Count() + 1)
+			this.Retry(item, err)
+		}
+	}
+
+	// 检查失败的连接是否当前连接（避免多个线程失败后均调用reconnect）
+	this.mutex.Lock()
+	if this.conn == c {
+		this.conn = nil
+		go this.reconnect()
+	}
+	this.mutex.Unlock()
+}
+
+// 重连服务器
+func (this *tcpSender) reconnect() {
+	for {
 		conn, err := net.DialTimeout("tcp", this.address, 5*time.Second)
 		if err != nil {
 			// 连接失败，5秒后重试
-			<-time.After(time.Second * 5)
+			select {
+			case <-this.Done():
+				return
+			case <-time.After(con_RECONNECT_INTERVAL):
+			}
 			continue
 		}
 
-		this.conn = conn
+		this.mutex.Lock()
+		select {
+		case <-this.Done():
+			this.mutex.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		this.conn = this.newConnection(conn)
+		this.mutex.Unlock()
+
+		return
 	}
 }
+
+// 是否有批次超过指定时间未确认
+func (this *tcpConnection) isAckTimeout(timeout time.Duration) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	now := time.Now()
+	for _, batch := range this.inflightMap {
+		if now.Sub(batch.sendTime) >= timeout {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,75 +2,64 @@ package ensureSendUtil
 
 import (
 	"fmt"
-	"net"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Jordan/goutil/debugUtil"
-	"github.com/Jordan/goutil/zlibUtil"
 )
 
 // 保存接收的数据用于校验
-var tcp_recv_msg = make([]byte, 0)
+var (
+	tcp_recv_msg   = make([]byte, 0)
+	tcp_recv_mutex sync.Mutex
+)
 
 func init() {
 	debugUtil.SetDebug(true)
 }
 
-// 创建socket服务器，保存收到的数据
-func server(addr string) net.Listener {
-	listener, err := net.Listen("tcp", addr)
+// 创建接收方，保存收到的数据
+func server(addr string) *TCPReceiver {
+	receiver, err := NewTCPReceiver(addr, func(seqList []uint64, dataList []string) error {
+		tcp_recv_mutex.Lock()
+		defer tcp_recv_mutex.Unlock()
+		for _, data := range dataList {
+			tcp_recv_msg = append(tcp_recv_msg, data...)
+		}
+		return nil
+	})
 	if err != nil {
 		panic(err)
 	}
 
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				return
-			}
-
-			for {
-				buff := make([]byte, 512)
-				_, err := conn.Read(buff)
-				if err != nil {
-					break
-				} else {
-					decompressed, err := zlibUtil.Decompress(buff[4:])
-					if err != nil {
-						panic(err)
-					} else {
-						tcp_recv_msg = append(tcp_recv_msg, decompressed...)
-					}
-				}
-			}
-		}
-	}()
-
-	return listener
+	return receiver
 }
 
 func Test_tcp(t *testing.T) {
+	os.RemoveAll("./test_tcp")
+	defer os.RemoveAll("./test_tcp")
+
 	// 开启服务器
 	l := server("127.0.0.1:9559")
 
 	tcp, err := NewTCPSender("./test_tcp", "127.0.0.1:9559")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	// 发送消息
 	tcp.Write("tcp-msg-1")
-	time.Sleep(time.Millisecond * 50) // 等待协程发送数据
+	time.Sleep(time.Millisecond * 50) // 等待协程发送数据并收到确认
 
-	// 关闭连接和服务器
+	// 关闭服务器和连接
 	l.Close()
-	(tcp.(*tcpSender)).conn.Close()
 
-	// 发送消息，此数据会失败
+	// 发送消息，此数据不会被确认
 	tcp.Write("tcp-msg-2")
-	// time.Sleep(time.Millisecond * 50)
+	time.Sleep(time.Millisecond * 50)
 
 	// 保存数据
 	tcp.Close()
@@ -79,17 +68,141 @@ func Test_tcp(t *testing.T) {
 	l = server("127.0.0.1:9559")
 	tcp, err = NewTCPSender("./test_tcp", "127.0.0.1:9559")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	time.Sleep(time.Second * 2)
 
+	tcp_recv_mutex.Lock()
 	if string(tcp_recv_msg) != "tcp-msg-1tcp-msg-2" {
 		t.Error("message error. got " + string(tcp_recv_msg))
 	} else {
 		fmt.Println("TCP OK")
 	}
+	tcp_recv_mutex.Unlock()
 
 	tcp.Close()
 	l.Close()
 }
+
+func Test_tcpBatch(t *testing.T) {
+	folder := "./test_tcp_batch"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	var mutex sync.Mutex
+	var batchSizeList []int
+	var recvList []string
+	var recvSeqList []uint64
+	receiver, err := NewTCPReceiver("127.0.0.1:0", func(seqList []uint64, dataList []string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		batchSizeList = append(batchSizeList, len(dataList))
+		recvList = append(recvList, dataList...)
+		recvSeqList = append(recvSeqList, seqList...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	tcp, err := NewTCPSender2(folder, receiver.Addr().String(), &SenderOption{
+		BatchSize:  10,
+		BatchDelay: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedList := make([]string, 0, 25)
+	expectedSeqList := make([]uint64, 0, 25)
+	for i := 0; i < 25; i++ {
+		data := fmt.Sprintf("msg-%d", i)
+		expectedList = append(expectedList, data)
+		expectedSeqList = append(expectedSeqList, uint64(i))
+		tcp.Write(data)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// 所有数据都已确认
+	if err = tcp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	log, err := openWAL(folder, WALOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqList, _ := replayAll(t, log); len(seqList) != 0 {
+		t.Fatalf("all records should be acked, got %v", seqList)
+	}
+	log.close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if strings.Join(recvList, ",") != strings.Join(expectedList, ",") {
+		t.Fatalf("bad data: %v", recvList)
+	}
+	// 接收方收到数据在预写日志中的序号，可用于去重
+	if fmt.Sprint(recvSeqList) != fmt.Sprint(expectedSeqList) {
+		t.Fatalf("bad seq: %v", recvSeqList)
+	}
+	for _, size := range batchSizeList {
+		if size > 10 {
+			t.Fatalf("bad batch sizes: %v", batchSizeList)
+		}
+	}
+	if len(batchSizeList) >= 25 {
+		t.Fatalf("items should be batched: %v", batchSizeList)
+	}
+}
+
+func Test_tcpReconnect(t *testing.T) {
+	folder := "./test_tcp_reconnect"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	var mutex sync.Mutex
+	var recvList []string
+	handler := func(seqList []uint64, dataList []string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		recvList = append(recvList, dataList...)
+		return nil
+	}
+
+	receiver, err := NewTCPReceiver("127.0.0.1:0", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := receiver.Addr().String()
+
+	tcp, err := NewTCPSender(folder, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+
+	tcp.Write("msg-1")
+	time.Sleep(100 * time.Millisecond)
+
+	// 重启接收方，发送器保持打开并自动重连
+	receiver.Close()
+	time.Sleep(100 * time.Millisecond)
+	tcp.Write("msg-2")
+	if receiver, err = NewTCPReceiver(address, handler); err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	// 等待重连(重连间隔为5秒)后重发
+	time.Sleep(con_RECONNECT_INTERVAL + 2*time.Second)
+	tcp.Write("msg-3")
+	time.Sleep(100 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if fmt.Sprint(recvList) != "[msg-1 msg-2 msg-3]" {
+		t.Fatalf("bad data: %v", recvList)
+	}
+}
@@ -0,0 +1,170 @@
+package ensureSendUtil
+
+import "fmt"
+
+// 数据的传输方式，通过NewSender创建发送器后，与TCP、HTTP发送器一样先写入预写日志，
+// 并使用相同的批次、重发和死信处理逻辑
+type Transport interface {
+	// 发送一个批次的数据(最多SenderOption.BatchSize条)，返回nil表示全部发送成功，否则整个批次等待重发
+	// 返回Reject包装的错误表示数据被拒绝：多条数据的批次会逐条重新调用Send，单条数据被拒绝时直接交给死信处理
+	// 同一时刻只会有一个协程调用
+	Send(dataList []string) error
+
+	// 关闭，发送器关闭时调用
+	Close() error
+}
+
+// 表示数据被接收方拒绝，重发也不会成功
+type rejectError struct {
+	err error
+}
+
+func (this *rejectError) Error() string {
+	return fmt.Sprintf("rejected: %s", this.err)
+}
+
+// 包装Transport.Send返回的错误，表示数据被拒绝，不再重发而是直接交给死信处理
+// err:原始错误
+// 返回值:
+// 包装后的错误
+func Reject(err error) error {
+	return &rejectError{err: err}
+}
+
+// 实现 EnsureSender和sender接口，通过Transport发送数据
+type transportSender struct {
+	// 需要实现的接口
+	EnsureSender
+
+	// 包含sender接口部分实现
+	*baseSender
+
+	// 传输方式
+	transport Transport
+
+	// 将数据凑成批次发送
+	batcher *batcher
+
+	// 用于sendLoop和resendLoop发送退出信号
+	closeSignal chan struct{}
+}
+
+// 创建一个使用指定传输方式的数据发送器
+// 参数：
+//      _dataFolder  数据存放目录(预写日志)
+//      _transport   传输方式，发送器关闭时会关闭它
+//      _option      发送器选项，nil表示使用默认值
+func NewSender(_dataFolder string, _transport Transport, _option *SenderOption) (EnsureSender, error) {
+	if _option == nil {
+		_option = &SenderOption{}
+	}
+
+	// 与http相同，使用原始数据
+	base, err := newBaseSender(_dataFolder, _option, func(data string) (dataItem, error) {
+		return newHTTPData(data), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	this := &transportSender{
+		baseSender:  base,
+		transport:   _transport,
+		closeSignal: make(chan struct{}),
+	}
+	this.batcher = newBatcher(this.option.BatchSize, this.option.BatchDelay, this.sendBatch)
+
+	// 重发上次未发送的数据
+	go this.replay()
+
+	// 新开协程发送数据
+	go sendLoop(this, this.closeSignal)
+
+	// 定时重发
+	go resendLoop(this, this.closeSignal)
+
+	return this, nil
+}
+
+// EnsureSender接口
+// Write：写入数据
+func (this *transportSender) Write(data string) error {
+	return this.write(data)
+}
+
+// EnsureSender接口
+// Close：关闭
+func (this *transportSender) Close() error {
+	close(this.done)
+
+	// 等待sendLoop和resendLoop退出
+	<-this.closeSignal
+	<-this.closeSignal
+
+	// 丢弃正在凑批次的数据
+	this.batcher.stop()
+
+	// 未发送的数据已在预写日志中，下次启动时发送
+	err := this.closeLog()
+	if e := this.transport.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// sender接口
+// Send：将dataItem加入批次，批次满或凑批次超时后发送
+func (this *transportSender) Send(item dataItem) error {
+	this.batcher.add(item)
+	return errSendPending
+}
+
+// 发送一个批次
+func (this *transportSender) sendBatch(itemList []dataItem) {
+	// 已关闭的数据在下次启动时发送
+	select {
+	case <-this.Done():
+		return
+	default:
+	}
+
+	dataList := make([]string, 0, len(itemList))
+	for _, item := range itemList {
+		dataList = append(dataList, item.String())
+	}
+
+	err := this.send(dataList)
+	_, isRejected := err.(*rejectError)
+
+	// 整个批次被拒绝时逐条重发，只将被拒绝的数据交给死信处理
+	if isRejected && len(itemList) > 1 {
+		for _, item := range itemList {
+			this.sendBatch([]dataItem{item})
+		}
+		return
+	}
+
+	for _, item := range itemList {
+		if err == nil {
+			this.Ack(item)
+		} else if isRejected {
+			this.reject(item, err)
+		} else {
+			// 发送失败时发送次数+1
+			item.SetCount(item.Count() + 1)
+			this.Retry(item, err)
+		}
+	}
+}
+
+// 调用Transport.Send，panic视为发送失败
+func (this *transportSender) send(dataList []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Transport.Send panic: %v", r)
+		}
+	}()
+
+	return this.transport.Send(dataList)
+}
@@ -0,0 +1,119 @@
+package ensureSendUtil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 第一次发送失败，含有bad的批次被拒绝
+type testTransport struct {
+	mutex     sync.Mutex
+	sendCount int
+	recvList  []string
+	isClosed  bool
+}
+
+func (this *testTransport) Send(dataList []string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.sendCount++
+	if this.sendCount == 1 {
+		return fmt.Errorf("first send failed")
+	}
+	for _, data := range dataList {
+		if data == "bad" {
+			return Reject(fmt.Errorf("bad data"))
+		}
+	}
+
+	this.recvList = append(this.recvList, dataList...)
+	return nil
+}
+
+func (this *testTransport) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.isClosed = true
+	return nil
+}
+
+func Test_transportSender(t *testing.T) {
+	folder := "./test_transport"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	var mutex sync.Mutex
+	var deadLetterList []string
+	transport := &testTransport{}
+	sender, err := NewSender(folder, transport, &SenderOption{
+		InitialBackoff: 50 * time.Millisecond,
+		BatchDelay:     20 * time.Millisecond,
+		DeadLetter: func(data string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			deadLetterList = append(deadLetterList, data)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender.Write("a")
+	sender.Write("b")
+	time.Sleep(300 * time.Millisecond)
+	// bad和c在同一个批次中，批次被拒绝后逐条重发，只有bad交给死信处理
+	sender.Write("bad")
+	sender.Write("c")
+	time.Sleep(300 * time.Millisecond)
+	sender.Close()
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	if fmt.Sprint(transport.recvList) != "[a b c]" || transport.isClosed == false {
+		t.Fatalf("bad data: %v %v", transport.recvList, transport.isClosed)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if fmt.Sprint(deadLetterList) != "[bad]" {
+		t.Fatalf("bad dead letters: %v", deadLetterList)
+	}
+}
+
+func Test_fileSender(t *testing.T) {
+	folder := "./test_file_sender"
+	path := "./test_file_sink"
+	os.RemoveAll(folder)
+	os.RemoveAll(path)
+	defer os.RemoveAll(folder)
+	defer os.RemoveAll(path)
+
+	sender, err := NewFileSender(folder, path, "event", 1024*1024, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		sender.Write(fmt.Sprintf("msg-%d", i))
+	}
+	// 换行符和反斜杠被转义，数据仍只占一行
+	sender.Write("line-1\nline-2\\")
+	time.Sleep(100 * time.Millisecond)
+	sender.Close()
+
+	fileList, _ := filepath.Glob(filepath.Join(path, "event_*"))
+	if len(fileList) != 1 {
+		t.Fatalf("bad files: %v", fileList)
+	}
+	content, _ := ioutil.ReadFile(fileList[0])
+	if strings.Join(strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"), ",") != `msg-0,msg-1,msg-2,msg-3,msg-4,line-1\nline-2\\` {
+		t.Fatalf("bad content: %s", content)
+	}
+}
@@ -0,0 +1,552 @@
+package ensureSendUtil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/logUtil"
+)
+
+const (
+	// 段文件的后缀
+	con_SEGMENT_SUFFIX = ".wal"
+
+	// 保存已发送序号的文件
+	con_OFFSET_FILE_NAME = "sent.offset"
+
+	// 记录头的长度：数据长度(4字节)+CRC32校验(4字节)
+	con_RECORD_HEADER_SIZE = 8
+
+	// 默认的段文件大小
+	con_DEFAULT_SEGMENT_SIZE = 64 * 1024 * 1024
+
+	// 默认的同步间隔
+	con_DEFAULT_SYNC_INTERVAL = time.Second
+
+	// 已发送序号每前进多少条保存一次
+	con_CHECKPOINT_ACK_COUNT = 100
+)
+
+// 同步到磁盘的策略
+type SyncPolicy int
+
+const (
+	// 每次写入后都同步到磁盘，Write返回即表示数据已落盘
+	Sync_Always SyncPolicy = iota
+
+	// 按时间间隔同步到磁盘，崩溃时可能丢失最后一个间隔内写入的数据
+	Sync_Interval
+
+	// 不主动同步，由操作系统决定何时落盘
+	Sync_None
+)
+
+// 预写日志选项
+type WALOption struct {
+	// 单个段文件的最大字节数，<=0表示使用默认值(64MB)
+	SegmentSize int64
+
+	// 同步到磁盘的策略
+	SyncPolicy SyncPolicy
+
+	// Sync_Interval时的同步间隔，<=0表示使用默认值(1秒)
+	SyncInterval time.Duration
+}
+
+// 预写日志：数据在发送前先追加到段文件中，发送成功后推进已发送序号，
+// 全部发送完成的段会被删除，重启后未发送的记录会被重新发送
+// 段文件以其第一条记录的序号命名；记录格式为：[长度(4字节)+CRC32(4字节)+数据]
+// 已发送序号之后的记录可能有部分已经发送过，重启后会被再次发送(至少发送一次)
+type writeAheadLog struct {
+	// 数据目录
+	folder string
+
+	// 选项
+	option WALOption
+
+	// 锁对象
+	mutex sync.Mutex
+
+	// 各段的起始序号(升序)，最后一个为当前写入的段
+	segmentList []uint64
+
+	// 当前写入的段文件及其大小
+	file     *os.File
+	fileSize int64
+
+	// 下一条记录的序号
+	nextSeq uint64
+
+	// 小于此序号的记录都已发送
+	sentOffset uint64
+
+	// 大于sentOffset的已发送序号
+	ackedSet map[uint64]struct{}
+
+	// 上次保存之后sentOffset前进的数量
+	unsavedCount int
+
+	// 是否有尚未同步到磁盘的数据(Sync_Interval时使用)
+	isDirty bool
+
+	// 用于停止同步协程
+	done chan struct{}
+}
+
+// 打开预写日志，会删除已发送完成的段，截断末尾不完整的记录，并导入旧版本的一条数据一个文件的缓存
+// folder:数据目录
+// option:选项
+// 返回值:
+// 预写日志对象
+// 错误对象
+func openWAL(folder string, option WALOption) (this *writeAheadLog, err error) {
+	if option.SegmentSize <= 0 {
+		option.SegmentSize = con_DEFAULT_SEGMENT_SIZE
+	}
+	if option.SyncInterval <= 0 {
+		option.SyncInterval = con_DEFAULT_SYNC_INTERVAL
+	}
+	if err = os.MkdirAll(folder, os.ModePerm|os.ModeDir); err != nil {
+		return
+	}
+
+	this = &writeAheadLog{
+		folder:   folder,
+		option:   option,
+		ackedSet: make(map[uint64]struct{}),
+		done:     make(chan struct{}),
+	}
+	if this.sentOffset, err = this.readOffset(); err != nil {
+		return nil, err
+	}
+
+	var legacyFileList []string
+	if legacyFileList, err = this.loadSegmentList(); err != nil {
+		return nil, err
+	}
+	this.removeSentSegments()
+	if err = this.openLastSegment(); err != nil {
+		return nil, err
+	}
+
+	if err = this.importLegacyFiles(legacyFileList); err != nil {
+		this.close()
+		return nil, err
+	}
+
+	if option.SyncPolicy == Sync_Interval {
+		go this.syncLoop()
+	}
+
+	return this, nil
+}
+
+// 追加一条记录
+// data:数据
+// 返回值:
+// 记录的序号
+// 错误对象
+func (this *writeAheadLog) append(data []byte) (seq uint64, err error) {
+	record := make([]byte, con_RECORD_HEADER_SIZE+len(data))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[con_RECORD_HEADER_SIZE:], data)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.file == nil {
+		return 0, fmt.Errorf("write ahead log is closed")
+	}
+
+	// 当前段已满时切换到新段
+	if this.fileSize > 0 && this.fileSize+int64(len(record)) > this.option.SegmentSize {
+		if err = this.roll(); err != nil {
+			return
+		}
+	}
+
+	if _, err = this.file.Write(record); err != nil {
+		// 去掉可能写入的部分数据，避免后续记录无法读取
+		this.file.Truncate(this.fileSize)
+		this.file.Seek(this.fileSize, io.SeekStart)
+		return
+	}
+	this.fileSize += int64(len(record))
+
+	switch this.option.SyncPolicy {
+	case Sync_Always:
+		if err = this.file.Sync(); err != nil {
+			return
+		}
+	case Sync_Interval:
+		this.isDirty = true
+	}
+
+	seq = this.nextSeq
+	this.nextSeq++
+
+	return
+}
+
+// 确认记录已发送
+// seq:记录的序号
+func (this *writeAheadLog) ack(seq uint64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if seq < this.sentOffset || seq >= this.nextSeq {
+		return
+	}
+
+	this.ackedSet[seq] = struct{}{}
+	for {
+		if _, exists := this.ackedSet[this.sentOffset]; exists == false {
+			break
+		}
+
+		delete(this.ackedSet, this.sentOffset)
+		this.sentOffset++
+		this.unsavedCount++
+	}
+
+	// 定期保存已发送序号，并在整段发送完成后删除该段
+	if this.unsavedCount >= con_CHECKPOINT_ACK_COUNT || (len(this.segmentList) > 1 && this.segmentList[1] <= this.sentOffset) {
+		if err := this.checkpoint(); err != nil {
+			logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog.ack: save offset of %s failed:%s", this.folder, err), logUtil.Error)
+		}
+	}
+}
+
+// 获取下一条记录的序号
+func (this *writeAheadLog) getNextSeq() uint64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.nextSeq
+}
+
+// 依次读取序号小于endSeq的未发送记录
+// endSeq:结束序号(不包含)
+// fn:处理方法，参数为序号和数据，返回false表示停止读取
+// 返回值:
+// 错误对象
+func (this *writeAheadLog) replay(endSeq uint64, fn func(seq uint64, data []byte) bool) error {
+	this.mutex.Lock()
+	sentOffset := this.sentOffset
+	segmentList := make([]uint64, len(this.segmentList))
+	copy(segmentList, this.segmentList)
+	this.mutex.Unlock()
+
+	for index, startSeq := range segmentList {
+		if index+1 < len(segmentList) && segmentList[index+1] <= sentOffset {
+			continue
+		}
+		if startSeq >= endSeq {
+			break
+		}
+
+		isStopped := false
+		_, _, err := this.readSegment(startSeq, func(seq uint64, data []byte) bool {
+			if seq >= endSeq {
+				return false
+			}
+			if seq >= sentOffset && fn(seq, data) == false {
+				isStopped = true
+				return false
+			}
+
+			return true
+		})
+		if err != nil || isStopped {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 同步数据并保存已发送序号，然后关闭
+// 返回值:
+// 错误对象
+func (this *writeAheadLog) close() (err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.file == nil {
+		return nil
+	}
+	close(this.done)
+
+	err = this.checkpoint()
+	if e := this.file.Sync(); e != nil && err == nil {
+		err = e
+	}
+	if e := this.file.Close(); e != nil && err == nil {
+		err = e
+	}
+	this.file = nil
+
+	return
+}
+
+// 保存已发送序号，并删除已发送完成的段(需要持有锁)
+func (this *writeAheadLog) checkpoint() error {
+	tmpFileName := filepath.Join(this.folder, con_OFFSET_FILE_NAME+".tmp")
+	if err := ioutil.WriteFile(tmpFileName, []byte(strconv.FormatUint(this.sentOffset, 10)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFileName, filepath.Join(this.folder, con_OFFSET_FILE_NAME)); err != nil {
+		return err
+	}
+
+	this.unsavedCount = 0
+	this.removeSentSegments()
+	return nil
+}
+
+// 删除已发送完成的段(不包括当前写入的段)
+func (this *writeAheadLog) removeSentSegments() {
+	for len(this.segmentList) > 1 && this.segmentList[1] <= this.sentOffset {
+		fileName := this.getSegmentFileName(this.segmentList[0])
+		if err := os.Remove(fileName); err != nil && os.IsNotExist(err) == false {
+			logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog: remove %s failed:%s", fileName, err), logUtil.Error)
+			return
+		}
+
+		this.segmentList = this.segmentList[1:]
+	}
+}
+
+// 切换到新段(需要持有锁)
+func (this *writeAheadLog) roll() error {
+	if err := this.file.Sync(); err != nil {
+		return err
+	}
+	if err := this.file.Close(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(this.getSegmentFileName(this.nextSeq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		// 无法创建新段时继续写入原来的段
+		if file, err = os.OpenFile(this.getSegmentFileName(this.segmentList[len(this.segmentList)-1]), os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return err
+		}
+		this.file = file
+		return nil
+	}
+
+	this.file = file
+	this.fileSize = 0
+	this.segmentList = append(this.segmentList, this.nextSeq)
+	return nil
+}
+
+// 读取已保存的已发送序号
+func (this *writeAheadLog) readOffset() (uint64, error) {
+	content, err := ioutil.ReadFile(filepath.Join(this.folder, con_OFFSET_FILE_NAME))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// 加载段列表
+// 返回值:
+// 不属于预写日志的文件(旧版本的缓存文件)
+// 错误对象
+func (this *writeAheadLog) loadSegmentList() (legacyFileList []string, err error) {
+	fileInfoList, err := ioutil.ReadDir(this.folder)
+	if err != nil {
+		return
+	}
+
+	for _, fileInfo := range fileInfoList {
+		fileName := fileInfo.Name()
+		if fileInfo.IsDir() || strings.HasPrefix(fileName, con_OFFSET_FILE_NAME) {
+			continue
+		}
+
+		if strings.HasSuffix(fileName, con_SEGMENT_SUFFIX) {
+			startSeq, parseErr := strconv.ParseUint(strings.TrimSuffix(fileName, con_SEGMENT_SUFFIX), 10, 64)
+			if parseErr == nil {
+				this.segmentList = append(this.segmentList, startSeq)
+				continue
+			}
+		}
+
+		legacyFileList = append(legacyFileList, filepath.Join(this.folder, fileName))
+	}
+
+	sort.Slice(this.segmentList, func(i, j int) bool {
+		return this.segmentList[i] < this.segmentList[j]
+	})
+
+	return
+}
+
+// 打开最后一个段用于写入，并截断末尾不完整的记录
+func (this *writeAheadLog) openLastSegment() (err error) {
+	if len(this.segmentList) == 0 {
+		this.nextSeq = this.sentOffset
+		this.segmentList = []uint64{this.nextSeq}
+	} else {
+		lastSeq := this.segmentList[len(this.segmentList)-1]
+		var count uint64
+		if count, this.fileSize, err = this.readSegment(lastSeq, nil); err != nil {
+			return
+		}
+		this.nextSeq = lastSeq + count
+	}
+
+	this.file, err = os.OpenFile(this.getSegmentFileName(this.segmentList[len(this.segmentList)-1]), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	if err = this.file.Truncate(this.fileSize); err != nil {
+		this.file.Close()
+		return
+	}
+	if _, err = this.file.Seek(this.fileSize, io.SeekStart); err != nil {
+		this.file.Close()
+		return
+	}
+
+	// 已发送序号之前的记录已被删除时，从已发送序号开始写入新段
+	if this.nextSeq < this.sentOffset {
+		this.nextSeq = this.sentOffset
+		if this.fileSize > 0 {
+			if err = this.roll(); err != nil {
+				this.file.Close()
+				return
+			}
+		} else {
+			this.file.Close()
+			os.Remove(this.getSegmentFileName(this.segmentList[len(this.segmentList)-1]))
+			this.segmentList[len(this.segmentList)-1] = this.nextSeq
+			this.file, err = os.OpenFile(this.getSegmentFileName(this.nextSeq), os.O_CREATE|os.O_WRONLY, 0644)
+		}
+	}
+
+	return
+}
+
+// 读取段中的记录，遇到不完整或校验失败的记录时停止
+// startSeq:段的起始序号
+// fn:处理方法，可以为nil，返回false表示停止读取
+// 返回值:
+// 读取的记录数量
+// 读取的有效字节数
+// 错误对象
+func (this *writeAheadLog) readSegment(startSeq uint64, fn func(seq uint64, data []byte) bool) (count uint64, validSize int64, err error) {
+	file, err := os.Open(this.getSegmentFileName(startSeq))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	header := make([]byte, con_RECORD_HEADER_SIZE)
+	for {
+		if _, err = io.ReadFull(file, header); err != nil {
+			break
+		}
+
+		// 长度超过文件剩余大小的记录与末尾不完整的记录一样处理，避免按损坏的长度分配内存
+		dataSize := int64(binary.LittleEndian.Uint32(header[0:4]))
+		if dataSize > fileInfo.Size()-validSize-con_RECORD_HEADER_SIZE {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+
+		data := make([]byte, dataSize)
+		if _, err = io.ReadFull(file, data); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+			logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog: invalid record %d in %s", startSeq+count, this.getSegmentFileName(startSeq)), logUtil.Warn)
+			break
+		}
+
+		if fn != nil && fn(startSeq+count, data) == false {
+			break
+		}
+		count++
+		validSize += int64(con_RECORD_HEADER_SIZE + len(data))
+	}
+
+	// 末尾不完整的记录是写入时崩溃导致的，忽略即可
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return
+}
+
+// 导入旧版本的缓存文件(一条数据一个文件)，导入后删除
+func (this *writeAheadLog) importLegacyFiles(fileList []string) error {
+	for _, fileName := range fileList {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog: Failed To Read File: %s %s", err, fileName), logUtil.Error)
+			continue
+		}
+
+		if _, err = this.append(content); err != nil {
+			return err
+		}
+		if err = os.Remove(fileName); err != nil {
+			logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog: Failed To Delete File: %s %s", err, fileName), logUtil.Error)
+		}
+	}
+
+	return nil
+}
+
+// 按时间间隔同步到磁盘
+func (this *writeAheadLog) syncLoop() {
+	ticker := time.NewTicker(this.option.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-ticker.C:
+			this.mutex.Lock()
+			if this.isDirty && this.file != nil {
+				if err := this.file.Sync(); err != nil {
+					logUtil.NormalLog(fmt.Sprintf("ensureSendUtil.writeAheadLog.syncLoop: sync %s failed:%s", this.folder, err), logUtil.Error)
+				} else {
+					this.isDirty = false
+				}
+			}
+			this.mutex.Unlock()
+		}
+	}
+}
+
+// 获取段文件的完整路径
+func (this *writeAheadLog) getSegmentFileName(startSeq uint64) string {
+	return filepath.Join(this.folder, fmt.Sprintf("%020d%s", startSeq, con_SEGMENT_SUFFIX))
+}
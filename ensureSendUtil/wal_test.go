@@ -0,0 +1,131 @@
+package ensureSendUtil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 读取所有未发送的记录
+func replayAll(t *testing.T, log *writeAheadLog) (seqList []uint64, dataList []string) {
+	err := log.replay(log.getNextSeq(), func(seq uint64, data []byte) bool {
+		seqList = append(seqList, seq)
+		dataList = append(dataList, string(data))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func Test_wal(t *testing.T) {
+	folder := "./test_wal"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	// 旧版本的缓存文件会被导入
+	os.MkdirAll(folder, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(folder, "legacy"), []byte("legacy-msg"), 0644)
+
+	log, err := openWAL(folder, WALOption{SegmentSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = log.append([]byte(fmt.Sprintf("msg-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 确认前5条(legacy和msg-0~msg-3)以及乱序确认的msg-6
+	for seq := uint64(0); seq < 5; seq++ {
+		log.ack(seq)
+	}
+	log.ack(7)
+	if err = log.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 末尾写入不完整的记录，模拟写入时崩溃
+	segmentFileList, _ := filepath.Glob(filepath.Join(folder, "*"+con_SEGMENT_SUFFIX))
+	if len(segmentFileList) < 2 {
+		t.Fatalf("segments should be rolled, got %v", segmentFileList)
+	}
+	file, _ := os.OpenFile(segmentFileList[len(segmentFileList)-1], os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{100, 0, 0, 0, 1})
+	file.Close()
+
+	// 重启后只重发未确认的记录(乱序确认的记录会再次发送)
+	log, err = openWAL(folder, WALOption{SegmentSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqList, dataList := replayAll(t, log)
+	if fmt.Sprint(dataList) != "[msg-4 msg-5 msg-6 msg-7 msg-8 msg-9]" || seqList[0] != 5 {
+		t.Fatalf("bad replay: %v %v", seqList, dataList)
+	}
+
+	// 新记录的序号接着之前的序号
+	seq, err := log.append([]byte("msg-10"))
+	if err != nil || seq != 11 {
+		t.Fatalf("bad seq: %v %v", seq, err)
+	}
+
+	// 全部确认后只保留当前写入的段
+	for seq := uint64(5); seq <= 11; seq++ {
+		log.ack(seq)
+	}
+	if seqList, _ = replayAll(t, log); len(seqList) != 0 {
+		t.Fatalf("all records should be sent, got %v", seqList)
+	}
+	log.close()
+
+	if segmentFileList, _ = filepath.Glob(filepath.Join(folder, "*"+con_SEGMENT_SUFFIX)); len(segmentFileList) != 1 {
+		t.Fatalf("sent segments should be removed, got %v", segmentFileList)
+	}
+	if _, err = os.Stat(filepath.Join(folder, "legacy")); os.IsNotExist(err) == false {
+		t.Fatal("legacy file should be removed")
+	}
+}
+
+func Test_walCorruptLength(t *testing.T) {
+	folder := "./test_wal_corrupt"
+	os.RemoveAll(folder)
+	defer os.RemoveAll(folder)
+
+	log, err := openWAL(folder, WALOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.append([]byte("msg-0"))
+	log.append([]byte("msg-1"))
+	if err = log.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 末尾记录的长度字段损坏(接近4GB)，不能按该长度分配内存
+	segmentFileList, _ := filepath.Glob(filepath.Join(folder, "*"+con_SEGMENT_SUFFIX))
+	file, _ := os.OpenFile(segmentFileList[0], os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{0xf0, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5, 6})
+	file.Close()
+
+	log, err = openWAL(folder, WALOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.close()
+
+	if _, dataList := replayAll(t, log); fmt.Sprint(dataList) != "[msg-0 msg-1]" {
+		t.Fatalf("bad replay: %v", dataList)
+	}
+	if seq, err := log.append([]byte("msg-2")); err != nil || seq != 2 {
+		t.Fatalf("bad seq: %v %v", seq, err)
+	}
+	if _, dataList := replayAll(t, log); fmt.Sprint(dataList) != "[msg-0 msg-1 msg-2]" {
+		t.Fatalf("bad replay after append: %v", dataList)
+	}
+}
@@ -0,0 +1,659 @@
+package redisUtil
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// 集群的槽数量
+	con_SLOT_COUNT = 16384
+
+	// 单个命令最多跟随的重定向次数
+	con_MAX_REDIRECT_COUNT = 5
+
+	// 集群暂时不可用时的重试间隔
+	con_CLUSTER_RETRY_INTERVAL = 100 * time.Millisecond
+)
+
+// 集群对象，负责维护槽与节点的对应关系以及各节点的连接池
+type cluster struct {
+	// Redis配置对象
+	config *RedisConfig
+
+	// 种子节点地址列表
+	seedAddressList []string
+
+	// 槽对应的主节点地址
+	slotAddressList []string
+
+	// 节点地址对应的连接池
+	poolMap map[string]*redis.Pool
+
+	// 锁对象
+	mutex sync.RWMutex
+
+	// 是否正在刷新槽信息
+	refreshing int32
+
+	// 统计对象
+	stats *poolStats
+}
+
+// 获取所有节点的连接池
+// 返回值:
+// 连接池列表
+func (this *cluster) getPoolList() []*redis.Pool {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	poolList := make([]*redis.Pool, 0, len(this.poolMap))
+	for _, pool := range this.poolMap {
+		poolList = append(poolList, pool)
+	}
+
+	return poolList
+}
+
+// 获取指定节点的连接池，不存在则创建
+// address:节点地址
+// 返回值:
+// 连接池对象
+func (this *cluster) getPool(address string) *redis.Pool {
+	this.mutex.RLock()
+	pool, exists := this.poolMap[address]
+	this.mutex.RUnlock()
+	if exists {
+		return pool
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if pool, exists = this.poolMap[address]; exists {
+		return pool
+	}
+
+	pool = newPool(this.config, func() (redis.Conn, error) {
+		// 集群只支持0号数据库
+		return dial(address, this.config, false)
+	}, ping)
+	this.poolMap[address] = pool
+
+	return pool
+}
+
+// 获取key所在的主节点地址
+// key:key
+// 返回值:
+// 主节点地址
+// 错误对象
+func (this *cluster) getKeyAddress(key string) (address string, err error) {
+	slot := getKeySlot(key)
+
+	this.mutex.RLock()
+	address = this.slotAddressList[slot]
+	this.mutex.RUnlock()
+	if address != "" {
+		return
+	}
+
+	// 槽信息还未加载或者已失效，同步刷新一次
+	if err = this.refreshSlots(); err != nil {
+		return
+	}
+
+	this.mutex.RLock()
+	address = this.slotAddressList[slot]
+	this.mutex.RUnlock()
+	if address == "" {
+		err = fmt.Errorf("slot %d is not served by any node", slot)
+	}
+
+	return
+}
+
+// 获取任意一个节点地址(用于不包含key的命令)
+// 返回值:
+// 节点地址
+// 错误对象
+func (this *cluster) getAnyAddress() (address string, err error) {
+	addressList := this.getMasterAddressList()
+	if len(addressList) == 0 {
+		addressList = this.seedAddressList
+	}
+	if len(addressList) == 0 {
+		err = fmt.Errorf("cluster address is empty")
+		return
+	}
+
+	address = addressList[rand.Intn(len(addressList))]
+	return
+}
+
+// 获取当前所有主节点地址
+// 返回值:
+// 主节点地址列表(已排序)
+func (this *cluster) getMasterAddressList() []string {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	addressMap := make(map[string]bool)
+	for _, address := range this.slotAddressList {
+		if address != "" {
+			addressMap[address] = true
+		}
+	}
+
+	addressList := make([]string, 0, len(addressMap))
+	for address := range addressMap {
+		addressList = append(addressList, address)
+	}
+	sort.Strings(addressList)
+
+	return addressList
+}
+
+// 获取当前所有主节点地址，如果槽信息还未加载则先加载
+// 返回值:
+// 主节点地址列表(已排序)
+// 错误对象
+func (this *cluster) getNodeAddressList() (addressList []string, err error) {
+	if addressList = this.getMasterAddressList(); len(addressList) > 0 {
+		return
+	}
+
+	if err = this.refreshSlots(); err != nil {
+		return
+	}
+
+	addressList = this.getMasterAddressList()
+	return
+}
+
+// 更新单个槽对应的节点地址
+// slot:槽
+// address:节点地址
+func (this *cluster) setSlotAddress(slot int, address string) {
+	if slot < 0 || slot >= con_SLOT_COUNT {
+		return
+	}
+
+	this.mutex.Lock()
+	this.slotAddressList[slot] = address
+	this.mutex.Unlock()
+}
+
+// 从集群中重新加载槽与节点的对应关系
+// 返回值:
+// 错误对象
+func (this *cluster) refreshSlots() (err error) {
+	// 优先询问已知的主节点，然后才是种子节点
+	addressList := append(this.getMasterAddressList(), this.seedAddressList...)
+	for _, address := range addressList {
+		var slotAddressList []string
+		if slotAddressList, err = this.loadSlots(address); err != nil {
+			continue
+		}
+
+		this.mutex.Lock()
+		this.slotAddressList = slotAddressList
+		this.mutex.Unlock()
+
+		return
+	}
+
+	if err == nil {
+		err = fmt.Errorf("cluster address is empty")
+	}
+
+	return
+}
+
+// 异步刷新槽信息(同一时间只会有一个刷新在进行)
+func (this *cluster) triggerRefresh() {
+	if !atomic.CompareAndSwapInt32(&this.refreshing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&this.refreshing, 0)
+		this.refreshSlots()
+	}()
+}
+
+// 通过CLUSTER SLOTS命令从指定节点获取槽信息
+// address:节点地址
+// 返回值:
+// 槽对应的主节点地址
+// 错误对象
+func (this *cluster) loadSlots(address string) (slotAddressList []string, err error) {
+	conn := this.getPool(address).Get()
+	defer conn.Close()
+
+	var slotInfoList []interface{}
+	if slotInfoList, err = redis.Values(conn.Do("CLUSTER", "SLOTS")); err != nil {
+		return
+	}
+	if len(slotInfoList) == 0 {
+		err = fmt.Errorf("node %s does not serve any slot", address)
+		return
+	}
+
+	// 节点可能以空字符串表示自身的ip
+	defaultHost, _, _ := net.SplitHostPort(address)
+
+	slotAddressList = make([]string, con_SLOT_COUNT)
+	for _, item := range slotInfoList {
+		var slotInfo []interface{}
+		if slotInfo, err = redis.Values(item, nil); err != nil {
+			return
+		}
+		if len(slotInfo) < 3 {
+			continue
+		}
+
+		var start, end, port int
+		var host string
+		var nodeInfo []interface{}
+		if start, err = redis.Int(slotInfo[0], nil); err != nil {
+			return
+		}
+		if end, err = redis.Int(slotInfo[1], nil); err != nil {
+			return
+		}
+		if nodeInfo, err = redis.Values(slotInfo[2], nil); err != nil {
+			return
+		}
+		if len(nodeInfo) < 2 {
+			continue
+		}
+		if host, err = redis.String(nodeInfo[0], nil); err != nil {
+			return
+		}
+		if port, err = redis.Int(nodeInfo[1], nil); err != nil {
+			return
+		}
+		if host == "" {
+			host = defaultHost
+		}
+
+		nodeAddress := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < con_SLOT_COUNT; slot++ {
+			slotAddressList[slot] = nodeAddress
+		}
+	}
+
+	return
+}
+
+// 执行命令，并自动跟随MOVED和ASK重定向
+// commandName:命令名称
+// args:命令参数
+// doFunc:在节点连接上执行命令的方法(用于指定超时时间)，nil表示使用conn.Do
+// 返回值:
+// 命令结果
+// 错误对象
+func (this *cluster) do(commandName string, args []interface{}, doFunc func(conn redis.Conn) (interface{}, error)) (reply interface{}, err error) {
+	if doFunc == nil {
+		doFunc = func(conn redis.Conn) (interface{}, error) {
+			return conn.Do(commandName, args...)
+		}
+	}
+
+	var address string
+	if key, exists := getCommandKey(commandName, args); exists {
+		address, err = this.getKeyAddress(key)
+	} else {
+		address, err = this.getAnyAddress()
+	}
+	if err != nil {
+		return
+	}
+
+	isAsking := false
+	for i := 0; i <= con_MAX_REDIRECT_COUNT; i++ {
+		conn := getPoolConn(this.getPool(address), this.stats)
+		if isAsking {
+			conn.Send("ASKING")
+		}
+		reply, err = doFunc(conn)
+		conn.Close()
+
+		redisErr, ok := err.(redis.Error)
+		if !ok {
+			// 网络错误时节点可能已经下线，刷新槽信息以便后续命令发往新的主节点
+			if err != nil {
+				this.triggerRefresh()
+			}
+
+			return
+		}
+
+		errMsg := string(redisErr)
+		switch {
+		case strings.HasPrefix(errMsg, "MOVED "):
+			slot, newAddress, parseErr := parseRedirect(errMsg)
+			if parseErr != nil {
+				return
+			}
+
+			this.setSlotAddress(slot, newAddress)
+			this.triggerRefresh()
+			address, isAsking = newAddress, false
+		case strings.HasPrefix(errMsg, "ASK "):
+			_, newAddress, parseErr := parseRedirect(errMsg)
+			if parseErr != nil {
+				return
+			}
+
+			address, isAsking = newAddress, true
+		case strings.HasPrefix(errMsg, "TRYAGAIN"), strings.HasPrefix(errMsg, "CLUSTERDOWN"):
+			time.Sleep(con_CLUSTER_RETRY_INTERVAL)
+		default:
+			return
+		}
+	}
+
+	return
+}
+
+// 关闭所有节点的连接池
+func (this *cluster) close() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for address, pool := range this.poolMap {
+		pool.Close()
+		delete(this.poolMap, address)
+	}
+}
+
+// 创建集群对象
+// config:Redis配置对象
+// stats:统计对象
+// 返回值:
+// 集群对象
+func newCluster(config *RedisConfig, stats *poolStats) *cluster {
+	return &cluster{
+		config:          config,
+		seedAddressList: config.GetAddressList(),
+		slotAddressList: make([]string, con_SLOT_COUNT),
+		poolMap:         make(map[string]*redis.Pool),
+		stats:           stats,
+	}
+}
+
+// 集群命令
+type clusterCommand struct {
+	commandName string
+	args        []interface{}
+}
+
+// 集群连接对象，实现redis.Conn接口
+// Do会根据key路由到对应节点并跟随重定向；
+// Send/Flush/Receive(管道、事务)会绑定到第一个包含key的命令所在的节点，所以同一管道内的key需要位于同一个节点(可使用{hashtag})
+type clusterConn struct {
+	// 集群对象
+	cluster *cluster
+
+	// 绑定的节点连接
+	conn redis.Conn
+
+	// 尚未确定节点的命令(如MULTI)
+	pendingList []clusterCommand
+}
+
+// 关闭连接
+func (this *clusterConn) Close() error {
+	this.pendingList = nil
+	if this.conn == nil {
+		return nil
+	}
+
+	err := this.conn.Close()
+	this.conn = nil
+
+	return err
+}
+
+// 连接是否可用
+func (this *clusterConn) Err() error {
+	if this.conn == nil {
+		return nil
+	}
+
+	return this.conn.Err()
+}
+
+// 执行命令
+func (this *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	// 已经进入管道或事务时，需要在同一个节点连接上执行
+	if this.conn != nil || len(this.pendingList) > 0 {
+		if err := this.bind(commandName, args); err != nil {
+			return nil, err
+		}
+
+		return this.conn.Do(commandName, args...)
+	}
+
+	if commandName == "" {
+		return nil, nil
+	}
+
+	return this.cluster.do(commandName, args, nil)
+}
+
+// 以指定的读取超时时间执行命令，实现redis.ConnWithTimeout接口
+func (this *clusterConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	if this.conn != nil || len(this.pendingList) > 0 {
+		if err := this.bind(commandName, args); err != nil {
+			return nil, err
+		}
+
+		return redis.DoWithTimeout(this.conn, timeout, commandName, args...)
+	}
+
+	if commandName == "" {
+		return nil, nil
+	}
+
+	return this.cluster.do(commandName, args, func(conn redis.Conn) (interface{}, error) {
+		return redis.DoWithTimeout(conn, timeout, commandName, args...)
+	})
+}
+
+// 将命令写入缓冲区
+func (this *clusterConn) Send(commandName string, args ...interface{}) error {
+	if this.conn == nil {
+		if _, exists := getCommandKey(commandName, args); !exists {
+			this.pendingList = append(this.pendingList, clusterCommand{commandName: commandName, args: args})
+			return nil
+		}
+	}
+
+	if err := this.bind(commandName, args); err != nil {
+		return err
+	}
+
+	return this.conn.Send(commandName, args...)
+}
+
+// 将缓冲区的命令发送到节点
+func (this *clusterConn) Flush() error {
+	if err := this.bind("", nil); err != nil {
+		return err
+	}
+
+	return this.conn.Flush()
+}
+
+// 接收一个回复
+func (this *clusterConn) Receive() (interface{}, error) {
+	if this.conn == nil {
+		return nil, errors.New("cluster connection has no pending command")
+	}
+
+	return this.conn.Receive()
+}
+
+// 以指定的读取超时时间接收一个回复，实现redis.ConnWithTimeout接口
+func (this *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if this.conn == nil {
+		return nil, errors.New("cluster connection has no pending command")
+	}
+
+	return redis.ReceiveWithTimeout(this.conn, timeout)
+}
+
+// 将连接绑定到命令所在的节点，并发送之前缓存的命令
+// commandName:命令名称
+// args:命令参数
+// 返回值:
+// 错误对象
+func (this *clusterConn) bind(commandName string, args []interface{}) (err error) {
+	if this.conn != nil {
+		return
+	}
+
+	var address string
+	if key, exists := getCommandKey(commandName, args); exists {
+		address, err = this.cluster.getKeyAddress(key)
+	} else {
+		address, err = this.cluster.getAnyAddress()
+	}
+	if err != nil {
+		return
+	}
+
+	this.conn = getPoolConn(this.cluster.getPool(address), this.cluster.stats)
+	for _, item := range this.pendingList {
+		if err = this.conn.Send(item.commandName, item.args...); err != nil {
+			return
+		}
+	}
+	this.pendingList = nil
+
+	return
+}
+
+// 解析MOVED和ASK错误
+// errMsg:错误信息，格式为：MOVED 3999 127.0.0.1:6381
+// 返回值:
+// 槽
+// 节点地址
+// 错误对象
+func parseRedirect(errMsg string) (slot int, address string, err error) {
+	itemList := strings.Fields(errMsg)
+	if len(itemList) != 3 {
+		err = fmt.Errorf("invalid redirect:%s", errMsg)
+		return
+	}
+
+	if slot, err = strconv.Atoi(itemList[1]); err != nil {
+		return
+	}
+	address = itemList[2]
+
+	return
+}
+
+// 获取key对应的槽，支持{hashtag}
+// key:key
+// 返回值:
+// 槽
+func getKeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16([]byte(key)) % con_SLOT_COUNT)
+}
+
+// 计算CRC16(XMODEM)，与Redis集群的算法一致
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// 获取命令用于路由的key
+// commandName:命令名称
+// args:命令参数
+// 返回值:
+// key
+// 是否包含key
+func getCommandKey(commandName string, args []interface{}) (key string, exists bool) {
+	switch strings.ToUpper(commandName) {
+	case "", "PING", "ECHO", "INFO", "TIME", "ROLE", "AUTH", "SELECT", "ASKING", "READONLY", "READWRITE",
+		"MULTI", "EXEC", "DISCARD", "UNWATCH", "SCRIPT", "CLUSTER", "DBSIZE", "FLUSHDB", "FLUSHALL",
+		"KEYS", "SCAN", "RANDOMKEY", "PUBLISH", "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return
+	case "EVAL", "EVALSHA":
+		if len(args) < 3 {
+			return
+		}
+		if keyCount, err := strconv.Atoi(argToString(args[1])); err != nil || keyCount <= 0 {
+			return
+		}
+
+		return argToString(args[2]), true
+	case "XREAD", "XREADGROUP":
+		for index, arg := range args {
+			if strings.ToUpper(argToString(arg)) == "STREAMS" && index+1 < len(args) {
+				return argToString(args[index+1]), true
+			}
+		}
+
+		return
+	case "XGROUP", "XINFO":
+		// 第一个参数为子命令
+		if len(args) < 2 {
+			return
+		}
+
+		return argToString(args[1]), true
+	}
+
+	if len(args) == 0 {
+		return
+	}
+
+	return argToString(args[0]), true
+}
+
+// 将命令参数转换为字符串
+func argToString(arg interface{}) string {
+	switch value := arg.(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case redis.Argument:
+		return fmt.Sprint(value.RedisArg())
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,81 @@
+package redisUtil
+
+import (
+	"testing"
+)
+
+func TestGetKeySlot(t *testing.T) {
+	// 期望值来自redis-cli的CLUSTER KEYSLOT命令
+	expectMap := map[string]int{
+		"foo":            12182,
+		"bar":            5061,
+		"123456789":      12739,
+		"{user1000}.a":   3443,
+		"{user1000}.b":   3443,
+		"foo{}{bar}":     8363,
+		"foo{{bar}}zap":  4015,
+		"foo{bar}{zap}":  5061,
+		"":               0,
+		"{}":             15257,
+		"user1000":       3443,
+		"abc{user1000}d": 3443,
+	}
+
+	for key, expect := range expectMap {
+		if slot := getKeySlot(key); slot != expect {
+			t.Errorf("slot of %s expected %d, but got %d", key, expect, slot)
+		}
+	}
+}
+
+func TestGetCommandKey(t *testing.T) {
+	if key, exists := getCommandKey("GET", []interface{}{"a"}); !exists || key != "a" {
+		t.Errorf("GET key expected a, but got %s", key)
+	}
+	if _, exists := getCommandKey("PING", nil); exists {
+		t.Errorf("PING should not contain key")
+	}
+	if key, exists := getCommandKey("EVALSHA", []interface{}{"sha", 1, []byte("b"), "arg"}); !exists || key != "b" {
+		t.Errorf("EVALSHA key expected b, but got %s", key)
+	}
+	if _, exists := getCommandKey("EVAL", []interface{}{"return 1", 0}); exists {
+		t.Errorf("EVAL without key should not contain key")
+	}
+	if key, exists := getCommandKey("XREADGROUP", []interface{}{"GROUP", "g", "c", "COUNT", 1, "STREAMS", "s", ">"}); !exists || key != "s" {
+		t.Errorf("XREADGROUP key expected s, but got %s", key)
+	}
+	if key, exists := getCommandKey("XGROUP", []interface{}{"CREATE", "s", "g", "0"}); !exists || key != "s" {
+		t.Errorf("XGROUP key expected s, but got %s", key)
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	slot, address, err := parseRedirect("MOVED 3999 127.0.0.1:6381")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if slot != 3999 || address != "127.0.0.1:6381" {
+		t.Errorf("bad redirect: %d %s", slot, address)
+	}
+
+	if _, _, err = parseRedirect("MOVED 3999"); err == nil {
+		t.Errorf("should be error")
+	}
+}
+
+func TestNewRedisConfigMode(t *testing.T) {
+	redisConfig, err := NewRedisConfig("ConnectionString=10.1.0.21:26379,10.1.0.22:26379;Password=pwd;Database=3;MaxActive=50;MaxIdle=20;IdleTimeout=300;DialConnectTimeout=10;Mode=Sentinel;MasterName=mymaster;")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if redisConfig.Mode != Mode_Sentinel || redisConfig.MasterName != "mymaster" {
+		t.Errorf("bad config: %v", redisConfig)
+	}
+	if addressList := redisConfig.GetAddressList(); len(addressList) != 2 || addressList[1] != "10.1.0.22:26379" {
+		t.Errorf("bad address list: %v", addressList)
+	}
+
+	if _, err = NewRedisConfig("ConnectionString=10.1.0.21:26379;Password=pwd;Database=3;MaxActive=50;MaxIdle=20;IdleTimeout=300;DialConnectTimeout=10;Mode=Sentinel;"); err == nil {
+		t.Errorf("sentinel mode without MasterName should be error")
+	}
+}
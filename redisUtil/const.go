@@ -33,3 +33,31 @@ type RedisField string
 
 // redis关键字
 type RedisKey string
+
+// Redis部署模式
+type RedisMode string
+
+const (
+	// 单机模式
+	Mode_Standalone RedisMode = ""
+
+	// 哨兵模式：ConnectionString为以逗号分隔的哨兵地址列表，通过MasterName获取主节点
+	Mode_Sentinel RedisMode = "Sentinel"
+
+	// 集群模式：ConnectionString为以逗号分隔的集群种子节点地址列表
+	Mode_Cluster RedisMode = "Cluster"
+)
+
+// 有序集合合并时分数的聚合方式
+type AggregateType string
+
+const (
+	// 求和(默认)
+	Aggregate_Sum AggregateType = ""
+
+	// 取最小值
+	Aggregate_Min AggregateType = "MIN"
+
+	// 取最大值
+	Aggregate_Max AggregateType = "MAX"
+)
@@ -0,0 +1,293 @@
+package redisUtil
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/logUtil"
+	"github.com/polariseye/goutil/stringUtil"
+)
+
+const (
+	// 加锁失败后的重试间隔
+	con_LOCK_RETRY_INTERVAL = 20 * time.Millisecond
+
+	// 加锁：设置成功后递增栅栏令牌并返回，失败返回0
+	con_LOCK_ACQUIRE_SCRIPT = `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`
+
+	// 解锁：只有令牌相同才删除
+	con_LOCK_RELEASE_SCRIPT = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+	// 续期：只有令牌相同才更新过期时间
+	con_LOCK_EXTEND_SCRIPT = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+)
+
+// 分布式锁对象
+// 通过SET NX PX加锁，value为随机令牌，解锁和续期时通过Lua脚本比较令牌，避免误删其它进程持有的锁；
+// 持有锁期间由看门狗协程按过期时间的1/3定时续期，进程异常退出时锁在过期后自动释放；
+// 每次加锁成功都会生成一个单调递增的栅栏令牌(FencingToken)，下游存储可以据此拒绝过期持有者的写入
+// 与syncUtil.Locker一样实现了syncUtil.ILocker接口
+type DistributedLocker struct {
+	redisPool *RedisPool
+
+	// 锁的key
+	key string
+
+	// 栅栏令牌的key(与锁的key位于同一个槽)
+	fencingKey string
+
+	// 锁的过期时间
+	expire time.Duration
+
+	// 锁对象，保护以下字段
+	mutex sync.Mutex
+
+	// 当前持有的令牌，为空表示未持有
+	token string
+
+	// 当前的栅栏令牌
+	fencingToken int64
+
+	// 用于停止看门狗协程
+	watchdogStop chan struct{}
+}
+
+// 创建分布式锁对象
+// key:锁的key
+// expire:锁的过期时间，持有期间会自动续期(不能小于1毫秒)
+// 返回值:
+// 分布式锁对象
+func (this *RedisPool) NewDistributedLocker(key string, expire time.Duration) *DistributedLocker {
+	if expire < time.Millisecond {
+		expire = time.Millisecond
+	}
+
+	// 集群模式下Lua脚本访问的key必须在同一个槽
+	fencingKey := key + ":fencing"
+	if getKeySlot(fencingKey) != getKeySlot(key) {
+		fencingKey = "{" + key + "}:fencing"
+	}
+
+	return &DistributedLocker{
+		redisPool:  this,
+		key:        key,
+		fencingKey: fencingKey,
+		expire:     expire,
+	}
+}
+
+// 尝试加锁一次
+// 返回值:
+// 是否成功
+// 错误对象
+func (this *DistributedLocker) TryLock() (success bool, err error) {
+	scriptObj, err := this.redisPool.RegisterScript("redisUtil.lock.acquire", 2, con_LOCK_ACQUIRE_SCRIPT)
+	if err != nil {
+		return
+	}
+
+	token := stringUtil.GetNewGUID()
+	if token == "" {
+		err = fmt.Errorf("generate lock token failed")
+		return
+	}
+
+	var fencingToken int64
+	if fencingToken, err = scriptObj.Run(this.key, this.fencingKey, token, int64(this.expire/time.Millisecond)).Int64(); err != nil {
+		return
+	}
+	if fencingToken == 0 {
+		return
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.stopWatchdog()
+	this.token = token
+	this.fencingToken = fencingToken
+	this.watchdogStop = make(chan struct{})
+	go this.watchdog(token, this.watchdogStop)
+
+	success = true
+
+	return
+}
+
+// 尝试加锁，如果在指定的时间内失败，则会返回失败；否则返回成功
+// timeout:指定的毫秒数,timeout<=0则将会死等
+// 返回值：
+// 成功或失败(访问Redis出错时会记录日志并继续重试，直到超时)
+func (this *DistributedLocker) Lock(timeout int) bool {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+
+	for {
+		success, err := this.TryLock()
+		if err != nil {
+			logUtil.NormalLog(fmt.Sprintf("redisUtil.DistributedLocker: 加锁%s失败，错误信息为：%s", this.key, err), logUtil.Error)
+		}
+		if success {
+			return true
+		}
+
+		if timeout > 0 && !time.Now().Add(con_LOCK_RETRY_INTERVAL).Before(deadline) {
+			return false
+		}
+
+		time.Sleep(con_LOCK_RETRY_INTERVAL)
+	}
+}
+
+// 锁定（死等方式）
+func (this *DistributedLocker) WaitLock() {
+	this.Lock(-1)
+}
+
+// 解锁(出错时记录日志，锁会在过期后自动释放)
+func (this *DistributedLocker) Unlock() {
+	if _, err := this.Release(); err != nil {
+		logUtil.NormalLog(fmt.Sprintf("redisUtil.DistributedLocker: 解锁%s失败，错误信息为：%s", this.key, err), logUtil.Error)
+	}
+}
+
+// 释放锁
+// 返回值:
+// 是否释放成功(锁已过期或被其它持有者获取时返回false)
+// 错误对象
+func (this *DistributedLocker) Release() (success bool, err error) {
+	this.mutex.Lock()
+	token := this.token
+	this.token = ""
+	this.stopWatchdog()
+	this.mutex.Unlock()
+
+	if token == "" {
+		return
+	}
+
+	scriptObj, err := this.redisPool.RegisterScript("redisUtil.lock.release", 1, con_LOCK_RELEASE_SCRIPT)
+	if err != nil {
+		return
+	}
+
+	success, err = scriptObj.Run(this.key, token).Bool()
+	return
+}
+
+// 延长锁的过期时间(看门狗会自动续期，一般不需要手动调用)
+// expire:新的过期时间
+// 返回值:
+// 是否成功(锁已过期或被其它持有者获取时返回false)
+// 错误对象
+func (this *DistributedLocker) Extend(expire time.Duration) (success bool, err error) {
+	this.mutex.Lock()
+	token := this.token
+	this.mutex.Unlock()
+
+	if token == "" {
+		return
+	}
+
+	return this.extend(token, expire)
+}
+
+// 获取当前的栅栏令牌，每次加锁成功都会递增，未持有锁时为0
+// 返回值:
+// 栅栏令牌
+func (this *DistributedLocker) FencingToken() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.token == "" {
+		return 0
+	}
+
+	return this.fencingToken
+}
+
+// 本对象是否持有锁(只反映本地状态，续期失败后会变为false)
+// 返回值:
+// 是否持有锁
+func (this *DistributedLocker) IsLocked() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.token != ""
+}
+
+// 延长指定令牌的过期时间
+func (this *DistributedLocker) extend(token string, expire time.Duration) (success bool, err error) {
+	scriptObj, err := this.redisPool.RegisterScript("redisUtil.lock.extend", 1, con_LOCK_EXTEND_SCRIPT)
+	if err != nil {
+		return
+	}
+
+	success, err = scriptObj.Run(this.key, token, int64(expire/time.Millisecond)).Bool()
+	return
+}
+
+// 停止看门狗协程(需要在锁内调用)
+func (this *DistributedLocker) stopWatchdog() {
+	if this.watchdogStop == nil {
+		return
+	}
+
+	close(this.watchdogStop)
+	this.watchdogStop = nil
+}
+
+// 看门狗协程：定时续期，直到解锁或者锁已丢失
+func (this *DistributedLocker) watchdog(token string, stop chan struct{}) {
+	interval := this.expire / 3
+	if interval <= 0 {
+		interval = this.expire
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		success, err := this.extend(token, this.expire)
+		if err != nil {
+			// 网络异常时继续重试，锁过期之前恢复即可
+			logUtil.NormalLog(fmt.Sprintf("redisUtil.DistributedLocker: 续期%s失败，错误信息为：%s", this.key, err), logUtil.Warn)
+			continue
+		}
+		if success {
+			continue
+		}
+
+		// 锁已过期或被其它持有者获取
+		logUtil.NormalLog(fmt.Sprintf("redisUtil.DistributedLocker: %s的锁已丢失", this.key), logUtil.Warn)
+
+		this.mutex.Lock()
+		if this.token == token {
+			this.token = ""
+			this.watchdogStop = nil
+		}
+		this.mutex.Unlock()
+
+		return
+	}
+}
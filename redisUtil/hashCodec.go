@@ -0,0 +1,485 @@
+package redisUtil
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Hash字段的自定义序列化接口
+type HashFieldMarshaler interface {
+	MarshalRedisField() ([]byte, error)
+}
+
+// Hash字段的自定义反序列化接口
+type HashFieldUnmarshaler interface {
+	UnmarshalRedisField(data []byte) error
+}
+
+var (
+	hashFieldUnmarshalerType = reflect.TypeOf((*HashFieldUnmarshaler)(nil)).Elem()
+	textUnmarshalerType      = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType                 = reflect.TypeOf(time.Time{})
+
+	// 结构体的字段信息缓存
+	hashStructMap = new(sync.Map)
+)
+
+// 结构体字段与Hash字段的对应关系
+type hashFieldSpec struct {
+	// Hash字段名
+	name string
+
+	// 结构体字段的索引(匿名嵌入的结构体会展开)
+	index []int
+
+	// 为空值时是否忽略
+	isOmitEmpty bool
+}
+
+// 结构体与Hash的对应关系
+type hashStructSpec struct {
+	fieldList []*hashFieldSpec
+	fieldMap  map[string]*hashFieldSpec
+}
+
+// 将结构体对象转换为HMSET使用的参数(field1,value1,field2,value2...)
+// 字段通过tag指定Hash字段名：`redis:"name,omitempty"`，"-"表示忽略该字段，未指定时使用字段名；匿名嵌入的结构体会展开
+// 字段值的转换规则：
+// 1.实现了HashFieldMarshaler或encoding.TextMarshaler的类型使用对应的方法
+// 2.time.Time使用RFC3339Nano格式
+// 3.字符串、[]byte、数字、bool直接转换为字符串
+// 4.其它结构体、map、切片、数组使用JSON格式
+// 5.nil指针、nil interface{}(包括多层指针中的nil)以及omitempty时的空值会被忽略
+// value:结构体对象或其指针
+// 返回值:
+// 参数列表
+// 错误对象
+func MarshalHash(value interface{}) (args redis.Args, err error) {
+	structValue, err := getStructValue(value, false)
+	if err != nil {
+		return
+	}
+
+	spec := getHashStructSpec(structValue.Type())
+	args = make(redis.Args, 0, len(spec.fieldList)*2)
+	for _, fieldSpec := range spec.fieldList {
+		fieldValue, exists := getFieldByIndex(structValue, fieldSpec.index)
+		if !exists {
+			continue
+		}
+		if isNilValue(fieldValue) {
+			continue
+		}
+		if fieldSpec.isOmitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+
+		var data []byte
+		if data, err = marshalHashField(fieldValue); err != nil {
+			err = fmt.Errorf("marshal field %s failed, err:%s", fieldSpec.name, err)
+			return
+		}
+
+		args = append(args, fieldSpec.name, data)
+	}
+
+	return
+}
+
+// 将HGETALL的回复(field1,value1,field2,value2...)赋值给结构体对象，规则与MarshalHash相同，不存在的字段会被忽略
+// reply:HGETALL的回复
+// value:结构体对象的指针
+// 返回值:
+// 错误对象
+func UnmarshalHash(reply []interface{}, value interface{}) error {
+	if len(reply)%2 != 0 {
+		return fmt.Errorf("the count of reply must be even")
+	}
+
+	structValue, err := getStructValue(value, true)
+	if err != nil {
+		return err
+	}
+
+	spec := getHashStructSpec(structValue.Type())
+	for index := 0; index < len(reply); index += 2 {
+		name, err := redis.String(reply[index], nil)
+		if err != nil {
+			return err
+		}
+
+		fieldSpec, exists := spec.fieldMap[name]
+		if !exists || reply[index+1] == nil {
+			continue
+		}
+
+		data, err := redis.Bytes(reply[index+1], nil)
+		if err != nil {
+			return err
+		}
+
+		if err = unmarshalHashField(allocFieldByIndex(structValue, fieldSpec.index), data); err != nil {
+			return fmt.Errorf("unmarshal field %s failed, err:%s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// 获取结构体对应的所有Hash字段名
+// value:结构体对象或其指针
+// 返回值:
+// Hash字段名列表
+// 错误对象
+func getHashFieldNames(value interface{}) (nameList []string, err error) {
+	structValue, err := getStructValue(value, false)
+	if err != nil {
+		return
+	}
+
+	spec := getHashStructSpec(structValue.Type())
+	nameList = make([]string, 0, len(spec.fieldList))
+	for _, fieldSpec := range spec.fieldList {
+		nameList = append(nameList, fieldSpec.name)
+	}
+
+	return
+}
+
+// 获取HMSET使用的参数，map使用redigo的方式展开，结构体使用MarshalHash
+func getHashArgs(key string, value interface{}) (args redis.Args, err error) {
+	reflectValue := reflect.ValueOf(value)
+	if reflectValue.Kind() == reflect.Map {
+		args = redis.Args{}.Add(key).AddFlat(value)
+		return
+	}
+
+	var fieldArgs redis.Args
+	if fieldArgs, err = MarshalHash(value); err != nil {
+		return
+	}
+
+	args = make(redis.Args, 0, len(fieldArgs)+1)
+	args = append(args, key)
+	args = append(args, fieldArgs...)
+
+	return
+}
+
+// 获取结构体对象
+// value:结构体对象或其指针
+// isSettable:是否需要可以赋值(必须为非nil指针)
+func getStructValue(value interface{}, isSettable bool) (structValue reflect.Value, err error) {
+	structValue = reflect.ValueOf(value)
+	if structValue.Kind() == reflect.Ptr {
+		if structValue.IsNil() {
+			err = fmt.Errorf("value must not be nil")
+			return
+		}
+		structValue = structValue.Elem()
+	} else if isSettable {
+		err = fmt.Errorf("value must be a pointer to struct, but now is %T", value)
+		return
+	}
+
+	if structValue.Kind() != reflect.Struct {
+		err = fmt.Errorf("value must be a struct or a pointer to struct, but now is %T", value)
+		return
+	}
+
+	return
+}
+
+// 获取结构体与Hash的对应关系
+func getHashStructSpec(structType reflect.Type) *hashStructSpec {
+	if spec, exists := hashStructMap.Load(structType); exists {
+		return spec.(*hashStructSpec)
+	}
+
+	spec := &hashStructSpec{
+		fieldMap: make(map[string]*hashFieldSpec),
+	}
+	compileHashStructSpec(structType, nil, spec)
+	hashStructMap.Store(structType, spec)
+
+	return spec
+}
+
+// 解析结构体的字段
+// 外层的字段优先，同名的嵌入字段会被忽略
+func compileHashStructSpec(structType reflect.Type, parentIndex []int, spec *hashStructSpec) {
+	// 嵌入的结构体在本层字段之后处理
+	var embeddedList []reflect.Type
+	var embeddedIndexList [][]int
+	defer func() {
+		for i, embeddedType := range embeddedList {
+			compileHashStructSpec(embeddedType, embeddedIndexList[i], spec)
+		}
+	}()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+
+		index := make([]int, len(parentIndex)+1)
+		copy(index, parentIndex)
+		index[len(parentIndex)] = i
+
+		// 展开匿名嵌入且没有指定名称的结构体
+		if field.Anonymous && tag == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				// 未导出类型的指针无法自动创建
+				if field.PkgPath != "" {
+					continue
+				}
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct && fieldType != timeType {
+				embeddedList = append(embeddedList, fieldType)
+				embeddedIndexList = append(embeddedIndexList, index)
+				continue
+			}
+		}
+
+		// 忽略未导出的字段
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldSpec := &hashFieldSpec{
+			name:  field.Name,
+			index: index,
+		}
+		if tag != "" {
+			optionList := strings.Split(tag, ",")
+			if optionList[0] != "" {
+				fieldSpec.name = optionList[0]
+			}
+			for _, option := range optionList[1:] {
+				if option == "omitempty" {
+					fieldSpec.isOmitEmpty = true
+				}
+			}
+		}
+
+		if _, exists := spec.fieldMap[fieldSpec.name]; exists {
+			continue
+		}
+
+		spec.fieldList = append(spec.fieldList, fieldSpec)
+		spec.fieldMap[fieldSpec.name] = fieldSpec
+	}
+}
+
+// 获取字段，中间的嵌入指针为nil时返回false
+func getFieldByIndex(structValue reflect.Value, index []int) (fieldValue reflect.Value, exists bool) {
+	fieldValue = structValue
+	for i, fieldIndex := range index {
+		if i > 0 && fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				return
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		fieldValue = fieldValue.Field(fieldIndex)
+	}
+
+	exists = true
+
+	return
+}
+
+// 获取字段，中间的嵌入指针为nil时自动创建
+func allocFieldByIndex(structValue reflect.Value, index []int) reflect.Value {
+	fieldValue := structValue
+	for i, fieldIndex := range index {
+		if i > 0 && fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		fieldValue = fieldValue.Field(fieldIndex)
+	}
+
+	return fieldValue
+}
+
+// 判断是否为空值
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+
+	if value.Type() == timeType {
+		return value.Interface().(time.Time).IsZero()
+	}
+
+	return value.IsZero()
+}
+
+// 判断是否为nil(包括多层指针或interface{}中的nil)
+func isNilValue(value reflect.Value) bool {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return true
+		}
+		value = value.Elem()
+	}
+
+	return !value.IsValid()
+}
+
+// 将字段值转换为字节数组
+func marshalHashField(value reflect.Value) ([]byte, error) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, fmt.Errorf("nil value")
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil, fmt.Errorf("invalid value")
+	}
+
+	if value.CanInterface() {
+		switch item := value.Interface().(type) {
+		case HashFieldMarshaler:
+			return item.MarshalRedisField()
+		case time.Time:
+			return []byte(item.Format(time.RFC3339Nano)), nil
+		case encoding.TextMarshaler:
+			return item.MarshalText()
+		}
+
+		// 方法定义在指针上的情况
+		if value.CanAddr() {
+			switch item := value.Addr().Interface().(type) {
+			case HashFieldMarshaler:
+				return item.MarshalRedisField()
+			case encoding.TextMarshaler:
+				return item.MarshalText()
+			}
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return []byte(value.String()), nil
+	case reflect.Bool:
+		// 与redigo保持一致
+		if value.Bool() {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []byte(strconv.FormatInt(value.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return []byte(strconv.FormatUint(value.Uint(), 10)), nil
+	case reflect.Float32:
+		return []byte(strconv.FormatFloat(value.Float(), 'g', -1, 32)), nil
+	case reflect.Float64:
+		return []byte(strconv.FormatFloat(value.Float(), 'g', -1, 64)), nil
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Bytes(), nil
+		}
+	}
+
+	return json.Marshal(value.Interface())
+}
+
+// 将字节数组赋值给字段
+func unmarshalHashField(value reflect.Value, data []byte) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+
+		return unmarshalHashField(value.Elem(), data)
+	}
+
+	if value.CanAddr() {
+		addrType := value.Addr().Type()
+		switch {
+		case addrType.Implements(hashFieldUnmarshalerType):
+			return value.Addr().Interface().(HashFieldUnmarshaler).UnmarshalRedisField(data)
+		case value.Type() == timeType:
+			return unmarshalTime(value, data)
+		case addrType.Implements(textUnmarshalerType):
+			return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(data)
+		}
+	}
+
+	text := string(data)
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		result, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(result)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result, err := strconv.ParseInt(text, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(result)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		result, err := strconv.ParseUint(text, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(result)
+	case reflect.Float32, reflect.Float64:
+		result, err := strconv.ParseFloat(text, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(result)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			value.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+		return json.Unmarshal(data, value.Addr().Interface())
+	default:
+		return json.Unmarshal(data, value.Addr().Interface())
+	}
+
+	return nil
+}
+
+// 解析时间，兼容Unix时间戳(秒)
+func unmarshalTime(value reflect.Value, data []byte) error {
+	text := string(data)
+	if timeValue, err := time.Parse(time.RFC3339Nano, text); err == nil {
+		value.Set(reflect.ValueOf(timeValue))
+		return nil
+	}
+
+	seconds, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid time %s", text)
+	}
+	value.Set(reflect.ValueOf(time.Unix(seconds, 0)))
+
+	return nil
+}
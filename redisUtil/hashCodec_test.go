@@ -0,0 +1,130 @@
+package redisUtil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHashBase struct {
+	Id   int64  `redis:"id"`
+	Name string `redis:"name"`
+}
+
+type testHashLevel int
+
+func (this testHashLevel) MarshalRedisField() ([]byte, error) {
+	return []byte(strings.Repeat("*", int(this))), nil
+}
+
+func (this *testHashLevel) UnmarshalRedisField(data []byte) error {
+	*this = testHashLevel(len(data))
+	return nil
+}
+
+type testHashPlayer struct {
+	testHashBase
+	Name     string            `redis:"name"`
+	Online   bool              `redis:"online"`
+	Score    float64           `redis:"score,omitempty"`
+	Login    time.Time         `redis:"login"`
+	Logout   time.Time         `redis:"logout,omitempty"`
+	Nick     *string           `redis:"nick"`
+	Level    testHashLevel     `redis:"level"`
+	Items    []int             `redis:"items"`
+	Props    map[string]string `redis:"props,omitempty"`
+	Ignore   string            `redis:"-"`
+	internal string
+}
+
+func TestHashCodec(t *testing.T) {
+	nick := "nick"
+	player := &testHashPlayer{
+		testHashBase: testHashBase{Id: 1001, Name: "inner"},
+		Name:         "outer",
+		Online:       true,
+		Login:        time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Nick:         &nick,
+		Level:        3,
+		Items:        []int{1, 2},
+		Ignore:       "ignore",
+	}
+
+	args, err := MarshalHash(player)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	fieldMap := make(map[string]string)
+	reply := make([]interface{}, 0, len(args))
+	for index := 0; index < len(args); index += 2 {
+		fieldMap[args[index].(string)] = string(args[index+1].([]byte))
+		reply = append(reply, []byte(args[index].(string)), args[index+1])
+	}
+
+	expectMap := map[string]string{
+		"id":     "1001",
+		"name":   "outer",
+		"online": "1",
+		"login":  "2020-01-02T03:04:05.000000006Z",
+		"nick":   "nick",
+		"level":  "***",
+		"items":  "[1,2]",
+	}
+	if !reflect.DeepEqual(fieldMap, expectMap) {
+		t.Fatalf("expected %v, but got %v", expectMap, fieldMap)
+	}
+
+	result := &testHashPlayer{}
+	if err = UnmarshalHash(reply, result); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	player.testHashBase.Name = ""
+	player.Ignore = ""
+	if !reflect.DeepEqual(result, player) {
+		t.Errorf("expected %+v, but got %+v", player, result)
+	}
+
+	if err = UnmarshalHash(reply, *result); err == nil {
+		t.Errorf("unmarshal to non-pointer should be error")
+	}
+}
+
+func TestHashCodecNil(t *testing.T) {
+	var nilPtr *int
+	value := 5
+	valuePtr := &value
+	data := struct {
+		A      string      `redis:"a"`
+		B      interface{} `redis:"b"`
+		C      interface{} `redis:"c"`
+		D      **int       `redis:"d"`
+		E      interface{} `redis:"e"`
+		Nested **int       `redis:"nested"`
+	}{
+		A:      "a",
+		C:      nilPtr,
+		D:      &nilPtr,
+		E:      3,
+		Nested: &valuePtr,
+	}
+
+	args, err := MarshalHash(data)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	fieldMap := make(map[string]string)
+	for index := 0; index < len(args); index += 2 {
+		fieldMap[args[index].(string)] = string(args[index+1].([]byte))
+	}
+	expectMap := map[string]string{
+		"a":      "a",
+		"e":      "3",
+		"nested": "5",
+	}
+	if !reflect.DeepEqual(fieldMap, expectMap) {
+		t.Fatalf("expected %v, but got %v", expectMap, fieldMap)
+	}
+}
@@ -0,0 +1,318 @@
+package redisUtil
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// 有序集合分数(双精度浮点数)能精确表示的最大整数
+	con_MAX_EXACT_SCORE = 1 << 53
+
+	// 原子增加分数：解出原分数，加上增量后与新的时间部分重新组合，超出精确表示范围时返回错误且不修改
+	// 使用%.0f格式化，避免Lua默认的数字格式丢失精度
+	con_LEADERBOARD_INCR_SCRIPT = `
+local factor = tonumber(ARGV[1])
+local timePart = tonumber(ARGV[2])
+local score = 0
+local old = redis.call('ZSCORE', KEYS[1], ARGV[4])
+if old then
+	score = math.floor(tonumber(old) / factor)
+end
+score = score + tonumber(ARGV[3])
+local composite = score * factor + timePart
+if math.abs(composite) >= tonumber(ARGV[5]) then
+	return redis.error_reply('score ' .. string.format('%.0f', score) .. ' is out of range')
+end
+redis.call('ZADD', KEYS[1], string.format('%.0f', composite), ARGV[4])
+return string.format('%.0f', score)`
+)
+
+// 排行榜中的一项
+type LeaderboardItem struct {
+	// 成员
+	Member string
+
+	// 分数
+	Score int64
+
+	// 名次(从1开始)
+	Rank int64
+}
+
+// 排行榜对象，基于有序集合实现，分数相同时先达到该分数的排在前面
+// 实现方式：实际保存的分数 = 分数 * 2^timeBits + 时间部分，时间部分由距离开始时间的秒数计算得到；
+// 因此分数的绝对值不能超过 2^(53-timeBits)，时间部分超过2^timeBits-1秒后不再区分先后
+type Leaderboard struct {
+	redisPool *RedisPool
+
+	// 有序集合的key
+	key string
+
+	// 是否分数越高排名越靠前
+	isDesc bool
+
+	// 开始时间
+	startTime time.Time
+
+	// 时间部分占用的位数，为0表示不按时间区分先后
+	timeBits uint
+
+	// 2^timeBits
+	factor float64
+}
+
+// 创建排行榜对象
+// key:有序集合的key
+// isDesc:是否分数越高排名越靠前
+// startTime:开始时间(如赛季开始时间)，用于计算时间部分
+// timeBits:时间部分占用的位数(0~32)，如25位可以区分约388天内的先后，此时分数的绝对值不能超过2^28；为0表示不按时间区分先后
+// 返回值:
+// 排行榜对象
+// 错误对象
+func (this *RedisPool) NewLeaderboard(key string, isDesc bool, startTime time.Time, timeBits uint) (*Leaderboard, error) {
+	if timeBits > 32 {
+		return nil, fmt.Errorf("timeBits must be in [0, 32], but now is %d", timeBits)
+	}
+
+	return &Leaderboard{
+		redisPool: this,
+		key:       key,
+		isDesc:    isDesc,
+		startTime: startTime,
+		timeBits:  timeBits,
+		factor:    float64(uint64(1) << timeBits),
+	}, nil
+}
+
+// 获取有序集合的key
+// 返回值:
+// 有序集合的key
+func (this *Leaderboard) GetKey() string {
+	return this.key
+}
+
+// 设置成员的分数(以当前时间作为达到该分数的时间)
+// member:成员
+// score:分数
+// 返回值:
+// 错误对象
+func (this *Leaderboard) SetScore(member string, score int64) error {
+	return this.SetScore2(member, score, time.Now())
+}
+
+// 设置成员的分数
+// member:成员
+// score:分数
+// achieveTime:达到该分数的时间
+// 返回值:
+// 错误对象
+func (this *Leaderboard) SetScore2(member string, score int64, achieveTime time.Time) error {
+	composite, err := this.encode(score, achieveTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = this.redisPool.ZAddFloat(this.key, Set_Write, &ZMember{Member: member, Score: composite})
+	return err
+}
+
+// 原子地增加成员的分数(以当前时间作为达到新分数的时间)，成员不存在时视为0
+// member:成员
+// increment:增量(可以为负数)
+// 返回值:
+// 新的分数
+// 错误对象(新的分数超出范围时返回错误，分数不变)
+func (this *Leaderboard) IncrScore(member string, increment int64) (newScore int64, err error) {
+	scriptObj, err := this.redisPool.RegisterScript("redisUtil.leaderboard.incr", 1, con_LEADERBOARD_INCR_SCRIPT)
+	if err != nil {
+		return
+	}
+
+	newScore, err = scriptObj.Run(this.key, this.factor, this.getTimePart(time.Now()), increment, member, int64(con_MAX_EXACT_SCORE)).Int64()
+	return
+}
+
+// 获取成员的分数
+// member:成员
+// 返回值:
+// 分数
+// 是否存在
+// 错误对象
+func (this *Leaderboard) GetScore(member string) (score int64, exists bool, err error) {
+	var composite float64
+	if composite, exists, err = this.redisPool.ZScoreFloat(this.key, member); err != nil || !exists {
+		return
+	}
+
+	score = this.decode(composite)
+	return
+}
+
+// 获取成员的名次
+// member:成员
+// 返回值:
+// 名次(从1开始)
+// 是否存在
+// 错误对象
+func (this *Leaderboard) GetRank(member string) (rank int64, exists bool, err error) {
+	if this.isDesc {
+		rank, exists, err = this.redisPool.ZRevRank(this.key, member)
+	} else {
+		rank, exists, err = this.redisPool.ZRank(this.key, member)
+	}
+	if err != nil || !exists {
+		return
+	}
+
+	rank++
+	return
+}
+
+// 移除成员
+// members:成员列表
+// 返回值:
+// 移除的数量
+// 错误对象
+func (this *Leaderboard) Remove(members ...string) (removeCount int, err error) {
+	if len(members) == 0 {
+		return
+	}
+
+	memberList := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		memberList = append(memberList, member)
+	}
+
+	return this.redisPool.ZRemove(this.key, memberList...)
+}
+
+// 获取成员数量
+// 返回值:
+// 成员数量
+// 错误对象
+func (this *Leaderboard) Count() (count int, err error) {
+	return this.redisPool.ZCard(this.key)
+}
+
+// 分页获取排行榜
+// pageIndex:页码(从1开始)
+// pageSize:每页数量
+// 返回值:
+// 当前页的列表
+// 错误对象
+func (this *Leaderboard) GetPage(pageIndex, pageSize int) (itemList []*LeaderboardItem, err error) {
+	if pageIndex < 1 || pageSize < 1 {
+		err = fmt.Errorf("pageIndex and pageSize must be greater than 0")
+		return
+	}
+
+	start := (pageIndex - 1) * pageSize
+	return this.GetRange(start+1, start+pageSize)
+}
+
+// 获取指定名次区间的列表
+// startRank:开始名次(从1开始)
+// endRank:结束名次(包含)
+// 返回值:
+// 列表
+// 错误对象
+func (this *Leaderboard) GetRange(startRank, endRank int) (itemList []*LeaderboardItem, err error) {
+	if startRank < 1 {
+		startRank = 1
+	}
+	if endRank < startRank {
+		return
+	}
+
+	var memberList []*ZMember
+	if this.isDesc {
+		memberList, err = this.redisPool.ZRevRangeWithScores(this.key, startRank-1, endRank-1)
+	} else {
+		memberList, err = this.redisPool.ZRangeWithScores(this.key, startRank-1, endRank-1)
+	}
+	if err != nil {
+		return
+	}
+
+	itemList = make([]*LeaderboardItem, 0, len(memberList))
+	for index, item := range memberList {
+		itemList = append(itemList, &LeaderboardItem{
+			Member: item.Member,
+			Score:  this.decode(item.Score),
+			Rank:   int64(startRank + index),
+		})
+	}
+
+	return
+}
+
+// 获取成员附近的列表
+// member:成员
+// count:前后各获取的数量
+// 返回值:
+// 列表(包含成员自己)
+// 成员是否存在
+// 错误对象
+func (this *Leaderboard) GetAround(member string, count int) (itemList []*LeaderboardItem, exists bool, err error) {
+	var rank int64
+	if rank, exists, err = this.GetRank(member); err != nil || !exists {
+		return
+	}
+
+	itemList, err = this.GetRange(int(rank)-count, int(rank)+count)
+	return
+}
+
+// 只保留前若干名，移除其余成员
+// keepCount:保留的数量
+// 返回值:
+// 移除的数量
+// 错误对象
+func (this *Leaderboard) Trim(keepCount int) (removeCount int64, err error) {
+	if this.isDesc {
+		// 分数从低到高排列时，保留最后keepCount个
+		return this.redisPool.ZRemRangeByRank(this.key, 0, -keepCount-1)
+	}
+
+	return this.redisPool.ZRemRangeByRank(this.key, keepCount, -1)
+}
+
+// 将分数和时间组合为有序集合中保存的分数
+func (this *Leaderboard) encode(score int64, achieveTime time.Time) (float64, error) {
+	composite := float64(score)*this.factor + this.getTimePart(achieveTime)
+	if math.Abs(composite) >= con_MAX_EXACT_SCORE {
+		return 0, fmt.Errorf("score %d is out of range", score)
+	}
+
+	return composite, nil
+}
+
+// 从有序集合中保存的分数解出实际分数
+func (this *Leaderboard) decode(composite float64) int64 {
+	return int64(math.Floor(composite / this.factor))
+}
+
+// 计算时间部分：越早达到时，排名越靠前
+func (this *Leaderboard) getTimePart(achieveTime time.Time) float64 {
+	if this.timeBits == 0 {
+		return 0
+	}
+
+	maxValue := this.factor - 1
+	seconds := math.Floor(achieveTime.Sub(this.startTime).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds > maxValue {
+		seconds = maxValue
+	}
+
+	// 分数越高越靠前时，越早的时间部分越大
+	if this.isDesc {
+		return maxValue - seconds
+	}
+
+	return seconds
+}
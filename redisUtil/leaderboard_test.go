@@ -0,0 +1,37 @@
+package redisUtil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderboardEncode(t *testing.T) {
+	startTime := time.Now().Add(-time.Hour)
+	for _, isDesc := range []bool{true, false} {
+		leaderboardObj, err := (&RedisPool{}).NewLeaderboard("lb", isDesc, startTime, 25)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		for _, score := range []int64{0, 1, -1, 100, -100, 1<<28 - 1, -(1<<28 - 1)} {
+			composite, err := leaderboardObj.encode(score, time.Now())
+			if err != nil {
+				t.Fatalf("encode %d err: %v", score, err)
+			}
+			if decodeScore := leaderboardObj.decode(composite); decodeScore != score {
+				t.Errorf("decode expected %d, but got %d", score, decodeScore)
+			}
+		}
+
+		// 分数相同时先达到的排在前面
+		early, _ := leaderboardObj.encode(100, startTime.Add(time.Second))
+		late, _ := leaderboardObj.encode(100, startTime.Add(time.Minute))
+		if isDesc != (early > late) {
+			t.Errorf("tie break by time failed, isDesc:%v early:%f late:%f", isDesc, early, late)
+		}
+
+		if _, err = leaderboardObj.encode(1<<28, time.Now()); err == nil {
+			t.Errorf("score out of range should be error")
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package redisUtil
+
+import (
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// 事务被放弃(WATCH的key在EXEC之前被修改)
+	ErrTransactionAborted = errors.New("redis transaction aborted")
+)
+
+// 管道中的命令
+type pipelineCommand struct {
+	commandName string
+	args        []interface{}
+	reply       *Reply
+}
+
+// 管道对象，将多个命令缓存后通过一次网络往返发送到Redis
+// 通过RedisPool.NewPipeline、NewTransaction、Watch创建，非线程安全
+// 集群模式下同一管道内的key需要位于同一个节点(可以使用{hashtag})
+type Pipeline struct {
+	redisPool *RedisPool
+
+	// 是否以MULTI/EXEC事务执行
+	isTransaction bool
+
+	// Watch中绑定的连接(已经执行过WATCH)
+	conn redis.Conn
+
+	// 待执行的命令列表
+	commandList []*pipelineCommand
+}
+
+// 创建管道对象，命令按顺序一次性发送，各命令独立执行
+// 返回值:
+// 管道对象
+func (this *RedisPool) NewPipeline() *Pipeline {
+	return &Pipeline{
+		redisPool: this,
+	}
+}
+
+// 创建事务对象，命令包装在MULTI/EXEC中一次性发送
+// 需要先读取再根据读取结果修改(乐观锁)时，请使用Watch
+// 返回值:
+// 事务对象
+func (this *RedisPool) NewTransaction() *Pipeline {
+	return &Pipeline{
+		redisPool:     this,
+		isTransaction: true,
+	}
+}
+
+// 以乐观锁的方式执行事务：先WATCH指定的key，然后调用fn，最后以MULTI/EXEC提交fn中加入的命令
+// fn中可以通过tx.Query读取数据，通过tx的其它方法加入事务命令；fn返回错误时不会提交事务
+// fn:事务方法
+// keys:需要WATCH的key列表
+// 返回值:
+// 错误对象(被监视的key被修改时返回ErrTransactionAborted，调用方可以重试)
+func (this *RedisPool) Watch(fn func(tx *Pipeline) error, keys ...string) error {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	// 使用Send使集群模式下的连接绑定到key所在的节点
+	if err := conn.Send("WATCH", args...); err != nil {
+		return err
+	}
+	if _, err := conn.Do(""); err != nil {
+		return err
+	}
+
+	tx := &Pipeline{
+		redisPool:     this,
+		isTransaction: true,
+		conn:          conn,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Exec()
+}
+
+// 获取待执行的命令数量
+// 返回值:
+// 命令数量
+func (this *Pipeline) Len() int {
+	return len(this.commandList)
+}
+
+// 立即执行命令并返回结果(不加入管道)
+// 在Watch中使用同一个连接执行，用于读取被监视的key
+// commandName:命令名称
+// args:命令参数
+// 返回值:
+// 命令回复
+func (this *Pipeline) Query(commandName string, args ...interface{}) *Reply {
+	conn := this.conn
+	if conn == nil {
+		conn = this.redisPool.GetConnection()
+		defer conn.Close()
+	}
+
+	return newReply(conn.Do(commandName, args...))
+}
+
+// 将命令加入管道
+// commandName:命令名称
+// args:命令参数
+// 返回值:
+// 命令回复(Exec之后才有值)
+func (this *Pipeline) Do(commandName string, args ...interface{}) *Reply {
+	reply := &Reply{}
+	this.commandList = append(this.commandList, &pipelineCommand{
+		commandName: commandName,
+		args:        args,
+		reply:       reply,
+	})
+
+	return reply
+}
+
+// 执行管道中的所有命令，执行后管道被清空，可以继续使用
+// 返回值:
+// 错误对象(网络错误或事务被放弃；单个命令的错误通过对应Reply的Err获取)
+func (this *Pipeline) Exec() (err error) {
+	commandList := this.commandList
+	this.commandList = nil
+	if len(commandList) == 0 {
+		return
+	}
+
+	conn := this.conn
+	if conn == nil {
+		conn = this.redisPool.GetConnection()
+		defer conn.Close()
+	}
+
+	if err = this.send(conn, commandList); err != nil {
+		setReplyError(commandList, err)
+		return
+	}
+
+	if this.isTransaction {
+		err = this.receiveTransaction(conn, commandList)
+	} else {
+		err = this.receive(conn, commandList)
+	}
+
+	return
+}
+
+// 发送所有命令
+func (this *Pipeline) send(conn redis.Conn, commandList []*pipelineCommand) (err error) {
+	if this.isTransaction {
+		if err = conn.Send("MULTI"); err != nil {
+			return
+		}
+	}
+
+	for _, item := range commandList {
+		if err = conn.Send(item.commandName, item.args...); err != nil {
+			return
+		}
+	}
+
+	if this.isTransaction {
+		if err = conn.Send("EXEC"); err != nil {
+			return
+		}
+	}
+
+	err = conn.Flush()
+	return
+}
+
+// 接收普通管道的回复
+func (this *Pipeline) receive(conn redis.Conn, commandList []*pipelineCommand) (err error) {
+	for index, item := range commandList {
+		item.reply.reply, item.reply.err = conn.Receive()
+		if item.reply.err == nil {
+			continue
+		}
+
+		// Redis返回的错误只影响当前命令，网络错误则影响后续所有命令
+		if _, ok := item.reply.err.(redis.Error); !ok {
+			err = item.reply.err
+			setReplyError(commandList[index+1:], err)
+			return
+		}
+	}
+
+	return
+}
+
+// 接收事务的回复：MULTI回复OK，各命令回复QUEUED，最后EXEC回复结果数组
+func (this *Pipeline) receiveTransaction(conn redis.Conn, commandList []*pipelineCommand) (err error) {
+	// 事务中的命令只有在EXEC之后才有结果，出错时所有命令都使用该错误
+	defer func() {
+		if err != nil {
+			setReplyError(commandList, err)
+		}
+	}()
+
+	if _, err = conn.Receive(); err != nil {
+		return
+	}
+
+	// 入队失败(如参数错误)的命令会导致整个事务被放弃
+	for _, item := range commandList {
+		var queueErr error
+		if _, queueErr = conn.Receive(); queueErr == nil {
+			continue
+		}
+		if _, ok := queueErr.(redis.Error); !ok {
+			err = queueErr
+			return
+		}
+
+		item.reply.err = queueErr
+	}
+
+	var valueList []interface{}
+	valueList, err = redis.Values(conn.Receive())
+	if err != nil {
+		if err == redis.ErrNil {
+			err = ErrTransactionAborted
+		}
+
+		return
+	}
+
+	for index, item := range commandList {
+		if index >= len(valueList) {
+			break
+		}
+
+		if redisErr, ok := valueList[index].(redis.Error); ok {
+			item.reply.err = redisErr
+		} else {
+			item.reply.reply = valueList[index]
+		}
+	}
+
+	return
+}
+
+// 获取指定key的内容(使用Reply.String或Reply.Bytes获取结果)
+// key:key
+// 返回值:
+// 命令回复
+func (this *Pipeline) Get(key string) *Reply {
+	return this.Do("GET", key)
+}
+
+// 设置key和对应的value
+// key:key
+// value:value
+// 返回值:
+// 命令回复
+func (this *Pipeline) Set(key string, value interface{}) *Reply {
+	return this.Do("SET", key, value)
+}
+
+// 设置key和对应的value以及超时时间
+// key:key
+// value:value
+// expireType:设置的超时类型
+// expireVal:超时时间值
+// 返回值:
+// 命令回复
+func (this *Pipeline) Set2(key string, value interface{}, expireType ExpireType, expireVal int) *Reply {
+	if expireType != Expire_Millisecond && expireType != Expire_Seond {
+		return newReply(nil, errors.New("ExpireTypeError"))
+	}
+
+	return this.Do("SET", key, value, string(expireType), expireVal)
+}
+
+// 删除指定的key列表(使用Reply.Int获取删除的数量)
+// keys:指定的key列表
+// 返回值:
+// 命令回复
+func (this *Pipeline) Del(keys ...string) *Reply {
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	return this.Do("DEL", args...)
+}
+
+// 设置指定key的过期时间
+// key:key
+// seconds:过期的秒数
+// 返回值:
+// 命令回复
+func (this *Pipeline) Expire(key string, seconds int) *Reply {
+	return this.Do("EXPIRE", key, seconds)
+}
+
+// 让指定key递增指定值(使用Reply.Int64获取增加之后的值)
+// key:key
+// increment:增加值
+// 返回值:
+// 命令回复
+func (this *Pipeline) IncrBy(key string, increment int64) *Reply {
+	return this.Do("INCRBY", key, increment)
+}
+
+// 获取指定key的Hash表的field值
+// key:key
+// field:field
+// 返回值:
+// 命令回复
+func (this *Pipeline) HGet(key, field string) *Reply {
+	return this.Do("HGET", key, field)
+}
+
+// 设置指定key的Hash表的field的值
+// key:key
+// field:field
+// value:value
+// 返回值:
+// 命令回复
+func (this *Pipeline) HSet(key, field string, value interface{}) *Reply {
+	return this.Do("HSET", key, field, value)
+}
+
+// 给hash字段的值增加指定数量(使用Reply.Int64获取新的值)
+// key:key
+// field:field
+// addVal:增加的值
+// 返回值:
+// 命令回复
+func (this *Pipeline) HIncrBy(key, field string, addVal int64) *Reply {
+	return this.Do("HINCRBY", key, field, addVal)
+}
+
+// 删除hash的字段
+// key:key
+// fields:字段列表
+// 返回值:
+// 命令回复
+func (this *Pipeline) HDel(key string, fields ...string) *Reply {
+	args := make([]interface{}, 0, len(fields)+1)
+	args = append(args, key)
+	for _, field := range fields {
+		args = append(args, field)
+	}
+
+	return this.Do("HDEL", args...)
+}
+
+// 获取指定key的Hash表的所有field的值(使用Reply.StringMap或Reply.ScanStruct获取结果)
+// key:key
+// 返回值:
+// 命令回复
+func (this *Pipeline) HGetAll(key string) *Reply {
+	return this.Do("HGETALL", key)
+}
+
+// 将对象value的值赋值给key对应的Hash表
+// key:key
+// value:结构体对象(字段对应规则见MarshalHash)或map
+// 返回值:
+// 命令回复(对象转换失败时直接返回带有错误的回复，不加入管道)
+func (this *Pipeline) HMSet(key string, value interface{}) *Reply {
+	args, err := getHashArgs(key, value)
+	if err != nil {
+		return newReply(nil, err)
+	}
+
+	return this.Do("HMSET", args...)
+}
+
+// 从左侧向key对应的List中追加数据
+// key:key
+// values:不定数量的值
+// 返回值:
+// 命令回复
+func (this *Pipeline) LPush(key string, values ...string) *Reply {
+	return this.Do("LPUSH", stringArgs(key, values)...)
+}
+
+// 从右侧向key对应的List中追加数据
+// key:key
+// values:不定数量的值
+// 返回值:
+// 命令回复
+func (this *Pipeline) RPush(key string, values ...string) *Reply {
+	return this.Do("RPUSH", stringArgs(key, values)...)
+}
+
+// 往set中添加value
+// key:set的key
+// values:待添加的值
+// 返回值:
+// 命令回复
+func (this *Pipeline) SAdd(key string, values ...string) *Reply {
+	return this.Do("SADD", stringArgs(key, values)...)
+}
+
+// 从set移除指定的value
+// key:set的key
+// values:需要移除的value集合
+// 返回值:
+// 命令回复
+func (this *Pipeline) SRem(key string, values ...string) *Reply {
+	return this.Do("SREM", stringArgs(key, values)...)
+}
+
+// 添加一项到有序集合中
+// key:set的key
+// setType:值存储类型
+// score:分数
+// val:值
+// 返回值:
+// 命令回复
+func (this *Pipeline) ZAdd2(key string, setType SetType, score int64, val interface{}) *Reply {
+	if setType != Set_Write {
+		return this.Do("ZADD", key, string(setType), score, val)
+	}
+
+	return this.Do("ZADD", key, score, val)
+}
+
+// 从有序集合中移除指定的项
+// key:set的key
+// memberList:需要移除的项
+// 返回值:
+// 命令回复
+func (this *Pipeline) ZRemove(key string, memberList ...interface{}) *Reply {
+	args := make([]interface{}, 0, len(memberList)+1)
+	args = append(args, key)
+	args = append(args, memberList...)
+
+	return this.Do("ZREM", args...)
+}
+
+// 发布一条消息
+// channelName:频道名
+// value:发送到此频道的数据
+// 返回值:
+// 命令回复
+func (this *Pipeline) Publish(channelName string, value []byte) *Reply {
+	return this.Do("PUBLISH", channelName, value)
+}
+
+// 设置命令的错误(已经有错误的命令保留原来的错误)
+func setReplyError(commandList []*pipelineCommand, err error) {
+	for _, item := range commandList {
+		if item.reply.err == nil {
+			item.reply.err = err
+		}
+	}
+}
+
+// 将key和字符串列表组装为命令参数
+func stringArgs(key string, values []string) []interface{} {
+	args := make([]interface{}, 0, len(values)+1)
+	args = append(args, key)
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return args
+}
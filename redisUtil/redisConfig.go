@@ -29,10 +29,32 @@ type RedisConfig struct {
 
 	// 连接超时
 	DialConnectTimeout time.Duration
+
+	// 部署模式(默认为单机模式)
+	Mode RedisMode
+
+	// 哨兵模式下的主节点名称
+	MasterName string
+}
+
+// 获取连接地址列表(哨兵和集群模式下ConnectionString以逗号分隔多个地址)
+// 返回值:
+// 连接地址列表
+func (this *RedisConfig) GetAddressList() []string {
+	addressList := make([]string, 0, 4)
+	for _, item := range strings.Split(this.ConnectionString, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			addressList = append(addressList, item)
+		}
+	}
+
+	return addressList
 }
 
 // 将redis连接字符串转化为redis config对象
 // 格式：ConnectionString=10.1.0.21:6379;Password=redis_pwd;Database=3;MaxActive=50;MaxIdle=20;IdleTimeout=300;DialConnectTimeout=10;
+// 哨兵模式和集群模式可追加可选部分：Mode=Sentinel;MasterName=mymaster; 或 Mode=Cluster;
 // redisConfigStr：redis连接字符串
 // 返回值：
 // redis config对象
@@ -45,6 +67,8 @@ func NewRedisConfig(redisConfigStr string) (redisConfig *RedisConfig, err error)
 	var maxIdle int
 	var idleTimeout time.Duration
 	var dialConectTimeout time.Duration
+	var mode RedisMode
+	var masterName string
 	var count int = 7
 	var subCount int = 2
 
@@ -53,8 +77,8 @@ func NewRedisConfig(redisConfigStr string) (redisConfig *RedisConfig, err error)
 	if itemList[len(itemList)-1] == "" {
 		itemList = itemList[0 : len(itemList)-1]
 	}
-	if len(itemList) != count {
-		err = fmt.Errorf("%s格式不正确，需要包含%d个部分，现在有%d个部分", redisConfigStr, count, len(itemList))
+	if len(itemList) < count {
+		err = fmt.Errorf("%s格式不正确，至少需要包含%d个部分，现在有%d个部分", redisConfigStr, count, len(itemList))
 		return
 	}
 
@@ -100,10 +124,31 @@ func NewRedisConfig(redisConfigStr string) (redisConfig *RedisConfig, err error)
 			} else {
 				dialConectTimeout = time.Duration(dialConectTimeout_int) * time.Second
 			}
+		case strings.ToLower("Mode"):
+			switch strings.ToLower(subItemList[1]) {
+			case "", "standalone":
+				mode = Mode_Standalone
+			case strings.ToLower(string(Mode_Sentinel)):
+				mode = Mode_Sentinel
+			case strings.ToLower(string(Mode_Cluster)):
+				mode = Mode_Cluster
+			default:
+				err = fmt.Errorf("%s不是有效的部署模式", subItemList[1])
+				return
+			}
+		case strings.ToLower("MasterName"):
+			masterName = subItemList[1]
 		}
 	}
 
+	if mode == Mode_Sentinel && masterName == "" {
+		err = fmt.Errorf("%s格式不正确，哨兵模式需要指定MasterName", redisConfigStr)
+		return
+	}
+
 	redisConfig = NewRedisConfig2(connectionString, password, database, maxActive, maxIdle, idleTimeout, dialConectTimeout)
+	redisConfig.Mode = mode
+	redisConfig.MasterName = masterName
 	return
 }
 
@@ -4,12 +4,18 @@ redisUtil对Redis的连接池进行了一定程度的封装
 1、向作者提出请求，由作者添加到代码中
 2、调用GetConnection方法，然后自己实现逻辑
 在代码中，统一将conn.Do的结果和redis.Int,redis.String等类型转换合并处理
+
+通过RedisConfig.Mode支持三种部署模式：
+1、单机模式：直接连接ConnectionString指定的地址
+2、哨兵模式：通过哨兵获取主节点地址，主节点切换后会自动连接到新的主节点
+3、集群模式：根据key计算槽并路由到对应节点，自动跟随MOVED/ASK重定向，包含多个key的命令(如Del)要求所有key位于同一个槽(可以使用{hashtag})
 */
 package redisUtil
 
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -19,7 +25,23 @@ import (
 type RedisPool struct {
 	name    string
 	address string
-	pool    *redis.Pool
+	config  *RedisConfig
+
+	// 单机和哨兵模式下使用的连接池
+	pool *redis.Pool
+
+	// 哨兵模式下的哨兵对象
+	sentinel *sentinel
+
+	// 集群模式下的集群对象
+	cluster *cluster
+
+	// 已注册的Lua脚本
+	scriptMap   map[string]*Script
+	scriptMutex sync.RWMutex
+
+	// 统计对象
+	stats *poolStats
 }
 
 // 获取自定义Redis连接池对象的名称
@@ -30,17 +52,43 @@ func (this *RedisPool) GetName() string {
 }
 
 // 获取自定义Redis连接池对象的目标地址
+// 哨兵模式下为当前主节点地址，集群模式下为种子节点地址列表
 // 返回值:
 // 自定义Redis连接池对象的目标地址
 func (this *RedisPool) GetAddress() string {
+	if this.sentinel != nil {
+		if masterAddress := this.sentinel.getMasterAddress(); masterAddress != "" {
+			return masterAddress
+		}
+	}
+
 	return this.address
 }
 
+// 获取部署模式
+// 返回值:
+// 部署模式
+func (this *RedisPool) GetMode() RedisMode {
+	return this.config.Mode
+}
+
 // 从自定义连接池中获取连接，在使用后需要调用Close方法
 // 返回值:
 // 连接对象
 func (this *RedisPool) GetConnection() redis.Conn {
-	return this.pool.Get()
+	if this.cluster != nil {
+		return &statsConn{Conn: &clusterConn{cluster: this.cluster}, stats: this.stats}
+	}
+
+	return &statsConn{Conn: getPoolConn(this.pool, this.stats), stats: this.stats}
+}
+
+// 获取集群中指定节点的连接(只用于集群模式下需要访问所有节点的命令)
+// address:节点地址
+// 返回值:
+// 连接对象
+func (this *RedisPool) getNodeConnection(address string) redis.Conn {
+	return &statsConn{Conn: getPoolConn(this.cluster.getPool(address), this.stats), stats: this.stats}
 }
 
 // 测试连接情况
@@ -57,6 +105,11 @@ func (this *RedisPool) TestConnection() error {
 
 // 关闭自定义连接池
 func (this *RedisPool) Close() {
+	if this.cluster != nil {
+		this.cluster.close()
+		return
+	}
+
 	this.pool.Close()
 }
 
@@ -79,12 +132,34 @@ func (this *RedisPool) Exists(key string) (exists bool, err error) {
 	return
 }
 
-// 根据指定的模式获取匹配的key列表
+// 根据指定的模式获取匹配的key列表(obsolete，KEYS命令会阻塞Redis，建议使用Scan)
+// 集群模式下会在所有主节点上执行并合并结果
 // pattern:模式字符串
 // 返回值:
 // key列表
 // 错误对象
 func (this *RedisPool) Keys(pattern string) (keyList []string, err error) {
+	if this.cluster != nil {
+		var addressList []string
+		if addressList, err = this.cluster.getNodeAddressList(); err != nil {
+			return
+		}
+
+		keyList = make([]string, 0)
+		for _, address := range addressList {
+			conn := this.getNodeConnection(address)
+			nodeKeyList, nodeErr := redis.Strings(conn.Do("KEYS", pattern))
+			conn.Close()
+			if nodeErr != nil {
+				return nil, nodeErr
+			}
+
+			keyList = append(keyList, nodeKeyList...)
+		}
+
+		return
+	}
+
 	conn := this.GetConnection()
 	defer conn.Close()
 
@@ -102,7 +177,7 @@ func (this *RedisPool) Del(keys ...string) (count int, err error) {
 	conn := this.GetConnection()
 	defer conn.Close()
 
-	args := make([]interface{}, len(keys))
+	args := make([]interface{}, 0, len(keys))
 	for _, key := range keys {
 		args = append(args, key)
 	}
@@ -344,6 +419,7 @@ func (this *RedisPool) HIncrBy(key, field string, addNum int) error {
 }
 
 // 获取指定key的Hash表的所有field的值，并将其赋值给value对象
+// 字段对应规则见MarshalHash
 // key:key
 // value:对象
 // 返回值:
@@ -362,7 +438,7 @@ func (this *RedisPool) HGetAll(key string, value interface{}) (exists bool, err
 		return
 	}
 
-	if err = redis.ScanStruct(reply, value); err != nil {
+	if err = UnmarshalHash(reply, value); err != nil {
 		return
 	}
 
@@ -436,14 +512,22 @@ func (this *RedisPool) HLen(key string) (result int, err error) {
 
 // 将对象value的值赋值给key对应的Hast表
 // key:key
-// value:对象
+// value:结构体对象(字段对应规则见MarshalHash)或map
 // 返回值:
 // 错误对象
 func (this *RedisPool) HMSet(key string, value interface{}) error {
+	args, err := getHashArgs(key, value)
+	if err != nil {
+		return err
+	}
+	if len(args) <= 1 {
+		return nil
+	}
+
 	conn := this.GetConnection()
 	defer conn.Close()
 
-	_, err := conn.Do("HMSET", redis.Args{}.Add().AddFlat(value)...)
+	_, err = conn.Do("HMSET", args...)
 
 	return err
 }
@@ -494,6 +578,52 @@ func (this *RedisPool) HMGet(key string, field ...string) (result map[string]str
 	return
 }
 
+// 获取结构体对象对应的字段的值，并将其赋值给value对象
+// 字段对应规则见MarshalHash，Redis中不存在的字段保持原值
+// key:key
+// value:结构体对象的指针
+// 返回值:
+// 是否存在任意一个字段
+// 错误对象
+func (this *RedisPool) HMGet2(key string, value interface{}) (exists bool, err error) {
+	var fieldList []string
+	if fieldList, err = getHashFieldNames(value); err != nil {
+		return
+	}
+	if len(fieldList) == 0 {
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	var valueList []interface{}
+	valueList, err = redis.Values(conn.Do("HMGET", stringArgs(key, fieldList)...))
+	if err != nil {
+		return
+	}
+
+	reply := make([]interface{}, 0, len(valueList)*2)
+	for index, item := range valueList {
+		if item == nil || index >= len(fieldList) {
+			continue
+		}
+
+		reply = append(reply, fieldList[index], item)
+	}
+	if len(reply) == 0 {
+		return
+	}
+
+	if err = UnmarshalHash(reply, value); err != nil {
+		return
+	}
+
+	exists = true
+
+	return
+}
+
 // 在 key 指定的哈希集中不存在指定的字段时，设置字段的值
 // key:key
 // value:对象
@@ -1017,37 +1147,99 @@ func NewRedisPool(_name, connectionString, password string, database, maxActive,
 
 // 创建新的Redis连接池对象
 // _name:连接池对象名称
-// redisConfig:Redis配置对象
+// redisConfig:Redis配置对象，通过Mode指定单机、哨兵或集群模式
 // 返回值：
 // Redis连接池对象
 func NewRedisPool2(_name string, redisConfig *RedisConfig) *RedisPool {
-	_pool := &redis.Pool{
-		MaxActive:   redisConfig.MaxActive,
-		MaxIdle:     redisConfig.MaxIdle,
-		IdleTimeout: redisConfig.IdleTimeout,
-		Dial: func() (redis.Conn, error) {
-			options := make([]redis.DialOption, 0, 4)
-			options = append(options, redis.DialConnectTimeout(redisConfig.DialConnectTimeout))
-			if redisConfig.Password != "" {
-				options = append(options, redis.DialPassword(redisConfig.Password))
-			}
-			options = append(options, redis.DialDatabase(redisConfig.Database))
-			c, err := redis.Dial("tcp", redisConfig.ConnectionString, options...)
-			if err != nil {
-				return nil, fmt.Errorf("Dial failed, err:%s", err)
-			}
+	redisPoolObj := &RedisPool{
+		name:      _name,
+		address:   redisConfig.ConnectionString,
+		config:    redisConfig,
+		scriptMap: make(map[string]*Script),
+		stats:     newPoolStats(_name),
+	}
+
+	switch redisConfig.Mode {
+	case Mode_Sentinel:
+		redisPoolObj.sentinel = newSentinel(redisConfig)
+		redisPoolObj.pool = newPool(redisConfig, redisPoolObj.sentinel.dial, func(c redis.Conn, t time.Time) error {
+			// 发生故障转移后，原主节点的连接会在此处被丢弃
+			return checkRole(c, "master")
+		})
+	case Mode_Cluster:
+		redisPoolObj.cluster = newCluster(redisConfig, redisPoolObj.stats)
+	default:
+		redisPoolObj.pool = newPool(redisConfig, func() (redis.Conn, error) {
+			return dial(redisConfig.ConnectionString, redisConfig, true)
+		}, ping)
+	}
+
+	return redisPoolObj
+}
 
-			return c, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
+// 创建一个不属于连接池的新连接(用于订阅等需要长期占用的场景)
+// 返回值:
+// 连接对象
+// 错误对象
+func (this *RedisPool) dialConnection() (redis.Conn, error) {
+	if this.sentinel != nil {
+		return this.sentinel.dial()
 	}
 
-	return &RedisPool{
-		name:    _name,
-		address: redisConfig.ConnectionString,
-		pool:    _pool,
+	if this.cluster != nil {
+		address, err := this.cluster.getAnyAddress()
+		if err != nil {
+			return nil, err
+		}
+
+		return dial(address, this.config, false)
 	}
+
+	return dial(this.config.ConnectionString, this.config, true)
+}
+
+// 创建redigo连接池
+// redisConfig:Redis配置对象
+// dialFunc:创建连接的方法
+// testOnBorrowFunc:借出连接时的检查方法
+// 返回值：
+// 连接池对象
+func newPool(redisConfig *RedisConfig, dialFunc func() (redis.Conn, error), testOnBorrowFunc func(redis.Conn, time.Time) error) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:    redisConfig.MaxActive,
+		MaxIdle:      redisConfig.MaxIdle,
+		IdleTimeout:  redisConfig.IdleTimeout,
+		Dial:         dialFunc,
+		TestOnBorrow: testOnBorrowFunc,
+	}
+}
+
+// 连接到指定的Redis节点
+// address:节点地址
+// redisConfig:Redis配置对象
+// isSelectDatabase:是否选择配置的数据库(集群模式只支持0号数据库)
+// 返回值：
+// 连接对象
+// 错误对象
+func dial(address string, redisConfig *RedisConfig, isSelectDatabase bool) (redis.Conn, error) {
+	options := make([]redis.DialOption, 0, 4)
+	options = append(options, redis.DialConnectTimeout(redisConfig.DialConnectTimeout))
+	if redisConfig.Password != "" {
+		options = append(options, redis.DialPassword(redisConfig.Password))
+	}
+	if isSelectDatabase {
+		options = append(options, redis.DialDatabase(redisConfig.Database))
+	}
+	c, err := redis.Dial("tcp", address, options...)
+	if err != nil {
+		return nil, fmt.Errorf("Dial failed, err:%s", err)
+	}
+
+	return c, err
+}
+
+// 检查连接是否可用
+func ping(c redis.Conn, t time.Time) error {
+	_, err := c.Do("PING")
+	return err
 }
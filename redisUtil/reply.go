@@ -0,0 +1,133 @@
+package redisUtil
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// 命令回复对象
+// 管道中的命令在执行(Exec)之后才会有值，通过与RedisPool相同的类型转换方法获取结果
+type Reply struct {
+	reply interface{}
+	err   error
+}
+
+// 获取命令的错误
+// 返回值:
+// 错误对象
+func (this *Reply) Err() error {
+	return this.err
+}
+
+// 获取原始回复
+// 返回值:
+// 原始回复
+// 错误对象
+func (this *Reply) Value() (interface{}, error) {
+	return this.reply, this.err
+}
+
+// 获取string类型的结果
+// 返回值:
+// 内容
+// 是否存在
+// 错误对象
+func (this *Reply) String() (value string, exists bool, err error) {
+	value, err = redis.String(this.reply, this.err)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return
+	}
+
+	exists = true
+
+	return
+}
+
+// 获取[]byte类型的结果
+// 返回值:
+// 内容
+// 是否存在
+// 错误对象
+func (this *Reply) Bytes() (value []byte, exists bool, err error) {
+	value, err = redis.Bytes(this.reply, this.err)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return
+	}
+
+	exists = true
+
+	return
+}
+
+// 获取int类型的结果
+func (this *Reply) Int() (int, error) {
+	return redis.Int(this.reply, this.err)
+}
+
+// 获取int64类型的结果
+func (this *Reply) Int64() (int64, error) {
+	return redis.Int64(this.reply, this.err)
+}
+
+// 获取float64类型的结果
+func (this *Reply) Float64() (float64, error) {
+	return redis.Float64(this.reply, this.err)
+}
+
+// 获取bool类型的结果
+func (this *Reply) Bool() (bool, error) {
+	return redis.Bool(this.reply, this.err)
+}
+
+// 获取[]string类型的结果
+func (this *Reply) Strings() ([]string, error) {
+	return redis.Strings(this.reply, this.err)
+}
+
+// 获取map[string]string类型的结果(用于HGETALL等)
+func (this *Reply) StringMap() (map[string]string, error) {
+	return redis.StringMap(this.reply, this.err)
+}
+
+// 获取[]interface{}类型的结果
+func (this *Reply) Values() ([]interface{}, error) {
+	return redis.Values(this.reply, this.err)
+}
+
+// 将HGETALL的结果赋值给value对象(字段对应规则见MarshalHash)
+// value:对象
+// 返回值:
+// 是否存在
+// 错误对象
+func (this *Reply) ScanStruct(value interface{}) (exists bool, err error) {
+	var reply []interface{}
+	if reply, err = redis.Values(this.reply, this.err); err != nil {
+		return
+	}
+	if len(reply) == 0 {
+		return
+	}
+
+	if err = UnmarshalHash(reply, value); err != nil {
+		return
+	}
+
+	exists = true
+
+	return
+}
+
+// 创建回复对象
+func newReply(reply interface{}, err error) *Reply {
+	return &Reply{
+		reply: reply,
+		err:   err,
+	}
+}
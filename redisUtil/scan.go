@@ -0,0 +1,260 @@
+package redisUtil
+
+import (
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 扫描选项
+type ScanOption struct {
+	// 匹配模式，如：player:*，为空表示不过滤
+	Match string
+
+	// 每次扫描的建议数量，<=0表示使用Redis的默认值(10)
+	Count int
+
+	// key的类型，如：string、hash，为空表示不过滤(只对SCAN有效，需要Redis 6.0及以上)
+	Type string
+}
+
+// 扫描迭代器，按需分批从Redis获取数据，可以随时停止
+// 用法：循环调用Next直到返回false，通过Item/Value获取当前元素，最后通过Err检查错误；中途退出循环即可停止扫描
+// 注意：SCAN系列命令可能返回重复的元素，迭代期间修改的元素可能返回也可能不返回
+type ScanIterator struct {
+	redisPool *RedisPool
+
+	// 命令名称(SCAN/HSCAN/SSCAN/ZSCAN)
+	commandName string
+
+	// 扫描的key(SCAN时为空)
+	key string
+
+	// 扫描选项
+	option ScanOption
+
+	// 结果是否成对出现(HSCAN/ZSCAN)
+	isPair bool
+
+	// 集群模式下SCAN需要依次扫描的主节点地址列表，以及当前扫描的节点序号
+	addressList  []string
+	addressIndex int
+
+	// 当前游标
+	cursor string
+
+	// 当前节点是否已扫描完成
+	isFinished bool
+
+	// 已获取但尚未返回的数据
+	itemList []string
+
+	// 当前的元素和值
+	item  string
+	value string
+
+	// 错误对象
+	err error
+}
+
+// 扫描当前数据库中的key(替代KEYS命令)
+// 集群模式下会依次扫描所有主节点
+// option:扫描选项，可以为nil
+// 返回值:
+// 扫描迭代器
+func (this *RedisPool) Scan(option *ScanOption) *ScanIterator {
+	iteratorObj := newScanIterator(this, "SCAN", "", option, false)
+	if this.cluster != nil {
+		iteratorObj.addressList, iteratorObj.err = this.cluster.getNodeAddressList()
+	}
+
+	return iteratorObj
+}
+
+// 扫描哈希表中的字段，通过Item获取字段名，通过Value获取值
+// key:哈希表的key
+// option:扫描选项(Type无效)，可以为nil
+// 返回值:
+// 扫描迭代器
+func (this *RedisPool) HScan(key string, option *ScanOption) *ScanIterator {
+	return newScanIterator(this, "HSCAN", key, option, true)
+}
+
+// 扫描集合中的元素，通过Item获取元素
+// key:集合的key
+// option:扫描选项(Type无效)，可以为nil
+// 返回值:
+// 扫描迭代器
+func (this *RedisPool) SScan(key string, option *ScanOption) *ScanIterator {
+	return newScanIterator(this, "SSCAN", key, option, false)
+}
+
+// 扫描有序集合中的元素，通过Item获取成员，通过Value或Score获取分数
+// key:有序集合的key
+// option:扫描选项(Type无效)，可以为nil
+// 返回值:
+// 扫描迭代器
+func (this *RedisPool) ZScan(key string, option *ScanOption) *ScanIterator {
+	return newScanIterator(this, "ZSCAN", key, option, true)
+}
+
+// 移动到下一个元素
+// 返回值:
+// 是否还有元素(出错时返回false，通过Err获取错误)
+func (this *ScanIterator) Next() bool {
+	for len(this.itemList) == 0 {
+		if this.err != nil || this.isDone() {
+			return false
+		}
+
+		this.fetch()
+	}
+
+	this.item = this.itemList[0]
+	this.value = ""
+	if this.isPair {
+		this.value = this.itemList[1]
+		this.itemList = this.itemList[2:]
+	} else {
+		this.itemList = this.itemList[1:]
+	}
+
+	return true
+}
+
+// 获取当前元素(key、字段名或成员)
+// 返回值:
+// 当前元素
+func (this *ScanIterator) Item() string {
+	return this.item
+}
+
+// 获取当前元素的值(HSCAN时为字段的值，ZSCAN时为分数，其它为空)
+// 返回值:
+// 当前元素的值
+func (this *ScanIterator) Value() string {
+	return this.value
+}
+
+// 获取当前成员的分数(只对ZSCAN有效)
+// 返回值:
+// 分数
+// 错误对象
+func (this *ScanIterator) Score() (float64, error) {
+	return redis.Float64([]byte(this.value), nil)
+}
+
+// 获取迭代过程中的错误
+// 返回值:
+// 错误对象
+func (this *ScanIterator) Err() error {
+	return this.err
+}
+
+// 依次遍历所有元素
+// fn:遍历方法，参数为元素和值，返回false表示停止遍历
+// 返回值:
+// 错误对象
+func (this *ScanIterator) ForEach(fn func(item, value string) bool) error {
+	for this.Next() {
+		if !fn(this.item, this.value) {
+			break
+		}
+	}
+
+	return this.err
+}
+
+// 获取所有元素(只适用于数据量不大的场景)
+// 返回值:
+// 元素列表
+// 错误对象
+func (this *ScanIterator) All() (itemList []string, err error) {
+	for this.Next() {
+		itemList = append(itemList, this.item)
+	}
+
+	err = this.err
+	return
+}
+
+// 是否已经扫描完所有数据
+func (this *ScanIterator) isDone() bool {
+	if !this.isFinished {
+		return false
+	}
+
+	// 集群模式下继续扫描下一个节点
+	if this.addressIndex+1 < len(this.addressList) {
+		this.addressIndex++
+		this.cursor = "0"
+		this.isFinished = false
+		return false
+	}
+
+	return true
+}
+
+// 获取下一批数据
+func (this *ScanIterator) fetch() {
+	var conn redis.Conn
+	if len(this.addressList) > 0 {
+		conn = this.redisPool.getNodeConnection(this.addressList[this.addressIndex])
+	} else {
+		conn = this.redisPool.GetConnection()
+	}
+	defer conn.Close()
+
+	args := make([]interface{}, 0, 8)
+	if this.key != "" {
+		args = append(args, this.key)
+	}
+	args = append(args, this.cursor)
+	if this.option.Match != "" {
+		args = append(args, "MATCH", this.option.Match)
+	}
+	if this.option.Count > 0 {
+		args = append(args, "COUNT", this.option.Count)
+	}
+	if this.option.Type != "" && this.commandName == "SCAN" {
+		args = append(args, "TYPE", this.option.Type)
+	}
+
+	var reply []interface{}
+	if reply, this.err = redis.Values(conn.Do(this.commandName, args...)); this.err != nil {
+		return
+	}
+	if len(reply) != 2 {
+		this.err = fmt.Errorf("invalid %s reply", this.commandName)
+		return
+	}
+
+	if this.cursor, this.err = redis.String(reply[0], nil); this.err != nil {
+		return
+	}
+	if this.itemList, this.err = redis.Strings(reply[1], nil); this.err != nil {
+		return
+	}
+	if this.isPair && len(this.itemList)%2 != 0 {
+		this.err = fmt.Errorf("invalid %s reply", this.commandName)
+		return
+	}
+
+	this.isFinished = this.cursor == "0"
+}
+
+// 创建扫描迭代器
+func newScanIterator(redisPool *RedisPool, commandName, key string, option *ScanOption, isPair bool) *ScanIterator {
+	iteratorObj := &ScanIterator{
+		redisPool:   redisPool,
+		commandName: commandName,
+		key:         key,
+		isPair:      isPair,
+		cursor:      "0",
+	}
+	if option != nil {
+		iteratorObj.option = *option
+	}
+
+	return iteratorObj
+}
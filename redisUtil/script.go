@@ -0,0 +1,127 @@
+package redisUtil
+
+import (
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Lua脚本对象，通过RedisPool.RegisterScript注册
+// 执行时优先使用EVALSHA，如果Redis中没有该脚本(NOSCRIPT)，则自动使用EVAL重新加载并执行
+type Script struct {
+	redisPool *RedisPool
+	name      string
+	keyCount  int
+	script    *redis.Script
+}
+
+// 注册Lua脚本，每个RedisPool中同一个名称只需要注册一次
+// name:脚本名称
+// keyCount:脚本使用的key数量(执行时前keyCount个参数作为KEYS，其余作为ARGV)
+// src:脚本内容
+// 返回值:
+// 脚本对象
+// 错误对象(同名脚本已经以不同的内容注册过)
+func (this *RedisPool) RegisterScript(name string, keyCount int, src string) (*Script, error) {
+	scriptObj := &Script{
+		redisPool: this,
+		name:      name,
+		keyCount:  keyCount,
+		script:    redis.NewScript(keyCount, src),
+	}
+
+	this.scriptMutex.Lock()
+	defer this.scriptMutex.Unlock()
+
+	if existScript, exists := this.scriptMap[name]; exists {
+		if existScript.Hash() != scriptObj.Hash() {
+			return nil, fmt.Errorf("script %s has been registered with different source", name)
+		}
+
+		return existScript, nil
+	}
+
+	this.scriptMap[name] = scriptObj
+
+	return scriptObj, nil
+}
+
+// 获取已注册的Lua脚本
+// name:脚本名称
+// 返回值:
+// 脚本对象
+// 是否存在
+func (this *RedisPool) GetScript(name string) (scriptObj *Script, exists bool) {
+	this.scriptMutex.RLock()
+	defer this.scriptMutex.RUnlock()
+
+	scriptObj, exists = this.scriptMap[name]
+	return
+}
+
+// 获取脚本名称
+// 返回值:
+// 脚本名称
+func (this *Script) Name() string {
+	return this.name
+}
+
+// 获取脚本的SHA1值
+// 返回值:
+// 脚本的SHA1值
+func (this *Script) Hash() string {
+	return this.script.Hash()
+}
+
+// 通过SCRIPT LOAD预先加载脚本(集群模式下加载到所有主节点)
+// 不调用也可以直接执行，首次执行时会自动加载
+// 返回值:
+// 错误对象
+func (this *Script) Load() error {
+	if this.redisPool.cluster != nil {
+		addressList, err := this.redisPool.cluster.getNodeAddressList()
+		if err != nil {
+			return err
+		}
+
+		for _, address := range addressList {
+			conn := this.redisPool.getNodeConnection(address)
+			err = this.script.Load(conn)
+			conn.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	conn := this.redisPool.GetConnection()
+	defer conn.Close()
+
+	return this.script.Load(conn)
+}
+
+// 执行脚本
+// keysAndArgs:脚本的KEYS和ARGV
+// 返回值:
+// 命令回复(通过Reply.String、Reply.Int、Reply.StringMap等获取结果)
+func (this *Script) Run(keysAndArgs ...interface{}) *Reply {
+	conn := this.redisPool.GetConnection()
+	defer conn.Close()
+
+	return newReply(this.script.Do(conn, keysAndArgs...))
+}
+
+// 将脚本以EVALSHA的方式加入管道(需要保证脚本已经加载，可先调用Load)
+// pipeline:管道对象
+// keysAndArgs:脚本的KEYS和ARGV
+// 返回值:
+// 命令回复
+func (this *Script) RunInPipeline(pipeline *Pipeline, keysAndArgs ...interface{}) *Reply {
+	args := make([]interface{}, 0, len(keysAndArgs)+2)
+	args = append(args, this.Hash(), this.keyCount)
+	args = append(args, keysAndArgs...)
+
+	return pipeline.Do("EVALSHA", args...)
+}
@@ -0,0 +1,159 @@
+package redisUtil
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 哨兵对象，负责通过哨兵获取当前的主节点地址
+type sentinel struct {
+	// Redis配置对象
+	config *RedisConfig
+
+	// 哨兵地址列表(可用的哨兵会被调整到最前面)
+	addressList []string
+
+	// 当前的主节点地址
+	masterAddress string
+
+	// 锁对象
+	mutex sync.RWMutex
+}
+
+// 获取最近一次发现的主节点地址
+// 返回值:
+// 主节点地址
+func (this *sentinel) getMasterAddress() string {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	return this.masterAddress
+}
+
+// 依次询问哨兵，获取当前的主节点地址
+// 返回值:
+// 主节点地址
+// 错误对象
+func (this *sentinel) discoverMaster() (address string, err error) {
+	this.mutex.RLock()
+	addressList := make([]string, len(this.addressList))
+	copy(addressList, this.addressList)
+	this.mutex.RUnlock()
+
+	if len(addressList) == 0 {
+		err = fmt.Errorf("sentinel address is empty")
+		return
+	}
+
+	var lastErr error
+	for index, sentinelAddress := range addressList {
+		if address, lastErr = this.queryMaster(sentinelAddress); lastErr != nil {
+			continue
+		}
+
+		this.mutex.Lock()
+		this.masterAddress = address
+
+		// 将可用的哨兵放到最前面，下次优先使用
+		if index > 0 {
+			this.addressList[0], this.addressList[index] = this.addressList[index], this.addressList[0]
+		}
+		this.mutex.Unlock()
+
+		return
+	}
+
+	err = fmt.Errorf("get master address of %s from sentinel failed, err:%s", this.config.MasterName, lastErr)
+	return
+}
+
+// 从指定的哨兵获取主节点地址
+// sentinelAddress:哨兵地址
+// 返回值:
+// 主节点地址
+// 错误对象
+func (this *sentinel) queryMaster(sentinelAddress string) (address string, err error) {
+	timeout := this.config.DialConnectTimeout
+	conn, err := redis.Dial("tcp", sentinelAddress,
+		redis.DialConnectTimeout(timeout), redis.DialReadTimeout(timeout), redis.DialWriteTimeout(timeout))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var result []string
+	result, err = redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", this.config.MasterName))
+	if err != nil {
+		return
+	}
+	if len(result) != 2 {
+		err = fmt.Errorf("sentinel %s does not know master %s", sentinelAddress, this.config.MasterName)
+		return
+	}
+
+	address = net.JoinHostPort(result[0], result[1])
+	return
+}
+
+// 连接到当前的主节点(供连接池创建连接使用)
+// 返回值:
+// 连接对象
+// 错误对象
+func (this *sentinel) dial() (redis.Conn, error) {
+	address, err := this.discoverMaster()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(address, this.config, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 故障转移过程中哨兵返回的地址可能还不是主节点
+	if err = checkRole(conn, "master"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// 检查连接对应节点的角色
+// conn:连接对象
+// expectRole:期望的角色(master/slave/sentinel)
+// 返回值:
+// 错误对象
+func checkRole(conn redis.Conn, expectRole string) error {
+	values, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("ROLE reply is empty")
+	}
+
+	role, err := redis.String(values[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != expectRole {
+		return fmt.Errorf("role of redis is %s, but expect %s", role, expectRole)
+	}
+
+	return nil
+}
+
+// 创建哨兵对象
+// config:Redis配置对象
+// 返回值:
+// 哨兵对象
+func newSentinel(config *RedisConfig) *sentinel {
+	return &sentinel{
+		config:      config,
+		addressList: config.GetAddressList(),
+	}
+}
@@ -0,0 +1,321 @@
+package redisUtil
+
+import (
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 有序集合的成员
+type ZMember struct {
+	// 成员
+	Member string
+
+	// 分数
+	Score float64
+}
+
+// 添加多个成员到有序集合中(浮点数分数)
+// key:有序集合的key
+// setType:设置类型
+// members:成员列表
+// 返回值:
+// 新添加的成员数量
+// 错误对象
+func (this *RedisPool) ZAddFloat(key string, setType SetType, members ...*ZMember) (addCount int, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	paramList := make([]interface{}, 0, len(members)*2+2)
+	paramList = append(paramList, key)
+	if setType != Set_Write {
+		paramList = append(paramList, setType)
+	}
+	for _, item := range members {
+		paramList = append(paramList, item.Score, item.Member)
+	}
+
+	addCount, err = redis.Int(conn.Do("ZADD", paramList...))
+	return
+}
+
+// 获取指定成员的分数(浮点数分数)
+// key:有序集合的key
+// member:成员
+// 返回值:
+// 分数
+// 是否存在
+// 错误对象
+func (this *RedisPool) ZScoreFloat(key, member string) (score float64, exists bool, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	score, err = redis.Float64(conn.Do("ZSCORE", key, member))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return
+	}
+
+	exists = true
+
+	return
+}
+
+// 为指定成员的分数加上增量，成员不存在时视为0
+// key:有序集合的key
+// increment:增量(可以为负数)
+// member:成员
+// 返回值:
+// 新的分数
+// 错误对象
+func (this *RedisPool) ZIncrBy(key string, increment float64, member string) (newScore float64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	newScore, err = redis.Float64(conn.Do("ZINCRBY", key, increment, member))
+	return
+}
+
+// 获取成员的排名(按分数从低到高，从0开始)
+// key:有序集合的key
+// member:成员
+// 返回值:
+// 排名
+// 是否存在
+// 错误对象
+func (this *RedisPool) ZRank(key, member string) (rank int64, exists bool, err error) {
+	return this.zRank("ZRANK", key, member)
+}
+
+// 获取成员的排名(按分数从高到低，从0开始)
+// key:有序集合的key
+// member:成员
+// 返回值:
+// 排名
+// 是否存在
+// 错误对象
+func (this *RedisPool) ZRevRank(key, member string) (rank int64, exists bool, err error) {
+	return this.zRank("ZREVRANK", key, member)
+}
+
+func (this *RedisPool) zRank(commandName, key, member string) (rank int64, exists bool, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	rank, err = redis.Int64(conn.Do(commandName, key, member))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return
+	}
+
+	exists = true
+
+	return
+}
+
+// 按排名区间获取成员及分数(分数从低到高)
+// key:有序集合的key
+// start:开始排名(从0开始，负数表示倒数)
+// stop:结束排名(包含)
+// 返回值:
+// 成员列表
+// 错误对象
+func (this *RedisPool) ZRangeWithScores(key string, start, stop int) (memberList []*ZMember, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	memberList, err = zMembers(conn.Do("ZRANGE", key, start, stop, "WITHSCORES"))
+	return
+}
+
+// 按排名区间获取成员及分数(分数从高到低)
+// key:有序集合的key
+// start:开始排名(从0开始，负数表示倒数)
+// stop:结束排名(包含)
+// 返回值:
+// 成员列表
+// 错误对象
+func (this *RedisPool) ZRevRangeWithScores(key string, start, stop int) (memberList []*ZMember, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	memberList, err = zMembers(conn.Do("ZREVRANGE", key, start, stop, "WITHSCORES"))
+	return
+}
+
+// 按分数区间获取成员及分数(分数从低到高)
+// key:有序集合的key
+// min:最小分数，如：1、(1(不包含)、-inf
+// max:最大分数，如：10、(10(不包含)、+inf
+// offset:跳过的数量
+// count:获取的数量，<=0表示不限制
+// 返回值:
+// 成员列表
+// 错误对象
+func (this *RedisPool) ZRangeByScore(key, min, max string, offset, count int) (memberList []*ZMember, err error) {
+	return this.zRangeByScore("ZRANGEBYSCORE", key, min, max, offset, count)
+}
+
+// 按分数区间获取成员及分数(分数从高到低)
+// (ZRevRangeByScore实际执行的是ZREVRANGE，因此使用该名称)
+// key:有序集合的key
+// max:最大分数，如：10、(10(不包含)、+inf
+// min:最小分数，如：1、(1(不包含)、-inf
+// offset:跳过的数量
+// count:获取的数量，<=0表示不限制
+// 返回值:
+// 成员列表
+// 错误对象
+func (this *RedisPool) ZRevRangeByScore2(key, max, min string, offset, count int) (memberList []*ZMember, err error) {
+	return this.zRangeByScore("ZREVRANGEBYSCORE", key, max, min, offset, count)
+}
+
+func (this *RedisPool) zRangeByScore(commandName, key, from, to string, offset, count int) (memberList []*ZMember, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	paramList := []interface{}{key, from, to, "WITHSCORES"}
+	if count > 0 {
+		paramList = append(paramList, "LIMIT", offset, count)
+	} else if offset > 0 {
+		paramList = append(paramList, "LIMIT", offset, -1)
+	}
+
+	memberList, err = zMembers(conn.Do(commandName, paramList...))
+	return
+}
+
+// 获取分数区间内的成员数量
+// key:有序集合的key
+// min:最小分数，如：1、(1(不包含)、-inf
+// max:最大分数，如：10、(10(不包含)、+inf
+// 返回值:
+// 成员数量
+// 错误对象
+func (this *RedisPool) ZCount(key, min, max string) (count int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	count, err = redis.Int64(conn.Do("ZCOUNT", key, min, max))
+	return
+}
+
+// 移除排名区间内的成员(分数从低到高，从0开始)
+// key:有序集合的key
+// start:开始排名(负数表示倒数)
+// stop:结束排名(包含)
+// 返回值:
+// 移除的数量
+// 错误对象
+func (this *RedisPool) ZRemRangeByRank(key string, start, stop int) (removeCount int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	removeCount, err = redis.Int64(conn.Do("ZREMRANGEBYRANK", key, start, stop))
+	return
+}
+
+// 移除分数区间内的成员
+// key:有序集合的key
+// min:最小分数，如：1、(1(不包含)、-inf
+// max:最大分数，如：10、(10(不包含)、+inf
+// 返回值:
+// 移除的数量
+// 错误对象
+func (this *RedisPool) ZRemRangeByScore(key, min, max string) (removeCount int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	removeCount, err = redis.Int64(conn.Do("ZREMRANGEBYSCORE", key, min, max))
+	return
+}
+
+// 计算多个有序集合的并集并保存到destination中
+// (集群模式下所有key必须在同一个槽，可以使用{hashtag})
+// destination:保存结果的key
+// keys:有序集合的key列表
+// weights:各集合分数的权重，为nil表示都为1
+// aggregate:分数的聚合方式
+// 返回值:
+// 结果集合的成员数量
+// 错误对象
+func (this *RedisPool) ZUnionStore(destination string, keys []string, weights []float64, aggregate AggregateType) (count int64, err error) {
+	return this.zStore("ZUNIONSTORE", destination, keys, weights, aggregate)
+}
+
+// 计算多个有序集合的交集并保存到destination中
+// (集群模式下所有key必须在同一个槽，可以使用{hashtag})
+// destination:保存结果的key
+// keys:有序集合的key列表
+// weights:各集合分数的权重，为nil表示都为1
+// aggregate:分数的聚合方式
+// 返回值:
+// 结果集合的成员数量
+// 错误对象
+func (this *RedisPool) ZInterStore(destination string, keys []string, weights []float64, aggregate AggregateType) (count int64, err error) {
+	return this.zStore("ZINTERSTORE", destination, keys, weights, aggregate)
+}
+
+func (this *RedisPool) zStore(commandName, destination string, keys []string, weights []float64, aggregate AggregateType) (count int64, err error) {
+	if len(keys) == 0 {
+		err = fmt.Errorf("keys is empty")
+		return
+	}
+	if weights != nil && len(weights) != len(keys) {
+		err = fmt.Errorf("the count of weights must be equal to the count of keys")
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	paramList := make([]interface{}, 0, len(keys)*2+5)
+	paramList = append(paramList, destination, len(keys))
+	for _, key := range keys {
+		paramList = append(paramList, key)
+	}
+	if weights != nil {
+		paramList = append(paramList, "WEIGHTS")
+		for _, weight := range weights {
+			paramList = append(paramList, weight)
+		}
+	}
+	if aggregate != Aggregate_Sum {
+		paramList = append(paramList, "AGGREGATE", aggregate)
+	}
+
+	count, err = redis.Int64(conn.Do(commandName, paramList...))
+	return
+}
+
+// 将WITHSCORES的回复转换为成员列表
+func zMembers(reply interface{}, err error) (memberList []*ZMember, _ error) {
+	values, err := redis.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("invalid WITHSCORES reply")
+	}
+
+	memberList = make([]*ZMember, 0, len(values)/2)
+	for index := 0; index < len(values); index += 2 {
+		score, err := redis.Float64([]byte(values[index+1]), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		memberList = append(memberList, &ZMember{
+			Member: values[index],
+			Score:  score,
+		})
+	}
+
+	return memberList, nil
+}
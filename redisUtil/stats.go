@@ -0,0 +1,363 @@
+package redisUtil
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/polariseye/goutil/logUtil"
+)
+
+var (
+	// 命令耗时直方图的区间上限，CommandStats.BucketCountList[i]为耗时不超过LatencyBucketList[i]的次数，最后一项为超过所有上限的次数
+	LatencyBucketList = []time.Duration{
+		time.Millisecond,
+		2 * time.Millisecond,
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+	}
+
+	// 阻塞命令，耗时取决于等待时间，不记录为慢命令
+	blockingCommandMap = map[string]bool{
+		"BLPOP":      true,
+		"BRPOP":      true,
+		"BRPOPLPUSH": true,
+		"BZPOPMIN":   true,
+		"BZPOPMAX":   true,
+		"XREAD":      true,
+		"XREADGROUP": true,
+		"WAIT":       true,
+	}
+)
+
+// 连接池统计信息
+type PoolStats struct {
+	// 连接数(包括空闲连接和使用中的连接)
+	ActiveCount int
+
+	// 空闲连接数
+	IdleCount int
+
+	// 获取连接的次数
+	WaitCount int64
+
+	// 获取连接的总耗时(包括建立新连接的时间)
+	WaitDuration time.Duration
+
+	// 连接池已满导致获取连接失败的次数
+	ExhaustedCount int64
+
+	// 各命令的统计信息，key为大写的命令名称
+	CommandStatsMap map[string]*CommandStats
+}
+
+// 命令统计信息
+type CommandStats struct {
+	// 执行次数
+	Count int64
+
+	// 出错次数(包括网络错误和Redis返回的错误)
+	ErrorCount int64
+
+	// 慢命令次数
+	SlowCount int64
+
+	// 总耗时
+	TotalDuration time.Duration
+
+	// 最大耗时
+	MaxDuration time.Duration
+
+	// 耗时直方图，区间见LatencyBucketList
+	BucketCountList []int64
+}
+
+// 获取平均耗时
+// 返回值:
+// 平均耗时
+func (this *CommandStats) AverageDuration() time.Duration {
+	if this.Count == 0 {
+		return 0
+	}
+
+	return this.TotalDuration / time.Duration(this.Count)
+}
+
+// 命令统计的内部对象，使用原子操作更新
+type commandStats struct {
+	count         int64
+	errorCount    int64
+	slowCount     int64
+	totalDuration int64
+	maxDuration   int64
+	bucketList    []int64
+}
+
+// 记录一次执行
+func (this *commandStats) record(duration time.Duration, isError, isSlow bool) {
+	atomic.AddInt64(&this.count, 1)
+	if isError {
+		atomic.AddInt64(&this.errorCount, 1)
+	}
+	if isSlow {
+		atomic.AddInt64(&this.slowCount, 1)
+	}
+	atomic.AddInt64(&this.totalDuration, int64(duration))
+	for {
+		maxDuration := atomic.LoadInt64(&this.maxDuration)
+		if int64(duration) <= maxDuration || atomic.CompareAndSwapInt64(&this.maxDuration, maxDuration, int64(duration)) {
+			break
+		}
+	}
+
+	index := sort.Search(len(LatencyBucketList), func(i int) bool { return duration <= LatencyBucketList[i] })
+	atomic.AddInt64(&this.bucketList[index], 1)
+}
+
+// 获取快照
+func (this *commandStats) snapshot() *CommandStats {
+	result := &CommandStats{
+		Count:           atomic.LoadInt64(&this.count),
+		ErrorCount:      atomic.LoadInt64(&this.errorCount),
+		SlowCount:       atomic.LoadInt64(&this.slowCount),
+		TotalDuration:   time.Duration(atomic.LoadInt64(&this.totalDuration)),
+		MaxDuration:     time.Duration(atomic.LoadInt64(&this.maxDuration)),
+		BucketCountList: make([]int64, len(this.bucketList)),
+	}
+	for index := range this.bucketList {
+		result.BucketCountList[index] = atomic.LoadInt64(&this.bucketList[index])
+	}
+
+	return result
+}
+
+// 连接池统计对象
+type poolStats struct {
+	// 连接池名称(用于日志)
+	name string
+
+	waitCount      int64
+	waitDuration   int64
+	exhaustedCount int64
+
+	// 慢命令阈值(纳秒)，<=0表示不记录
+	slowThreshold int64
+
+	// 命令名称对应的统计对象
+	commandMap sync.Map
+}
+
+// 记录一次获取连接
+func (this *poolStats) recordWait(startTime time.Time, err error) {
+	atomic.AddInt64(&this.waitCount, 1)
+	atomic.AddInt64(&this.waitDuration, int64(time.Since(startTime)))
+	if err == redis.ErrPoolExhausted {
+		atomic.AddInt64(&this.exhaustedCount, 1)
+	}
+}
+
+// 记录一次命令执行
+func (this *poolStats) recordCommand(commandName string, args []interface{}, duration time.Duration, err error) {
+	commandName = strings.ToUpper(commandName)
+
+	isSlow := false
+	if slowThreshold := atomic.LoadInt64(&this.slowThreshold); slowThreshold > 0 && int64(duration) >= slowThreshold && !blockingCommandMap[commandName] {
+		isSlow = true
+
+		// 只记录key，避免日志过大或泄露数据
+		key, _ := getCommandKey(commandName, args)
+		logUtil.NormalLog(fmt.Sprintf("redisUtil: %s执行慢命令%s %s，耗时%v", this.name, commandName, key, duration), logUtil.Warn)
+	}
+
+	item, exists := this.commandMap.Load(commandName)
+	if !exists {
+		item, _ = this.commandMap.LoadOrStore(commandName, &commandStats{
+			bucketList: make([]int64, len(LatencyBucketList)+1),
+		})
+	}
+	item.(*commandStats).record(duration, err != nil, isSlow)
+}
+
+// 清空统计信息
+func (this *poolStats) reset() {
+	atomic.StoreInt64(&this.waitCount, 0)
+	atomic.StoreInt64(&this.waitDuration, 0)
+	atomic.StoreInt64(&this.exhaustedCount, 0)
+	this.commandMap.Range(func(key, value interface{}) bool {
+		this.commandMap.Delete(key)
+		return true
+	})
+}
+
+// 带统计功能的连接对象，实现redis.Conn接口
+type statsConn struct {
+	redis.Conn
+
+	stats *poolStats
+
+	// 已发送但尚未接收回复的命令
+	pendingList []*pendingCommand
+}
+
+// 已发送但尚未接收回复的命令
+type pendingCommand struct {
+	commandName string
+	args        []interface{}
+	startTime   time.Time
+}
+
+// 执行命令
+func (this *statsConn) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	return this.do(commandName, args, func() (interface{}, error) {
+		return this.Conn.Do(commandName, args...)
+	})
+}
+
+// 以指定的读取超时时间执行命令，实现redis.ConnWithTimeout接口
+func (this *statsConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return this.do(commandName, args, func() (interface{}, error) {
+		return redis.DoWithTimeout(this.Conn, timeout, commandName, args...)
+	})
+}
+
+// 执行命令并记录统计信息
+// doFunc:在内部连接上执行命令的方法
+func (this *statsConn) do(commandName string, args []interface{}, doFunc func() (interface{}, error)) (reply interface{}, err error) {
+	// 空命令用于接收之前发送的所有命令的回复，按管道处理
+	if commandName == "" {
+		reply, err = doFunc()
+		for _, item := range this.pendingList {
+			this.stats.recordCommand(item.commandName, item.args, time.Since(item.startTime), err)
+		}
+		this.pendingList = nil
+
+		return
+	}
+
+	// 之前还有未接收的回复时，Do会先接收这些回复
+	for _, item := range this.pendingList {
+		this.stats.recordCommand(item.commandName, item.args, time.Since(item.startTime), nil)
+	}
+	this.pendingList = nil
+
+	startTime := time.Now()
+	reply, err = doFunc()
+	this.stats.recordCommand(commandName, args, time.Since(startTime), err)
+
+	return
+}
+
+// 将命令写入缓冲区
+func (this *statsConn) Send(commandName string, args ...interface{}) error {
+	err := this.Conn.Send(commandName, args...)
+	if err == nil {
+		this.pendingList = append(this.pendingList, &pendingCommand{
+			commandName: commandName,
+			args:        args,
+			startTime:   time.Now(),
+		})
+	}
+
+	return err
+}
+
+// 接收一个回复
+func (this *statsConn) Receive() (reply interface{}, err error) {
+	reply, err = this.Conn.Receive()
+	this.recordReceive(err)
+
+	return
+}
+
+// 以指定的读取超时时间接收一个回复，实现redis.ConnWithTimeout接口
+func (this *statsConn) ReceiveWithTimeout(timeout time.Duration) (reply interface{}, err error) {
+	reply, err = redis.ReceiveWithTimeout(this.Conn, timeout)
+	this.recordReceive(err)
+
+	return
+}
+
+// 记录最早发送的命令的统计信息
+func (this *statsConn) recordReceive(err error) {
+	if len(this.pendingList) > 0 {
+		item := this.pendingList[0]
+		this.pendingList = this.pendingList[1:]
+		this.stats.recordCommand(item.commandName, item.args, time.Since(item.startTime), err)
+	}
+}
+
+// 关闭连接
+func (this *statsConn) Close() error {
+	this.pendingList = nil
+	return this.Conn.Close()
+}
+
+// 设置慢命令阈值，执行时间超过该值的命令会通过logUtil记录警告日志
+// threshold:阈值，<=0表示不记录
+func (this *RedisPool) SetSlowThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&this.stats.slowThreshold, int64(threshold))
+}
+
+// 获取连接池的统计信息快照
+// 返回值:
+// 统计信息
+func (this *RedisPool) GetStats() *PoolStats {
+	result := &PoolStats{
+		WaitCount:       atomic.LoadInt64(&this.stats.waitCount),
+		WaitDuration:    time.Duration(atomic.LoadInt64(&this.stats.waitDuration)),
+		ExhaustedCount:  atomic.LoadInt64(&this.stats.exhaustedCount),
+		CommandStatsMap: make(map[string]*CommandStats),
+	}
+
+	if this.cluster != nil {
+		for _, pool := range this.cluster.getPoolList() {
+			result.ActiveCount += pool.ActiveCount()
+			result.IdleCount += pool.IdleCount()
+		}
+	} else {
+		result.ActiveCount = this.pool.ActiveCount()
+		result.IdleCount = this.pool.IdleCount()
+	}
+
+	this.stats.commandMap.Range(func(key, value interface{}) bool {
+		result.CommandStatsMap[key.(string)] = value.(*commandStats).snapshot()
+		return true
+	})
+
+	return result
+}
+
+// 清空统计信息(连接数除外)，可用于按周期统计
+func (this *RedisPool) ResetStats() {
+	this.stats.reset()
+}
+
+// 从连接池获取连接并记录耗时
+// pool:连接池
+// stats:统计对象
+// 返回值:
+// 连接对象
+func getPoolConn(pool *redis.Pool, stats *poolStats) redis.Conn {
+	startTime := time.Now()
+	conn := pool.Get()
+	stats.recordWait(startTime, conn.Err())
+
+	return conn
+}
+
+// 创建统计对象
+func newPoolStats(name string) *poolStats {
+	return &poolStats{
+		name: name,
+	}
+}
@@ -0,0 +1,532 @@
+package redisUtil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 流中的一条消息
+type StreamEntry struct {
+	// 消息Id，如：1526919030474-0
+	Id string
+
+	// 字段和值
+	Fields map[string]string
+}
+
+// 消费组中待确认消息的概要信息
+type StreamPendingSummary struct {
+	// 待确认的消息总数
+	Count int64
+
+	// 待确认消息的最小Id和最大Id
+	MinId string
+	MaxId string
+
+	// 各消费者待确认的消息数量
+	ConsumerMap map[string]int64
+}
+
+// 消费组中一条待确认消息的详细信息
+type StreamPendingEntry struct {
+	// 消息Id
+	Id string
+
+	// 当前所属的消费者
+	Consumer string
+
+	// 距离上一次投递的时间
+	Idle time.Duration
+
+	// 投递次数
+	DeliveryCount int64
+}
+
+// 向流中添加消息
+// key:流的key
+// maxLen:流的最大长度，超过时裁剪最旧的消息，<=0表示不裁剪
+// isApproximate:是否近似裁剪(MAXLEN ~)，近似裁剪效率更高
+// id:消息Id，为空表示由Redis自动生成
+// fieldAndValues:字段和值，依次为field1,value1,field2,value2...
+// 返回值:
+// 消息Id
+// 错误对象
+func (this *RedisPool) XAdd(key string, maxLen int64, isApproximate bool, id string, fieldAndValues ...interface{}) (newId string, err error) {
+	if len(fieldAndValues) == 0 || len(fieldAndValues)%2 != 0 {
+		err = fmt.Errorf("fieldAndValues must be field and value pairs")
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(fieldAndValues)+5)
+	args = append(args, key)
+	args = appendMaxLenArgs(args, maxLen, isApproximate)
+	if id == "" {
+		id = "*"
+	}
+	args = append(args, id)
+	args = append(args, fieldAndValues...)
+
+	newId, err = redis.String(conn.Do("XADD", args...))
+	return
+}
+
+// 向流中添加消息
+// key:流的key
+// maxLen:流的最大长度，超过时裁剪最旧的消息，<=0表示不裁剪
+// isApproximate:是否近似裁剪(MAXLEN ~)
+// fields:字段和值
+// 返回值:
+// 消息Id
+// 错误对象
+func (this *RedisPool) XAdd2(key string, maxLen int64, isApproximate bool, fields map[string]string) (newId string, err error) {
+	fieldAndValues := make([]interface{}, 0, len(fields)*2)
+	for field, value := range fields {
+		fieldAndValues = append(fieldAndValues, field, value)
+	}
+
+	return this.XAdd(key, maxLen, isApproximate, "", fieldAndValues...)
+}
+
+// 获取流的长度
+// key:流的key
+// 返回值:
+// 消息数量
+// 错误对象
+func (this *RedisPool) XLen(key string) (count int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	count, err = redis.Int64(conn.Do("XLEN", key))
+	return
+}
+
+// 裁剪流
+// key:流的key
+// maxLen:保留的最大长度
+// isApproximate:是否近似裁剪
+// 返回值:
+// 删除的数量
+// 错误对象
+func (this *RedisPool) XTrim(key string, maxLen int64, isApproximate bool) (removeCount int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := appendMaxLenArgs([]interface{}{key}, maxLen, isApproximate)
+	removeCount, err = redis.Int64(conn.Do("XTRIM", args...))
+	return
+}
+
+// 删除流中的消息
+// key:流的key
+// ids:消息Id列表
+// 返回值:
+// 删除的数量
+// 错误对象
+func (this *RedisPool) XDel(key string, ids ...string) (removeCount int64, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	removeCount, err = redis.Int64(conn.Do("XDEL", stringArgs(key, ids)...))
+	return
+}
+
+// 按Id从小到大获取区间内的消息
+// key:流的key
+// start:开始Id，"-"表示最小
+// end:结束Id，"+"表示最大
+// count:最大数量，<=0表示不限制
+// 返回值:
+// 消息列表
+// 错误对象
+func (this *RedisPool) XRange(key, start, end string, count int) (entryList []*StreamEntry, err error) {
+	return this.xRange("XRANGE", key, start, end, count)
+}
+
+// 按Id从大到小获取区间内的消息
+// key:流的key
+// end:结束Id，"+"表示最大
+// start:开始Id，"-"表示最小
+// count:最大数量，<=0表示不限制
+// 返回值:
+// 消息列表
+// 错误对象
+func (this *RedisPool) XRevRange(key, end, start string, count int) (entryList []*StreamEntry, err error) {
+	return this.xRange("XREVRANGE", key, end, start, count)
+}
+
+func (this *RedisPool) xRange(commandName, key, from, to string, count int) (entryList []*StreamEntry, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := []interface{}{key, from, to}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	entryList, err = streamEntries(conn.Do(commandName, args...))
+	return
+}
+
+// 创建消费组
+// key:流的key
+// group:消费组名称
+// startId:开始消费的Id，"$"表示只消费新消息，"0"表示从头消费
+// isMkStream:流不存在时是否自动创建
+// 返回值:
+// 是否新创建(消费组已存在时返回false)
+// 错误对象
+func (this *RedisPool) XGroupCreate(key, group, startId string, isMkStream bool) (created bool, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := []interface{}{"CREATE", key, group, startId}
+	if isMkStream {
+		args = append(args, "MKSTREAM")
+	}
+
+	if _, err = conn.Do("XGROUP", args...); err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			err = nil
+		}
+
+		return
+	}
+
+	created = true
+
+	return
+}
+
+// 删除消费组
+// key:流的key
+// group:消费组名称
+// 返回值:
+// 是否存在并删除
+// 错误对象
+func (this *RedisPool) XGroupDestroy(key, group string) (success bool, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	success, err = redis.Bool(conn.Do("XGROUP", "DESTROY", key, group))
+	return
+}
+
+// 以消费组的方式读取消息
+// key:流的key
+// group:消费组名称
+// consumer:消费者名称
+// id:">"表示读取从未投递给其它消费者的新消息，其它Id表示读取本消费者该Id之后的待确认消息
+// count:最大数量，<=0表示不限制
+// block:没有消息时的阻塞时间，<=0表示不阻塞
+// 返回值:
+// 消息列表(阻塞超时返回空列表)
+// 错误对象
+func (this *RedisPool) XReadGroup(key, group, consumer, id string, count int, block time.Duration) (entryList []*StreamEntry, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := []interface{}{"GROUP", group, consumer}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if block > 0 {
+		blockMilliseconds := int64(block / time.Millisecond)
+		if blockMilliseconds <= 0 {
+			blockMilliseconds = 1
+		}
+		args = append(args, "BLOCK", blockMilliseconds)
+	}
+	args = append(args, "STREAMS", key, id)
+
+	var streamList []interface{}
+	streamList, err = redis.Values(conn.Do("XREADGROUP", args...))
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return
+	}
+
+	// 结构为：[[key, [entry1, entry2...]]]
+	for _, item := range streamList {
+		var stream []interface{}
+		if stream, err = redis.Values(item, nil); err != nil {
+			return
+		}
+		if len(stream) != 2 {
+			err = fmt.Errorf("invalid XREADGROUP reply")
+			return
+		}
+
+		var streamEntryList []*StreamEntry
+		if streamEntryList, err = streamEntries(stream[1], nil); err != nil {
+			return
+		}
+		entryList = append(entryList, streamEntryList...)
+	}
+
+	return
+}
+
+// 确认消息已处理
+// key:流的key
+// group:消费组名称
+// ids:消息Id列表
+// 返回值:
+// 确认成功的数量
+// 错误对象
+func (this *RedisPool) XAck(key, group string, ids ...string) (ackCount int64, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, key, group)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	ackCount, err = redis.Int64(conn.Do("XACK", args...))
+	return
+}
+
+// 获取消费组中待确认消息的概要信息
+// key:流的key
+// group:消费组名称
+// 返回值:
+// 概要信息
+// 错误对象
+func (this *RedisPool) XPending(key, group string) (summary *StreamPendingSummary, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	var reply []interface{}
+	if reply, err = redis.Values(conn.Do("XPENDING", key, group)); err != nil {
+		return
+	}
+	if len(reply) != 4 {
+		err = fmt.Errorf("invalid XPENDING reply")
+		return
+	}
+
+	summary = &StreamPendingSummary{
+		ConsumerMap: make(map[string]int64),
+	}
+	if summary.Count, err = redis.Int64(reply[0], nil); err != nil {
+		return
+	}
+	if summary.Count == 0 {
+		return
+	}
+	if summary.MinId, err = redis.String(reply[1], nil); err != nil {
+		return
+	}
+	if summary.MaxId, err = redis.String(reply[2], nil); err != nil {
+		return
+	}
+
+	var consumerList []interface{}
+	if consumerList, err = redis.Values(reply[3], nil); err != nil {
+		return
+	}
+	for _, item := range consumerList {
+		var consumerInfo []string
+		if consumerInfo, err = redis.Strings(item, nil); err != nil {
+			return
+		}
+		if len(consumerInfo) != 2 {
+			err = fmt.Errorf("invalid XPENDING consumer reply")
+			return
+		}
+
+		var count int64
+		if count, err = redis.Int64([]byte(consumerInfo[1]), nil); err != nil {
+			return
+		}
+		summary.ConsumerMap[consumerInfo[0]] = count
+	}
+
+	return
+}
+
+// 获取消费组中待确认消息的详细信息
+// key:流的key
+// group:消费组名称
+// start:开始Id，"-"表示最小
+// end:结束Id，"+"表示最大
+// count:最大数量
+// consumer:消费者名称，为空表示所有消费者
+// 返回值:
+// 待确认消息列表
+// 错误对象
+func (this *RedisPool) XPendingExt(key, group, start, end string, count int, consumer string) (pendingList []*StreamPendingEntry, err error) {
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := []interface{}{key, group, start, end, count}
+	if consumer != "" {
+		args = append(args, consumer)
+	}
+
+	var reply []interface{}
+	if reply, err = redis.Values(conn.Do("XPENDING", args...)); err != nil {
+		return
+	}
+
+	pendingList = make([]*StreamPendingEntry, 0, len(reply))
+	for _, item := range reply {
+		var fieldList []interface{}
+		if fieldList, err = redis.Values(item, nil); err != nil {
+			return
+		}
+		if len(fieldList) != 4 {
+			err = fmt.Errorf("invalid XPENDING reply")
+			return
+		}
+
+		pendingObj := &StreamPendingEntry{}
+		if pendingObj.Id, err = redis.String(fieldList[0], nil); err != nil {
+			return
+		}
+		if pendingObj.Consumer, err = redis.String(fieldList[1], nil); err != nil {
+			return
+		}
+
+		var idleMilliseconds int64
+		if idleMilliseconds, err = redis.Int64(fieldList[2], nil); err != nil {
+			return
+		}
+		pendingObj.Idle = time.Duration(idleMilliseconds) * time.Millisecond
+
+		if pendingObj.DeliveryCount, err = redis.Int64(fieldList[3], nil); err != nil {
+			return
+		}
+
+		pendingList = append(pendingList, pendingObj)
+	}
+
+	return
+}
+
+// 将空闲时间超过指定值的待确认消息转移给指定消费者
+// key:流的key
+// group:消费组名称
+// consumer:接收消息的消费者名称
+// minIdle:最小空闲时间，只转移空闲时间不小于该值的消息
+// ids:消息Id列表
+// 返回值:
+// 转移成功的消息列表(已被删除的消息不会返回)
+// 错误对象
+func (this *RedisPool) XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) (entryList []*StreamEntry, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(ids)+4)
+	args = append(args, key, group, consumer, int64(minIdle/time.Millisecond))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	entryList, err = streamEntries(conn.Do("XCLAIM", args...))
+	return
+}
+
+// 将空闲时间超过指定值的待确认消息转移给指定消费者，只返回消息Id(JUSTID)，不增加投递次数
+// key:流的key
+// group:消费组名称
+// consumer:接收消息的消费者名称
+// minIdle:最小空闲时间，只转移空闲时间不小于该值的消息
+// ids:消息Id列表
+// 返回值:
+// 转移成功的消息Id列表(Redis 5、6中包含已被删除的消息)
+// 错误对象
+func (this *RedisPool) XClaimJustId(key, group, consumer string, minIdle time.Duration, ids ...string) (idList []string, err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	conn := this.GetConnection()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(ids)+5)
+	args = append(args, key, group, consumer, int64(minIdle/time.Millisecond))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, "JUSTID")
+
+	idList, err = redis.Strings(conn.Do("XCLAIM", args...))
+	return
+}
+
+// 添加MAXLEN参数
+func appendMaxLenArgs(args []interface{}, maxLen int64, isApproximate bool) []interface{} {
+	if maxLen <= 0 {
+		return args
+	}
+
+	args = append(args, "MAXLEN")
+	if isApproximate {
+		args = append(args, "~")
+	}
+
+	return append(args, maxLen)
+}
+
+// 将回复转换为消息列表
+// 结构为：[[id, [field1, value1, ...]], ...]，已被删除的消息的字段为nil
+func streamEntries(reply interface{}, err error) (entryList []*StreamEntry, _ error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+
+		return nil, err
+	}
+
+	entryList = make([]*StreamEntry, 0, len(values))
+	for _, item := range values {
+		// XCLAIM对已被删除的消息返回nil
+		if item == nil {
+			continue
+		}
+
+		entry, err := redis.Values(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, fmt.Errorf("invalid stream entry reply")
+		}
+
+		entryObj := &StreamEntry{}
+		if entryObj.Id, err = redis.String(entry[0], nil); err != nil {
+			return nil, err
+		}
+
+		if entry[1] != nil {
+			if entryObj.Fields, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+
+		entryList = append(entryList, entryObj)
+	}
+
+	return entryList, nil
+}
@@ -0,0 +1,342 @@
+package redisUtil
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/polariseye/goutil/logUtil"
+)
+
+const (
+	// 每次读取的默认消息数量
+	con_STREAM_DEFAULT_BATCH_COUNT = 10
+
+	// 没有新消息时的默认阻塞时间(同时也是停止消费者的最大等待时间)
+	con_STREAM_DEFAULT_BLOCK_TIME = 2 * time.Second
+
+	// 待确认消息的默认最小空闲时间，超过该时间未确认的消息会被重新认领
+	con_STREAM_DEFAULT_CLAIM_MIN_IDLE = time.Minute
+
+	// 默认的认领检查间隔
+	con_STREAM_DEFAULT_CLAIM_INTERVAL = 30 * time.Second
+
+	// 读取出错后的重试间隔
+	con_STREAM_RETRY_INTERVAL = time.Second
+)
+
+// 流消费者，以消费组的方式循环读取消息并交由处理方法处理
+// 处理成功的消息会被确认(XACK)；处理失败的消息保留在待确认列表中，
+// 空闲时间超过指定值后会被本消费组中的某个消费者重新认领(XCLAIM)并处理
+type StreamConsumer struct {
+	redisPool *RedisPool
+
+	// 流的key、消费组名称、消费者名称
+	key      string
+	group    string
+	consumer string
+
+	// 消息处理方法，返回nil表示处理成功
+	handler func(entry *StreamEntry) error
+
+	// 每次读取的消息数量
+	batchCount int
+
+	// 没有新消息时的阻塞时间
+	blockTime time.Duration
+
+	// 认领的最小空闲时间以及检查间隔，间隔<=0表示不认领
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+
+	// 锁对象，保护以下字段
+	mutex     sync.Mutex
+	isStarted bool
+
+	// 用于停止协程
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// 消费协程退出信号
+	closeSignal chan struct{}
+}
+
+// 创建流消费者
+// key:流的key
+// group:消费组名称(不存在时在Start中自动创建)
+// consumer:消费者名称，同一消费组中应唯一
+// handler:消息处理方法(在消费协程中调用)，返回nil表示处理成功
+// 返回值:
+// 流消费者
+func (this *RedisPool) NewStreamConsumer(key, group, consumer string, handler func(entry *StreamEntry) error) *StreamConsumer {
+	return &StreamConsumer{
+		redisPool:     this,
+		key:           key,
+		group:         group,
+		consumer:      consumer,
+		handler:       handler,
+		batchCount:    con_STREAM_DEFAULT_BATCH_COUNT,
+		blockTime:     con_STREAM_DEFAULT_BLOCK_TIME,
+		claimMinIdle:  con_STREAM_DEFAULT_CLAIM_MIN_IDLE,
+		claimInterval: con_STREAM_DEFAULT_CLAIM_INTERVAL,
+		done:          make(chan struct{}),
+		closeSignal:   make(chan struct{}),
+	}
+}
+
+// 设置每次读取的消息数量(需要在Start之前调用)
+// batchCount:消息数量
+func (this *StreamConsumer) SetBatchCount(batchCount int) {
+	if batchCount > 0 {
+		this.batchCount = batchCount
+	}
+}
+
+// 设置没有新消息时的阻塞时间(需要在Start之前调用)
+// blockTime:阻塞时间，也是Stop的最大等待时间
+func (this *StreamConsumer) SetBlockTime(blockTime time.Duration) {
+	if blockTime > 0 {
+		this.blockTime = blockTime
+	}
+}
+
+// 设置待确认消息的认领参数(需要在Start之前调用)
+// minIdle:最小空闲时间，超过该时间未确认的消息会被认领
+// interval:检查间隔，<=0表示不认领
+func (this *StreamConsumer) SetClaim(minIdle, interval time.Duration) {
+	this.claimMinIdle = minIdle
+	this.claimInterval = interval
+}
+
+// 启动消费者：创建消费组(从头开始消费)，先处理本消费者遗留的待确认消息，再循环读取新消息
+// 返回值:
+// 错误对象
+func (this *StreamConsumer) Start() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.isStarted {
+		return fmt.Errorf("stream consumer %s of %s is already started", this.consumer, this.key)
+	}
+
+	if _, err := this.redisPool.XGroupCreate(this.key, this.group, "0", true); err != nil {
+		return err
+	}
+
+	this.isStarted = true
+	go this.consumeLoop()
+
+	return nil
+}
+
+// 停止消费者，等待消费协程退出
+func (this *StreamConsumer) Stop() {
+	this.closeOnce.Do(func() {
+		close(this.done)
+
+		this.mutex.Lock()
+		isStarted := this.isStarted
+		this.mutex.Unlock()
+		if isStarted {
+			<-this.closeSignal
+		}
+	})
+}
+
+// 消费协程
+func (this *StreamConsumer) consumeLoop() {
+	defer close(this.closeSignal)
+
+	// 先处理本消费者上次未确认的消息(如进程异常退出时遗留的消息)
+	// 处理失败的消息仍在待确认列表中，留给认领流程处理
+	lastId := "0"
+	for !this.isStopped() {
+		entryList, err := this.redisPool.XReadGroup(this.key, this.group, this.consumer, lastId, this.batchCount, 0)
+		if err != nil {
+			this.logError("读取遗留消息", err)
+			this.sleep(con_STREAM_RETRY_INTERVAL)
+			continue
+		}
+		if len(entryList) == 0 {
+			break
+		}
+
+		for _, entry := range entryList {
+			// 已被删除的消息没有字段，直接确认
+			if entry.Fields == nil {
+				this.ack(entry.Id)
+				continue
+			}
+
+			this.process(entry)
+		}
+
+		lastId = entryList[len(entryList)-1].Id
+	}
+
+	lastClaimTime := time.Now()
+	for !this.isStopped() {
+		if this.claimInterval > 0 && time.Since(lastClaimTime) >= this.claimInterval {
+			this.claim()
+			lastClaimTime = time.Now()
+		}
+
+		entryList, err := this.redisPool.XReadGroup(this.key, this.group, this.consumer, ">", this.batchCount, this.blockTime)
+		if err != nil {
+			this.logError("读取消息", err)
+			this.sleep(con_STREAM_RETRY_INTERVAL)
+			continue
+		}
+
+		for _, entry := range entryList {
+			this.process(entry)
+		}
+	}
+}
+
+// 认领空闲时间过长的待确认消息并处理
+func (this *StreamConsumer) claim() {
+	start := "-"
+	for !this.isStopped() {
+		pendingList, err := this.redisPool.XPendingExt(this.key, this.group, start, "+", this.batchCount, "")
+		if err != nil {
+			this.logError("获取待确认消息", err)
+			return
+		}
+		if len(pendingList) == 0 {
+			return
+		}
+
+		idList := make([]string, 0, len(pendingList))
+		for _, pendingObj := range pendingList {
+			if pendingObj.Idle >= this.claimMinIdle {
+				idList = append(idList, pendingObj.Id)
+			}
+		}
+
+		if len(idList) > 0 && !this.claimIdList(idList) {
+			return
+		}
+
+		if len(pendingList) < this.batchCount {
+			return
+		}
+
+		// 从最后一条的下一个Id继续
+		if start, err = nextStreamId(pendingList[len(pendingList)-1].Id); err != nil {
+			this.logError("获取待确认消息", err)
+			return
+		}
+	}
+}
+
+// 认领指定的待确认消息并处理
+// idList:空闲时间过长的消息Id列表
+// 返回值:
+// 是否成功(失败时已记录日志)
+func (this *StreamConsumer) claimIdList(idList []string) bool {
+	// 只认领Id，再通过XRANGE获取消息内容，这样能准确知道哪些消息已转移给本消费者
+	ownedIdList, err := this.redisPool.XClaimJustId(this.key, this.group, this.consumer, this.claimMinIdle, idList...)
+	if err != nil {
+		this.logError("认领消息", err)
+		return false
+	}
+
+	ownedIdMap := make(map[string]bool, len(ownedIdList))
+	for _, id := range ownedIdList {
+		ownedIdMap[id] = true
+	}
+
+	for _, id := range idList {
+		entryList, err := this.redisPool.XRange(this.key, id, id, 1)
+		if err != nil {
+			this.logError("获取认领的消息", err)
+			return false
+		}
+
+		// 已被删除的消息直接确认，以免一直留在待确认列表中被反复认领
+		// Redis 7不返回已被删除的消息，所以未返回的Id也需要检查；消息已不存在，确认不会丢失数据
+		if len(entryList) == 0 || entryList[0].Id != id {
+			this.ack(id)
+			continue
+		}
+
+		// 未认领成功的消息(如已被其它消费者认领或读取)不能处理和确认
+		if ownedIdMap[id] {
+			this.process(entryList[0])
+		}
+	}
+
+	return true
+}
+
+// 获取指定消息Id的下一个Id
+// id:消息Id，格式为：毫秒时间戳-序号
+// 返回值:
+// 下一个Id
+// 错误对象
+func nextStreamId(id string) (string, error) {
+	var milliseconds, sequence uint64
+	if _, err := fmt.Sscanf(id, "%d-%d", &milliseconds, &sequence); err != nil {
+		return "", fmt.Errorf("invalid stream id %s", id)
+	}
+
+	if sequence == math.MaxUint64 {
+		return fmt.Sprintf("%d-0", milliseconds+1), nil
+	}
+
+	return fmt.Sprintf("%d-%d", milliseconds, sequence+1), nil
+}
+
+// 处理一条消息，成功则确认
+func (this *StreamConsumer) process(entry *StreamEntry) {
+	if err := this.handle(entry); err != nil {
+		logUtil.NormalLog(fmt.Sprintf("redisUtil.StreamConsumer: %s处理消息%s失败，错误信息为：%s", this.key, entry.Id, err), logUtil.Warn)
+		return
+	}
+
+	this.ack(entry.Id)
+}
+
+// 调用处理方法，将panic转换为错误
+func (this *StreamConsumer) handle(entry *StreamEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logUtil.LogUnknownError(r, "redisUtil.StreamConsumer.handle")
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return this.handler(entry)
+}
+
+// 确认消息
+func (this *StreamConsumer) ack(id string) {
+	if _, err := this.redisPool.XAck(this.key, this.group, id); err != nil {
+		this.logError("确认消息", err)
+	}
+}
+
+// 是否已经停止
+func (this *StreamConsumer) isStopped() bool {
+	select {
+	case <-this.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// 等待指定时间，停止时立即返回
+func (this *StreamConsumer) sleep(duration time.Duration) {
+	select {
+	case <-this.done:
+	case <-time.After(duration):
+	}
+}
+
+// 记录错误日志
+func (this *StreamConsumer) logError(action string, err error) {
+	logUtil.NormalLog(fmt.Sprintf("redisUtil.StreamConsumer: %s的%s%s失败，错误信息为：%s", this.redisPool.GetName(), this.key, action, err), logUtil.Error)
+}
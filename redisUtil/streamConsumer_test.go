@@ -0,0 +1,96 @@
+package redisUtil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestStreamConsumerClaimDeleted(t *testing.T) {
+	// isJustIdWithDeleted为true时模拟Redis 5、6：XCLAIM JUSTID会返回已被删除的消息Id
+	// 为false时与Redis 7相同：不返回已被删除的消息Id
+	for _, isJustIdWithDeleted := range []bool{true, false} {
+		testStreamConsumerClaimDeleted(t, isJustIdWithDeleted)
+	}
+}
+
+func testStreamConsumerClaimDeleted(t *testing.T, isJustIdWithDeleted bool) {
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer redisServer.Close()
+
+	redisPool := NewRedisPool2("test", &RedisConfig{
+		ConnectionString:   redisServer.Addr(),
+		MaxActive:          10,
+		MaxIdle:            2,
+		IdleTimeout:        time.Minute,
+		DialConnectTimeout: time.Second,
+	})
+	defer redisPool.Close()
+
+	if _, err = redisPool.XGroupCreate("stream", "group", "$", true); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keepId, _ := redisPool.XAdd("stream", 0, false, "", "name", "keep")
+	deleteId, _ := redisPool.XAdd("stream", 0, false, "", "name", "delete")
+
+	// 其它消费者读取后未确认，然后其中一条消息被删除
+	if entryList, err := redisPool.XReadGroup("stream", "group", "other", ">", 10, 0); err != nil || len(entryList) != 2 {
+		t.Fatalf("read: %v %v", entryList, err)
+	}
+	if _, err = redisPool.XDel("stream", deleteId); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var mutex sync.Mutex
+	ackMap := make(map[string]bool)
+	redisServer.Server().SetPreHook(func(peer *server.Peer, cmd string, args ...string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch cmd {
+		case "XACK":
+			for _, id := range args[2:] {
+				ackMap[id] = true
+			}
+		case "XCLAIM":
+			if isJustIdWithDeleted && args[len(args)-1] == "JUSTID" {
+				idList := args[4 : len(args)-1]
+				peer.WriteLen(len(idList))
+				for _, id := range idList {
+					peer.WriteBulk(id)
+				}
+				return true
+			}
+		}
+
+		return false
+	})
+
+	var handledIdList []string
+	consumer := redisPool.NewStreamConsumer("stream", "group", "consumer", func(entry *StreamEntry) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handledIdList = append(handledIdList, entry.Id)
+		return nil
+	})
+	if !consumer.claimIdList([]string{keepId, deleteId}) {
+		t.Fatalf("claim failed")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(handledIdList) != 1 || handledIdList[0] != keepId {
+		t.Errorf("handled %v, expected only %s", handledIdList, keepId)
+	}
+
+	// 已被删除的消息也需要确认，不能一直留在待确认列表中
+	if !ackMap[keepId] || !ackMap[deleteId] {
+		t.Errorf("acked %v, expected %s and %s", ackMap, keepId, deleteId)
+	}
+}
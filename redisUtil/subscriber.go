@@ -0,0 +1,389 @@
+package redisUtil
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/polariseye/goutil/logUtil"
+)
+
+const (
+	// 订阅连接的心跳间隔，超过两倍间隔没有收到任何数据则认为连接已断开
+	con_SUBSCRIBE_PING_INTERVAL = 30 * time.Second
+
+	// 订阅连接断开后的最小重连间隔
+	con_SUBSCRIBE_MIN_RECONNECT_INTERVAL = 100 * time.Millisecond
+
+	// 订阅连接断开后的最大重连间隔
+	con_SUBSCRIBE_MAX_RECONNECT_INTERVAL = 10 * time.Second
+
+	// 未指定处理方法时消息通道的缓冲大小
+	con_SUBSCRIBE_MESSAGE_BUFFER = 1024
+)
+
+// 订阅收到的消息
+type SubscribeMessage struct {
+	// 匹配的模式(通过PSubscribe订阅时才有值)
+	Pattern string
+
+	// 频道名
+	Channel string
+
+	// 消息内容
+	Data []byte
+}
+
+// 订阅对象，使用独立的连接订阅频道，网络断开后会自动重连并重新订阅
+type Subscriber struct {
+	redisPool *RedisPool
+
+	// 消息处理方法，为nil时消息通过Messages返回的通道投递
+	handler func(message *SubscribeMessage)
+
+	// 消息通道
+	messageChan chan *SubscribeMessage
+
+	// 重连并重新订阅成功后的回调
+	reconnectHandler func()
+
+	// 当前的订阅连接，断开时为nil
+	conn *redis.PubSubConn
+
+	// 已订阅的频道和模式
+	channelMap map[string]bool
+	patternMap map[string]bool
+
+	// 锁对象，保护以上字段以及对连接的写操作
+	mutex sync.Mutex
+
+	// 用于停止协程
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// 接收协程退出信号
+	closeSignal chan struct{}
+}
+
+// 创建订阅对象
+// handler:消息处理方法(在接收协程中调用)，为nil时通过Messages返回的通道获取消息
+// 返回值:
+// 订阅对象
+func (this *RedisPool) NewSubscriber(handler func(message *SubscribeMessage)) *Subscriber {
+	subscriberObj := &Subscriber{
+		redisPool:   this,
+		handler:     handler,
+		channelMap:  make(map[string]bool),
+		patternMap:  make(map[string]bool),
+		done:        make(chan struct{}),
+		closeSignal: make(chan struct{}),
+	}
+	if handler == nil {
+		subscriberObj.messageChan = make(chan *SubscribeMessage, con_SUBSCRIBE_MESSAGE_BUFFER)
+	}
+
+	go subscriberObj.receiveLoop()
+
+	return subscriberObj
+}
+
+// 获取消息通道(创建时未指定处理方法才有效)，Close之后通道会被关闭
+// 返回值:
+// 消息通道
+func (this *Subscriber) Messages() <-chan *SubscribeMessage {
+	return this.messageChan
+}
+
+// 设置重连回调，在断线重连并重新订阅成功之后调用，可用于重新同步断线期间遗漏的数据
+// handler:回调方法
+func (this *Subscriber) SetReconnectHandler(handler func()) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.reconnectHandler = handler
+}
+
+// 订阅频道
+// channels:频道列表
+// 返回值:
+// 错误对象(连接断开时不返回错误，重连后会自动订阅)
+func (this *Subscriber) Subscribe(channels ...string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, channel := range channels {
+		this.channelMap[channel] = true
+	}
+	if this.conn == nil {
+		return nil
+	}
+
+	return this.conn.Subscribe(stringsToArgs(channels)...)
+}
+
+// 按模式订阅频道
+// patterns:模式列表，如：chat.*
+// 返回值:
+// 错误对象(连接断开时不返回错误，重连后会自动订阅)
+func (this *Subscriber) PSubscribe(patterns ...string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, pattern := range patterns {
+		this.patternMap[pattern] = true
+	}
+	if this.conn == nil {
+		return nil
+	}
+
+	return this.conn.PSubscribe(stringsToArgs(patterns)...)
+}
+
+// 取消订阅频道
+// channels:频道列表
+// 返回值:
+// 错误对象
+func (this *Subscriber) Unsubscribe(channels ...string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, channel := range channels {
+		delete(this.channelMap, channel)
+	}
+	if this.conn == nil || len(channels) == 0 {
+		return nil
+	}
+
+	return this.conn.Unsubscribe(stringsToArgs(channels)...)
+}
+
+// 取消按模式订阅
+// patterns:模式列表
+// 返回值:
+// 错误对象
+func (this *Subscriber) PUnsubscribe(patterns ...string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, pattern := range patterns {
+		delete(this.patternMap, pattern)
+	}
+	if this.conn == nil || len(patterns) == 0 {
+		return nil
+	}
+
+	return this.conn.PUnsubscribe(stringsToArgs(patterns)...)
+}
+
+// 关闭订阅对象，等待接收协程退出
+func (this *Subscriber) Close() {
+	this.closeOnce.Do(func() {
+		close(this.done)
+
+		this.mutex.Lock()
+		if this.conn != nil {
+			this.conn.Close()
+		}
+		this.mutex.Unlock()
+
+		<-this.closeSignal
+		if this.messageChan != nil {
+			close(this.messageChan)
+		}
+	})
+}
+
+// 接收协程：建立连接、接收消息，连接断开后按递增的间隔重连
+func (this *Subscriber) receiveLoop() {
+	defer close(this.closeSignal)
+
+	isFirst := true
+	reconnectInterval := con_SUBSCRIBE_MIN_RECONNECT_INTERVAL
+	for {
+		conn, err := this.connect()
+		if conn == nil {
+			if err == nil {
+				// 已经关闭
+				return
+			}
+
+			logUtil.NormalLog(fmt.Sprintf("redisUtil.Subscriber: %s连接失败，%v后重试，错误信息为：%s", this.redisPool.GetName(), reconnectInterval, err), logUtil.Error)
+			select {
+			case <-this.done:
+				return
+			case <-time.After(reconnectInterval):
+			}
+
+			reconnectInterval *= 2
+			if reconnectInterval > con_SUBSCRIBE_MAX_RECONNECT_INTERVAL {
+				reconnectInterval = con_SUBSCRIBE_MAX_RECONNECT_INTERVAL
+			}
+			continue
+		}
+
+		reconnectInterval = con_SUBSCRIBE_MIN_RECONNECT_INTERVAL
+		err = this.receive(conn, !isFirst)
+		isFirst = false
+
+		this.mutex.Lock()
+		this.conn = nil
+		this.mutex.Unlock()
+		conn.Close()
+
+		select {
+		case <-this.done:
+			return
+		default:
+			logUtil.NormalLog(fmt.Sprintf("redisUtil.Subscriber: %s连接断开，准备重连，错误信息为：%s", this.redisPool.GetName(), err), logUtil.Warn)
+		}
+	}
+}
+
+// 建立订阅连接并订阅所有已记录的频道和模式
+// 返回值:
+// 订阅连接(已关闭时为nil)
+// 错误对象
+func (this *Subscriber) connect() (*redis.PubSubConn, error) {
+	rawConn, err := this.redisPool.dialConnection()
+	if err != nil {
+		return nil, err
+	}
+	conn := &redis.PubSubConn{Conn: rawConn}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	select {
+	case <-this.done:
+		conn.Close()
+		return nil, nil
+	default:
+	}
+
+	if len(this.channelMap) > 0 {
+		if err = conn.Subscribe(stringsToArgs(mapKeys(this.channelMap))...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if len(this.patternMap) > 0 {
+		if err = conn.PSubscribe(stringsToArgs(mapKeys(this.patternMap))...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	this.conn = conn
+
+	return conn, nil
+}
+
+// 接收消息直到连接出错
+// conn:订阅连接
+// isReconnect:是否是重连，重连时在收到订阅确认后调用重连回调
+// 返回值:
+// 错误对象
+func (this *Subscriber) receive(conn *redis.PubSubConn, isReconnect bool) error {
+	// 定时发送心跳，使网络异常能被及时发现
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go func() {
+		ticker := time.NewTicker(con_SUBSCRIBE_PING_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopPing:
+				return
+			case <-ticker.C:
+				this.mutex.Lock()
+				conn.Ping("")
+				this.mutex.Unlock()
+			}
+		}
+	}()
+
+	this.mutex.Lock()
+	isSubscribed := len(this.channelMap) > 0 || len(this.patternMap) > 0
+	this.mutex.Unlock()
+	if isReconnect && !isSubscribed {
+		this.onReconnected()
+		isReconnect = false
+	}
+
+	for {
+		switch value := conn.ReceiveWithTimeout(2 * con_SUBSCRIBE_PING_INTERVAL).(type) {
+		case redis.Subscription:
+			if isReconnect {
+				this.onReconnected()
+				isReconnect = false
+			}
+		case redis.Message:
+			this.deliver(&SubscribeMessage{Channel: value.Channel, Data: value.Data})
+		case redis.PMessage:
+			this.deliver(&SubscribeMessage{Pattern: value.Pattern, Channel: value.Channel, Data: value.Data})
+		case error:
+			return value
+		}
+	}
+}
+
+// 调用重连回调
+func (this *Subscriber) onReconnected() {
+	this.mutex.Lock()
+	reconnectHandler := this.reconnectHandler
+	this.mutex.Unlock()
+	if reconnectHandler == nil {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logUtil.LogUnknownError(r, "redisUtil.Subscriber.onReconnected")
+		}
+	}()
+
+	reconnectHandler()
+}
+
+// 投递消息
+// message:消息对象
+func (this *Subscriber) deliver(message *SubscribeMessage) {
+	if this.handler == nil {
+		select {
+		case this.messageChan <- message:
+		case <-this.done:
+		}
+
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logUtil.LogUnknownError(r, "redisUtil.Subscriber.deliver")
+		}
+	}()
+
+	this.handler(message)
+}
+
+// 将字符串列表转换为命令参数
+func stringsToArgs(values []string) []interface{} {
+	args := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return args
+}
+
+// 获取map的所有key
+func mapKeys(valueMap map[string]bool) []string {
+	keyList := make([]string, 0, len(valueMap))
+	for key := range valueMap {
+		keyList = append(keyList, key)
+	}
+
+	return keyList
+}
@@ -0,0 +1,14 @@
+package syncUtil
+
+// 锁接口，本地锁(Locker)和分布式锁(如redisUtil.DistributedLocker)都实现了该接口，可以互相替换
+type ILocker interface {
+	// 尝试加锁，如果在指定的时间内失败，则会返回失败；否则返回成功
+	// timeout:指定的毫秒数,timeout<=0则将会死等
+	Lock(timeout int) bool
+
+	// 锁定（死等方式）
+	WaitLock()
+
+	// 解锁
+	Unlock()
+}